@@ -0,0 +1,132 @@
+package cmds
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+)
+
+func ExportScopeCommand(root *cli.Root) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "export [scope]",
+		Short: "Export a scope and all comments as an NDJSON archive",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			stream, err := extensionClient(root).ExportScope(root.Context(), connect.NewRequest(&api.ExportScopeRequest{
+				Scope: args[0],
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to export scope: %s", err)
+			}
+			defer stream.Close()
+
+			var w io.Writer = os.Stdout
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					logrus.Fatalf("failed to create archive file: %s", err)
+				}
+				defer f.Close()
+
+				w = f
+			}
+
+			buf := bufio.NewWriter(w)
+			enc := json.NewEncoder(buf)
+
+			count := 0
+			for stream.Receive() {
+				if err := enc.Encode(stream.Msg()); err != nil {
+					logrus.Fatalf("failed to write archive: %s", err)
+				}
+
+				count++
+			}
+
+			if err := stream.Err(); err != nil {
+				logrus.Fatalf("failed to export scope: %s", err)
+			}
+
+			if err := buf.Flush(); err != nil {
+				logrus.Fatalf("failed to write archive: %s", err)
+			}
+
+			logrus.Infof("exported %d records", count)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the archive to this file instead of stdout")
+
+	return cmd
+}
+
+func ImportScopeCommand(root *cli.Root) *cobra.Command {
+	opts := api.ImportScopeRequest{}
+
+	cmd := &cobra.Command{
+		Use:   "import [archive]",
+		Short: "Import a scope archive created by export. Reads from stdin if archive is - or omitted",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var r io.Reader = os.Stdin
+			if len(args) == 1 && args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					logrus.Fatalf("failed to open archive: %s", err)
+				}
+				defer f.Close()
+
+				r = f
+			}
+
+			stream := extensionClient(root).ImportScope(root.Context())
+
+			dec := json.NewDecoder(bufio.NewReader(r))
+			// import options are only sent with the first record
+			msg := opts
+
+			for {
+
+				if err := dec.Decode(&msg.Record); err != nil {
+					if err == io.EOF {
+						break
+					}
+
+					logrus.Fatalf("failed to read archive: %s", err)
+				}
+
+				if err := stream.Send(&msg); err != nil {
+					// the actual error is returned by CloseAndReceive
+					break
+				}
+
+				msg = api.ImportScopeRequest{}
+			}
+
+			res, err := stream.CloseAndReceive()
+			if err != nil {
+				logrus.Fatalf("failed to import scope: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&opts.Scope, "scope", "", "Import into a scope with this ID instead of the archived one")
+		f.BoolVar(&opts.KeepIDs, "keep-ids", false, "Keep the archived comment IDs instead of assigning new ones")
+		f.StringVar(&opts.OnConflict, "on-conflict", "", "What to do with existing scopes and comments: empty (abort), skip or overwrite")
+	}
+
+	return cmd
+}
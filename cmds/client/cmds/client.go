@@ -0,0 +1,12 @@
+package cmds
+
+import (
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+)
+
+// extensionClient returns a client for the comment extension service which
+// is served on the same address as the comment service.
+func extensionClient(root *cli.Root) api.ExtensionServiceClient {
+	return api.NewExtensionServiceClient(root.HttpClient, root.Config().BaseURLS.CommentService)
+}
@@ -4,12 +4,14 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	commentv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/comment/v1"
 	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
 )
 
 func CommentsCommand(root *cli.Root) *cobra.Command {
@@ -60,6 +62,15 @@ func CommentsCommand(root *cli.Root) *cobra.Command {
 
 	cmd.AddCommand(
 		CreateCommentCommand(root),
+		EditCommentCommand(root),
+		PreviewCommentCommand(root),
+		CommentRevisionsCommand(root),
+		DeleteCommentCommand(root),
+		ListThreadsCommand(root),
+		SearchCommentsCommand(root),
+		ShowCommentCommand(root),
+		ReactCommand(root),
+		WatchCommentsCommand(root),
 	)
 
 	return cmd
@@ -94,30 +105,8 @@ func CreateCommentCommand(root *cli.Root) *cobra.Command {
 				scope = parentComment.Msg.Result.Comment.Scope
 			}
 
-			if strings.HasPrefix(content, "@") {
-				filename := strings.TrimPrefix(content, "@")
-
-				var (
-					blob []byte
-					err  error
-				)
-
-				switch filename {
-				case "-":
-					blob, err = io.ReadAll(os.Stdin)
-				default:
-					blob, err = os.ReadFile(filename)
-				}
-
-				if err != nil {
-					logrus.Fatalf("failed to read content from %q: %s", filename, err)
-				}
-
-				content = string(blob)
-			}
-
 			req := &commentv1.CreateCommentRequest{
-				Content: content,
+				Content: readContent(content),
 			}
 
 			if parent != "" {
@@ -155,3 +144,327 @@ func CreateCommentCommand(root *cli.Root) *cobra.Command {
 
 	return cmd
 }
+
+func EditCommentCommand(root *cli.Root) *cobra.Command {
+	var content string
+
+	cmd := &cobra.Command{
+		Use:     "edit [comment-id]",
+		Aliases: []string{"update"},
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).UpdateComment(root.Context(), connect.NewRequest(&api.UpdateCommentRequest{
+				ID:      args[0],
+				Content: readContent(content),
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to update comment: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	cmd.Flags().StringVar(&content, "content", "", "The new content of the comment or the name of a file prefixed with @")
+	_ = cmd.MarkFlagRequired("content")
+
+	return cmd
+}
+
+func PreviewCommentCommand(root *cli.Root) *cobra.Command {
+	var (
+		content string
+		scope   string
+	)
+
+	cmd := &cobra.Command{
+		Use: "preview",
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).PreviewComment(root.Context(), connect.NewRequest(&api.PreviewCommentRequest{
+				Scope:   scope,
+				Content: readContent(content),
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to preview comment: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&content, "content", "", "The content of the comment or the name of a file prefixed with @")
+		f.StringVar(&scope, "scope", "", "The ID of the scope")
+	}
+
+	_ = cmd.MarkFlagRequired("content")
+	_ = cmd.MarkFlagRequired("scope")
+
+	return cmd
+}
+
+func CommentRevisionsCommand(root *cli.Root) *cobra.Command {
+	return &cobra.Command{
+		Use:     "revisions [comment-id]",
+		Aliases: []string{"history"},
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).ListCommentRevisions(root.Context(), connect.NewRequest(&api.ListCommentRevisionsRequest{
+				ID: args[0],
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to load comment revisions: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+}
+
+func DeleteCommentCommand(root *cli.Root) *cobra.Command {
+	var purge bool
+
+	cmd := &cobra.Command{
+		Use:     "delete [comment-id]",
+		Aliases: []string{"remove", "rm"},
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).DeleteComment(root.Context(), connect.NewRequest(&api.DeleteCommentRequest{
+				ID:    args[0],
+				Purge: purge,
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to delete comment: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	cmd.Flags().BoolVar(&purge, "purge", false, "Remove the comment and all answers from the database (admin only)")
+
+	return cmd
+}
+
+func ShowCommentCommand(root *cli.Root) *cobra.Command {
+	req := &api.GetCommentDetailsRequest{}
+
+	cmd := &cobra.Command{
+		Use:  "show [comment-id]",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req.ID = args[0]
+
+			res, err := extensionClient(root).GetCommentDetails(root.Context(), connect.NewRequest(req))
+			if err != nil {
+				logrus.Fatalf("failed to get comment: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.BoolVar(&req.Recurse, "recurse", false, "Include all answers")
+		f.BoolVar(&req.RenderHTML, "render-html", false, "Render the comment content as HTML")
+	}
+
+	return cmd
+}
+
+func ReactCommand(root *cli.Root) *cobra.Command {
+	var remove bool
+
+	cmd := &cobra.Command{
+		Use:   "react [comment-id] [emoji]",
+		Short: "Add or remove an emoji reaction, like \"+1\" or \":eyes:\"",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			cli := extensionClient(root)
+
+			if remove {
+				res, err := cli.RemoveReaction(root.Context(), connect.NewRequest(&api.RemoveReactionRequest{
+					CommentID: args[0],
+					Emoji:     args[1],
+				}))
+				if err != nil {
+					logrus.Fatalf("failed to remove reaction: %s", err)
+				}
+
+				root.Print(res.Msg)
+
+				return
+			}
+
+			res, err := cli.AddReaction(root.Context(), connect.NewRequest(&api.AddReactionRequest{
+				CommentID: args[0],
+				Emoji:     args[1],
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to add reaction: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	cmd.Flags().BoolVar(&remove, "remove", false, "Remove the reaction instead of adding it")
+
+	return cmd
+}
+
+func WatchCommentsCommand(root *cli.Root) *cobra.Command {
+	req := &api.WatchCommentsRequest{}
+
+	cmd := &cobra.Command{
+		Use:   "watch [scope]",
+		Short: "Print comment events of a scope as they happen",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req.Scope = args[0]
+
+			stream, err := extensionClient(root).WatchComments(root.Context(), connect.NewRequest(req))
+			if err != nil {
+				logrus.Fatalf("failed to watch comments: %s", err)
+			}
+			defer stream.Close()
+
+			for stream.Receive() {
+				root.Print(stream.Msg())
+			}
+
+			if err := stream.Err(); err != nil {
+				logrus.Fatalf("comment stream failed: %s", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&req.Reference, "ref", "", "Only watch comments with this reference")
+
+	return cmd
+}
+
+func ListThreadsCommand(root *cli.Root) *cobra.Command {
+	req := &api.ListCommentThreadsRequest{}
+
+	cmd := &cobra.Command{
+		Use:  "threads [scope]",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req.Scope = args[0]
+
+			res, err := extensionClient(root).ListCommentThreads(root.Context(), connect.NewRequest(req))
+			if err != nil {
+				logrus.Fatalf("failed to list comment threads: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&req.Reference, "ref", "", "Filter comments by reference")
+		f.BoolVar(&req.Recurse, "recurse", false, "Include all answers as well")
+		f.BoolVar(&req.RenderHTML, "render-html", false, "Render comment content as HTML")
+		f.IntVar(&req.PageSize, "page-size", 0, "The maximum number of threads to return")
+		f.StringVar(&req.PageToken, "page-token", "", "The next-page token of a previous call")
+		f.StringVar(&req.Order, "order", "", "Sort order of root comments, either asc or desc")
+	}
+
+	return cmd
+}
+
+func SearchCommentsCommand(root *cli.Root) *cobra.Command {
+	var (
+		req     = &api.SearchCommentsRequest{}
+		creator string
+		after   string
+		before  string
+	)
+
+	cmd := &cobra.Command{
+		Use:  "search [query]",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req.Query = strings.Join(args, " ")
+
+			if creator != "" {
+				req.CreatorID = root.MustResolveUserToId(creator)
+			}
+
+			if after != "" {
+				t := parseTime(after)
+				req.CreatedAfter = &t
+			}
+
+			if before != "" {
+				t := parseTime(before)
+				req.CreatedBefore = &t
+			}
+
+			res, err := extensionClient(root).SearchComments(root.Context(), connect.NewRequest(req))
+			if err != nil {
+				logrus.Fatalf("failed to search comments: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&req.Scope, "scope", "", "Only search comments in this scope")
+		f.StringVar(&req.Reference, "ref", "", "Only search comments with this reference")
+		f.StringVar(&creator, "creator", "", "Only search comments created by this user (id or name)")
+		f.StringVar(&after, "after", "", "Only search comments created after this time (RFC3339 or YYYY-MM-DD)")
+		f.StringVar(&before, "before", "", "Only search comments created before this time (RFC3339 or YYYY-MM-DD)")
+		f.IntVar(&req.PageSize, "page-size", 0, "The maximum number of results to return")
+		f.StringVar(&req.PageToken, "page-token", "", "The next-page token of a previous call")
+	}
+
+	return cmd
+}
+
+func parseTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t
+		}
+	}
+
+	logrus.Fatalf("invalid time %q, expected RFC3339 or YYYY-MM-DD", value)
+
+	// not reachable
+	return time.Time{}
+}
+
+// readContent returns content as is or, if prefixed with @, reads the content
+// from the named file. Use "@-" to read from stdin.
+func readContent(content string) string {
+	if !strings.HasPrefix(content, "@") {
+		return content
+	}
+
+	filename := strings.TrimPrefix(content, "@")
+
+	var (
+		blob []byte
+		err  error
+	)
+
+	switch filename {
+	case "-":
+		blob, err = io.ReadAll(os.Stdin)
+	default:
+		blob, err = os.ReadFile(filename)
+	}
+
+	if err != nil {
+		logrus.Fatalf("failed to read content from %q: %s", filename, err)
+	}
+
+	return string(blob)
+}
@@ -0,0 +1,66 @@
+package cmds
+
+import (
+	"github.com/bufbuild/connect-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+)
+
+func OutboxCommand(root *cli.Root) *cobra.Command {
+	var state string
+
+	cmd := &cobra.Command{
+		Use:   "notification-outbox",
+		Short: "Manage notification deliveries",
+		Aliases: []string{
+			"outbox",
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).ListOutboxEntries(root.Context(), connect.NewRequest(&api.ListOutboxEntriesRequest{
+				State: state,
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to list outbox entries: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	cmd.Flags().StringVar(&state, "state", "", "Only list entries in this state (pending, delivered, failed or discarded). Defaults to failed")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:  "retry [id]",
+			Args: cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				res, err := extensionClient(root).RetryOutboxEntry(root.Context(), connect.NewRequest(&api.RetryOutboxEntryRequest{
+					ID: args[0],
+				}))
+				if err != nil {
+					logrus.Fatalf("failed to retry outbox entry: %s", err)
+				}
+
+				root.Print(res.Msg)
+			},
+		},
+		&cobra.Command{
+			Use:  "discard [id]",
+			Args: cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				res, err := extensionClient(root).DiscardOutboxEntry(root.Context(), connect.NewRequest(&api.DiscardOutboxEntryRequest{
+					ID: args[0],
+				}))
+				if err != nil {
+					logrus.Fatalf("failed to discard outbox entry: %s", err)
+				}
+
+				root.Print(res.Msg)
+			},
+		},
+	)
+
+	return cmd
+}
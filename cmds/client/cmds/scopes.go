@@ -8,16 +8,16 @@ import (
 	"github.com/spf13/cobra"
 	commentv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/comment/v1"
 	"github.com/tierklinik-dobersberg/apis/pkg/cli"
-	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
 )
 
 func ScopeCommand(root *cli.Root) *cobra.Command {
 	cmd := &cobra.Command{
 		Use: "comment-scopes",
 		Run: func(_ *cobra.Command, args []string) {
-			cli := root.Comments()
+			cli := extensionClient(root)
 
-			scopeListResponse, err := cli.ListScope(root.Context(), connect.NewRequest(&commentv1.ListScopeRequest{}))
+			scopeListResponse, err := cli.ListReadableScopes(root.Context(), connect.NewRequest(&api.ListReadableScopesRequest{}))
 			if err != nil {
 				logrus.Fatal(err)
 			}
@@ -30,6 +30,11 @@ func ScopeCommand(root *cli.Root) *cobra.Command {
 		CreateScopeCommand(root),
 		UpdateScopeCommand(root),
 		DeleteScopeCommand(root),
+		ScopeAccessCommand(root),
+		WebhooksCommand(root),
+		ScopeSettingsCommand(root),
+		ExportScopeCommand(root),
+		ImportScopeCommand(root),
 	)
 
 	return cmd
@@ -75,7 +80,7 @@ func CreateScopeCommand(root *cli.Root) *cobra.Command {
 
 	f := cmd.Flags()
 	{
-		f.StringVar(&viewTemplate, "view-tmpl", "", "The go text/template string to construct a view-comment URL for this scope")
+		f.StringVar(&viewTemplate, "view-tmpl", "", "The go text/template string to construct a view-comment URL for this scope. Available fields: .Id, .Scope, .ScopeName, .Reference, .ParentId, .CreatorId and .RootId")
 		f.StringVar(&notifyType, "notify-type", "", "The notification type. either unspecified (empty), sms or email)")
 		f.StringVar(&id, "id", "", "The ID for the new scope")
 	}
@@ -84,11 +89,7 @@ func CreateScopeCommand(root *cli.Root) *cobra.Command {
 }
 
 func UpdateScopeCommand(root *cli.Root) *cobra.Command {
-	req := &commentv1.UpdateScopeRequest{
-		WriteMask: &fieldmaskpb.FieldMask{},
-	}
-
-	var notifyType string
+	req := &api.UpdateOwnedScopeRequest{}
 
 	cmd := &cobra.Command{
 		Use:  "update",
@@ -96,36 +97,40 @@ func UpdateScopeCommand(root *cli.Root) *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			flagUpdates := [][]string{
 				{"name", "name"},
-				{"notify-type", "notification_type"},
-				{"view-tmpl", "view_comment_url_template"},
-				{"add-owner", "add_scope_owner_ids"},
-				{"remove-owner", "remove_scope_owner_ids"},
+				{"notify-type", "notificationType"},
+				{"view-tmpl", "viewUrlTemplate"},
+				{"add-owner", "addOwnerIds"},
+				{"remove-owner", "removeOwnerIds"},
 			}
 
 			for _, fs := range flagUpdates {
 				if cmd.Flag(fs[0]).Changed {
-					req.WriteMask.Paths = append(req.WriteMask.Paths, fs[1])
+					req.Paths = append(req.Paths, fs[1])
 				}
+			}
 
-				if fs[0] == "notify-type" {
-					req.NotifcationType = notifyTypePb(notifyType)
-				}
+			switch req.NotificationType {
+			case "", "sms", "email":
+			case "mail":
+				req.NotificationType = "email"
+			default:
+				logrus.Fatalf("invalid value for --notify-type")
 			}
 
-			req.Id = args[0]
+			req.ID = args[0]
 
 			var err error
-			req.AddScopeOwnerIds, err = root.ResolveUserIds(root.Context(), req.AddScopeOwnerIds)
+			req.AddOwnerIDs, err = root.ResolveUserIds(root.Context(), req.AddOwnerIDs)
 			if err != nil {
 				logrus.Fatalf("failed to resolve owner ids for --add-owner: %s", err)
 			}
 
-			req.RemoveScopeOwnerIds, err = root.ResolveUserIds(root.Context(), req.RemoveScopeOwnerIds)
+			req.RemoveOwnerIDs, err = root.ResolveUserIds(root.Context(), req.RemoveOwnerIDs)
 			if err != nil {
 				logrus.Fatalf("failed to resolve owner ids for --remove-owner: %s", err)
 			}
 
-			res, err := root.Comments().UpdateScope(root.Context(), connect.NewRequest(req))
+			res, err := extensionClient(root).UpdateOwnedScope(root.Context(), connect.NewRequest(req))
 			if err != nil {
 				logrus.Fatalf("failed to update scope: %s", err)
 			}
@@ -137,10 +142,10 @@ func UpdateScopeCommand(root *cli.Root) *cobra.Command {
 	f := cmd.Flags()
 	{
 		f.StringVar(&req.Name, "name", "", "The new name for the scope")
-		f.StringVar(&req.ViewCommentUrlTemplate, "view-tmpl", "", "The new view template URL")
-		f.StringVar(&notifyType, "notify-type", "", "The new default notification type")
-		f.StringSliceVar(&req.AddScopeOwnerIds, "add-owner", nil, "Add user as an scope owner by id or name")
-		f.StringSliceVar(&req.RemoveScopeOwnerIds, "remove-owner", nil, "Remove user from scope owners by id or name")
+		f.StringVar(&req.ViewURLTemplate, "view-tmpl", "", "The new view template URL")
+		f.StringVar(&req.NotificationType, "notify-type", "", "The new default notification type")
+		f.StringSliceVar(&req.AddOwnerIDs, "add-owner", nil, "Add user as an scope owner by id or name")
+		f.StringSliceVar(&req.RemoveOwnerIDs, "remove-owner", nil, "Remove user from scope owners by id or name")
 	}
 
 	return cmd
@@ -152,10 +157,8 @@ func DeleteScopeCommand(root *cli.Root) *cobra.Command {
 		Aliases: []string{"remove", "rm"},
 		Args:    cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			cli := root.Comments()
-
-			res, err := cli.DeleteScope(root.Context(), connect.NewRequest(&commentv1.DeleteScopeRequest{
-				Id: args[0],
+			res, err := extensionClient(root).DeleteOwnedScope(root.Context(), connect.NewRequest(&api.DeleteOwnedScopeRequest{
+				ID: args[0],
 			}))
 			if err != nil {
 				logrus.Fatal(err)
@@ -166,6 +169,104 @@ func DeleteScopeCommand(root *cli.Root) *cobra.Command {
 	}
 }
 
+func ScopeAccessCommand(root *cli.Root) *cobra.Command {
+	var (
+		readers []string
+		writers []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "access [scope]",
+		Short: "Show or update which roles may read or write comments",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cli := extensionClient(root)
+
+			res, err := cli.GetScopeAccess(root.Context(), connect.NewRequest(&api.GetScopeAccessRequest{
+				Scope: args[0],
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to get scope access: %s", err)
+			}
+
+			access := res.Msg.Access
+
+			if !cmd.Flag("reader-role").Changed && !cmd.Flag("writer-role").Changed {
+				root.Print(res.Msg)
+
+				return
+			}
+
+			if cmd.Flag("reader-role").Changed {
+				access.ReaderRoles = readers
+			}
+
+			if cmd.Flag("writer-role").Changed {
+				access.WriterRoles = writers
+			}
+
+			updateRes, err := cli.UpdateScopeAccess(root.Context(), connect.NewRequest(&api.UpdateScopeAccessRequest{
+				Access: access,
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to update scope access: %s", err)
+			}
+
+			root.Print(updateRes.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringSliceVar(&readers, "reader-role", nil, "Roles (by ID or name) allowed to read comments. Pass an empty value to allow all users")
+		f.StringSliceVar(&writers, "writer-role", nil, "Roles (by ID or name) allowed to write comments. Pass an empty value to allow all users")
+	}
+
+	return cmd
+}
+
+func ScopeSettingsCommand(root *cli.Root) *cobra.Command {
+	var htmlPolicy string
+
+	cmd := &cobra.Command{
+		Use:   "settings [scope]",
+		Short: "Show or update additional scope settings",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cli := extensionClient(root)
+
+			res, err := cli.GetScopeSettings(root.Context(), connect.NewRequest(&api.GetScopeSettingsRequest{
+				Scope: args[0],
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to get scope settings: %s", err)
+			}
+
+			if !cmd.Flag("html-policy").Changed {
+				root.Print(res.Msg)
+
+				return
+			}
+
+			settings := res.Msg.Settings
+			settings.HTMLPolicy = htmlPolicy
+
+			updateRes, err := cli.UpdateScopeSettings(root.Context(), connect.NewRequest(&api.UpdateScopeSettingsRequest{
+				Settings: settings,
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to update scope settings: %s", err)
+			}
+
+			root.Print(updateRes.Msg)
+		},
+	}
+
+	cmd.Flags().StringVar(&htmlPolicy, "html-policy", "", "How raw HTML in comments is handled: empty (omitted), allow (sanitized) or forbid (rejected)")
+
+	return cmd
+}
+
 func notifyTypePb(nt string) commentv1.NotificationType {
 	switch nt {
 	case "":
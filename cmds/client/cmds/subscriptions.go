@@ -0,0 +1,87 @@
+package cmds
+
+import (
+	"github.com/bufbuild/connect-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+)
+
+func SubscriptionsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "subscriptions",
+		Short: "Manage comment notification subscriptions",
+		Aliases: []string{
+			"subs",
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).ListSubscriptions(root.Context(), connect.NewRequest(&api.ListSubscriptionsRequest{}))
+			if err != nil {
+				logrus.Fatalf("failed to list subscriptions: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	cmd.AddCommand(
+		subscriptionTargetCommand(root, "subscribe", "Subscribe to a thread, scope or reference", func(target api.SubscriptionTarget) {
+			res, err := extensionClient(root).Subscribe(root.Context(), connect.NewRequest(&api.SubscribeRequest{
+				Target: target,
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to subscribe: %s", err)
+			}
+
+			root.Print(res.Msg)
+		}),
+		subscriptionTargetCommand(root, "mute", "Mute notifications for a thread, scope or reference", func(target api.SubscriptionTarget) {
+			res, err := extensionClient(root).Mute(root.Context(), connect.NewRequest(&api.MuteRequest{
+				Target: target,
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to mute: %s", err)
+			}
+
+			root.Print(res.Msg)
+		}),
+		subscriptionTargetCommand(root, "unsubscribe", "Remove a subscription or mute", func(target api.SubscriptionTarget) {
+			res, err := extensionClient(root).Unsubscribe(root.Context(), connect.NewRequest(&api.UnsubscribeRequest{
+				Target: target,
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to unsubscribe: %s", err)
+			}
+
+			root.Print(res.Msg)
+		}),
+	)
+
+	return cmd
+}
+
+func subscriptionTargetCommand(root *cli.Root, use string, short string, fn func(api.SubscriptionTarget)) *cobra.Command {
+	var target api.SubscriptionTarget
+
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Run: func(cmd *cobra.Command, args []string) {
+			if target.ThreadID == "" && target.Scope == "" {
+				logrus.Fatalf("either --thread or --scope must be specified")
+			}
+
+			fn(target)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&target.ThreadID, "thread", "", "The ID of a comment in the thread")
+		f.StringVar(&target.Scope, "scope", "", "The ID of the scope")
+		f.StringVar(&target.Reference, "ref", "", "An optional reference within the scope")
+	}
+
+	return cmd
+}
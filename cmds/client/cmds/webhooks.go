@@ -0,0 +1,127 @@
+package cmds
+
+import (
+	"github.com/bufbuild/connect-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+)
+
+func WebhooksCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "webhooks [scope]",
+		Short: "Manage webhooks of a scope",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).ListWebhooks(root.Context(), connect.NewRequest(&api.ListWebhooksRequest{
+				Scope: args[0],
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to list webhooks: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	cmd.AddCommand(
+		CreateWebhookCommand(root),
+		DeleteWebhookCommand(root),
+		WebhookDeliveriesCommand(root),
+	)
+
+	return cmd
+}
+
+func CreateWebhookCommand(root *cli.Root) *cobra.Command {
+	req := &api.CreateWebhookRequest{}
+
+	cmd := &cobra.Command{
+		Use:   "create [scope] [url]",
+		Short: "Register a new webhook. The secret is only printed once",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			req.Scope = args[0]
+			req.URL = args[1]
+
+			res, err := extensionClient(root).CreateWebhook(root.Context(), connect.NewRequest(req))
+			if err != nil {
+				logrus.Fatalf("failed to create webhook: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringSliceVar(&req.Events, "event", nil, "Only deliver these events (created, edited or deleted). Defaults to all events")
+		f.StringVar(&req.Secret, "secret", "", "The secret used to sign payloads. Generated if empty")
+	}
+
+	return cmd
+}
+
+func DeleteWebhookCommand(root *cli.Root) *cobra.Command {
+	return &cobra.Command{
+		Use:     "delete [webhook-id]",
+		Aliases: []string{"remove", "rm"},
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := extensionClient(root).DeleteWebhook(root.Context(), connect.NewRequest(&api.DeleteWebhookRequest{
+				ID: args[0],
+			}))
+			if err != nil {
+				logrus.Fatalf("failed to delete webhook: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+}
+
+func WebhookDeliveriesCommand(root *cli.Root) *cobra.Command {
+	req := &api.ListWebhookDeliveriesRequest{}
+
+	cmd := &cobra.Command{
+		Use:   "deliveries [webhook-id]",
+		Short: "Show the delivery log of a webhook",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req.WebhookID = args[0]
+
+			res, err := extensionClient(root).ListWebhookDeliveries(root.Context(), connect.NewRequest(req))
+			if err != nil {
+				logrus.Fatalf("failed to list webhook deliveries: %s", err)
+			}
+
+			root.Print(res.Msg)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&req.State, "state", "", "Only list deliveries in this state (pending, delivered or failed)")
+		f.IntVar(&req.Limit, "limit", 0, "The maximum number of deliveries to show")
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:  "retry [delivery-id]",
+			Args: cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				res, err := extensionClient(root).RetryWebhookDelivery(root.Context(), connect.NewRequest(&api.RetryWebhookDeliveryRequest{
+					ID: args[0],
+				}))
+				if err != nil {
+					logrus.Fatalf("failed to retry webhook delivery: %s", err)
+				}
+
+				root.Print(res.Msg)
+			},
+		},
+	)
+
+	return cmd
+}
@@ -12,6 +12,8 @@ func main() {
 	root.AddCommand(
 		cmds.ScopeCommand(root),
 		cmds.CommentsCommand(root),
+		cmds.OutboxCommand(root),
+		cmds.SubscriptionsCommand(root),
 	)
 
 	if err := root.Execute(); err != nil {
@@ -16,6 +16,7 @@ import (
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
 	"github.com/tierklinik-dobersberg/apis/pkg/server"
 	"github.com/tierklinik-dobersberg/apis/pkg/validator"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
 	"github.com/tierklinik-dobersberg/comment-service/internal/config"
 	"github.com/tierklinik-dobersberg/comment-service/internal/service"
 	"google.golang.org/protobuf/reflect/protoregistry"
@@ -26,9 +27,23 @@ func main() {
 
 	logger := log.L(ctx)
 
+	args := os.Args[1:]
+
+	// "server migrate [config]" only applies database migrations
+	if len(args) > 0 && args[0] == "migrate" {
+		var cfgFilePath string
+		if len(args) > 1 {
+			cfgFilePath = args[1]
+		}
+
+		runMigrations(ctx, cfgFilePath)
+
+		return
+	}
+
 	var cfgFilePath string
-	if len(os.Args) > 1 {
-		cfgFilePath = os.Args[1]
+	if len(args) > 0 {
+		cfgFilePath = args[0]
 	}
 
 	cfg, err := config.LoadConfig(ctx, cfgFilePath)
@@ -70,9 +85,29 @@ func main() {
 	// create a new CallService and add it to the mux.
 	svc := service.New(providers)
 
+	// start delivering notifications from the outbox
+	go svc.RunOutboxDispatcher(ctx)
+	go svc.RunWebhookDispatcher(ctx)
+
+	// with multiple replicas, comment events must be read from the
+	// database so WatchComments sees changes of all replicas.
+	if cfg.EventSource == config.EventSourceChangeStream {
+		go svc.RunChangeStream(ctx)
+	}
+
 	path, handler := commentv1connect.NewCommentServiceHandler(svc, interceptors)
 	serveMux.Handle(path, handler)
 
+	// the extension service uses a JSON codec and thus cannot use the
+	// protobuf based auth and validation interceptors.
+	extInterceptors := connect.WithInterceptors(
+		log.NewLoggingInterceptor(),
+		api.NewAuthInterceptor(auth.NewIDMRoleResolver(providers.Roles), service.AdminRole),
+	)
+
+	path, handler = api.NewExtensionServiceHandler(svc, extInterceptors)
+	serveMux.Handle(path, handler)
+
 	// Register at service catalog
 	catalog, err := consuldiscover.NewFromEnv()
 	if err != nil {
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/config"
+	"github.com/tierklinik-dobersberg/comment-service/internal/repo"
+)
+
+// runMigrations applies all pending database migrations and exits. It's
+// meant to be used with SKIP_MIGRATIONS when migrations should be applied
+// by a separate deployment step.
+func runMigrations(ctx context.Context, cfgFilePath string) {
+	logger := log.L(ctx)
+
+	cfg, err := config.LoadConfig(ctx, cfgFilePath)
+	if err != nil {
+		logger.Fatalf("failed to load configuration: %s", err)
+	}
+
+	repository, err := repo.New(ctx, cfg.Database)
+	if err != nil {
+		logger.Fatalf("failed to create repository: %s", err)
+	}
+
+	if err := repo.Migrate(ctx, repository); err != nil {
+		logger.Fatalf("failed to migrate database: %s", err)
+	}
+
+	logger.Infof("database migrations applied successfully")
+}
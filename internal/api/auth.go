@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/bufbuild/connect-go"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+var remoteUserContextKey = struct{ S string }{S: "apiRemoteUserContextKey"}
+
+// WithRemoteUser returns a new context that carries usr.
+func WithRemoteUser(ctx context.Context, usr *auth.RemoteUser) context.Context {
+	return context.WithValue(ctx, remoteUserContextKey, usr)
+}
+
+// RemoteUserFrom returns the remote user that has been attached to ctx by
+// the interceptor returned from NewAuthInterceptor.
+func RemoteUserFrom(ctx context.Context) *auth.RemoteUser {
+	v, _ := ctx.Value(remoteUserContextKey).(*auth.RemoteUser)
+	return v
+}
+
+// NewAuthInterceptor returns a connect interceptor that extracts the remote
+// user from the X-Remote-* headers, resolves the user roles and marks the user
+// as an administrator if one of adminRoles (either by ID or name) is assigned.
+//
+// The auth.NewAuthAnnotationInterceptor cannot be used for the extension service
+// as it requires protobuf method descriptors. All extension service methods
+// require an authenticated user.
+func NewAuthInterceptor(resolver auth.RoleResolverFunc, adminRoles ...string) connect.Interceptor {
+	return &authInterceptor{
+		resolver:   resolver,
+		adminRoles: adminRoles,
+		roles:      make(map[string]*idmv1.Role),
+	}
+}
+
+type authInterceptor struct {
+	resolver   auth.RoleResolverFunc
+	adminRoles []string
+
+	rl    sync.RWMutex
+	roles map[string]*idmv1.Role
+}
+
+func (ai *authInterceptor) getRole(ctx context.Context, roleId string) (*idmv1.Role, error) {
+	ai.rl.RLock()
+	role, ok := ai.roles[roleId]
+	ai.rl.RUnlock()
+
+	if ok {
+		return role, nil
+	}
+
+	role, err := ai.resolver(ctx, roleId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve role %q: %w", roleId, err)
+	}
+
+	ai.rl.Lock()
+	defer ai.rl.Unlock()
+
+	ai.roles[roleId] = role
+
+	return role, nil
+}
+
+func (ai *authInterceptor) authenticate(ctx context.Context, req connect.AnyRequest) (context.Context, error) {
+	usr, err := auth.RemoteHeaderExtractor(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr.ID == "" {
+		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("no access token provided: missing ID"))
+	}
+
+	for _, roleId := range usr.RoleIDs {
+		role, err := ai.getRole(ctx, roleId)
+		if err != nil {
+			return nil, err
+		}
+
+		usr.ResolvedRoles = append(usr.ResolvedRoles, role)
+
+		if slices.Contains(ai.adminRoles, role.Id) || slices.Contains(ai.adminRoles, role.Name) {
+			usr.Admin = true
+		}
+	}
+
+	l := log.L(ctx).
+		WithField("user.id", usr.ID).
+		WithField("user.displayName", usr.DisplayName)
+
+	ctx = log.WithLogger(ctx, l)
+
+	return WithRemoteUser(ctx, &usr), nil
+}
+
+func (ai *authInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		ctx, err := ai.authenticate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return next(ctx, req)
+	}
+}
+
+func (ai *authInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (ai *authInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		// auth.RemoteHeaderExtractor only needs the request headers so
+		// wrap them in an empty request.
+		req := connect.NewRequest(&struct{}{})
+		for key, values := range conn.RequestHeader() {
+			req.Header()[key] = values
+		}
+
+		ctx, err := ai.authenticate(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		return next(ctx, conn)
+	}
+}
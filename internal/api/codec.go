@@ -0,0 +1,28 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/bufbuild/connect-go"
+)
+
+// jsonCodec is a connect.Codec that marshals plain Go structs using
+// encoding/json. The extension service does not have generated protobuf
+// messages so the default protobuf codecs cannot be used.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(msg any) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Unmarshal(blob []byte, msg any) error {
+	if len(blob) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(blob, msg)
+}
+
+var _ connect.Codec = jsonCodec{}
@@ -0,0 +1,491 @@
+// Package api contains the comment extension service.
+//
+// The extension service exposes operations that are not (yet) part of the
+// tkd.comment.v1.CommentService protobuf definition. It uses the connect
+// protocol with a JSON codec and plain Go request and response types and is
+// served next to the generated CommentService handler.
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bufbuild/connect-go"
+)
+
+// ServiceName is the fully-qualified name of the extension service.
+const ServiceName = "tkd.comment.ext.v1.ExtensionService"
+
+const (
+	UpdateCommentProcedure         = "/" + ServiceName + "/UpdateComment"
+	ListCommentRevisionsProcedure  = "/" + ServiceName + "/ListCommentRevisions"
+	DeleteCommentProcedure         = "/" + ServiceName + "/DeleteComment"
+	ListCommentThreadsProcedure    = "/" + ServiceName + "/ListCommentThreads"
+	SearchCommentsProcedure        = "/" + ServiceName + "/SearchComments"
+	ListOutboxEntriesProcedure     = "/" + ServiceName + "/ListOutboxEntries"
+	RetryOutboxEntryProcedure      = "/" + ServiceName + "/RetryOutboxEntry"
+	DiscardOutboxEntryProcedure    = "/" + ServiceName + "/DiscardOutboxEntry"
+	SubscribeProcedure             = "/" + ServiceName + "/Subscribe"
+	MuteProcedure                  = "/" + ServiceName + "/Mute"
+	UnsubscribeProcedure           = "/" + ServiceName + "/Unsubscribe"
+	ListSubscriptionsProcedure     = "/" + ServiceName + "/ListSubscriptions"
+	GetScopeAccessProcedure        = "/" + ServiceName + "/GetScopeAccess"
+	UpdateScopeAccessProcedure     = "/" + ServiceName + "/UpdateScopeAccess"
+	ListReadableScopesProcedure    = "/" + ServiceName + "/ListReadableScopes"
+	UpdateOwnedScopeProcedure      = "/" + ServiceName + "/UpdateOwnedScope"
+	DeleteOwnedScopeProcedure      = "/" + ServiceName + "/DeleteOwnedScope"
+	GetCommentDetailsProcedure     = "/" + ServiceName + "/GetCommentDetails"
+	AddReactionProcedure           = "/" + ServiceName + "/AddReaction"
+	RemoveReactionProcedure        = "/" + ServiceName + "/RemoveReaction"
+	WatchCommentsProcedure         = "/" + ServiceName + "/WatchComments"
+	CreateWebhookProcedure         = "/" + ServiceName + "/CreateWebhook"
+	ListWebhooksProcedure          = "/" + ServiceName + "/ListWebhooks"
+	DeleteWebhookProcedure         = "/" + ServiceName + "/DeleteWebhook"
+	ListWebhookDeliveriesProcedure = "/" + ServiceName + "/ListWebhookDeliveries"
+	RetryWebhookDeliveryProcedure  = "/" + ServiceName + "/RetryWebhookDelivery"
+	GetScopeSettingsProcedure      = "/" + ServiceName + "/GetScopeSettings"
+	UpdateScopeSettingsProcedure   = "/" + ServiceName + "/UpdateScopeSettings"
+	ExportScopeProcedure           = "/" + ServiceName + "/ExportScope"
+	ImportScopeProcedure           = "/" + ServiceName + "/ImportScope"
+	PreviewCommentProcedure        = "/" + ServiceName + "/PreviewComment"
+)
+
+// ExtensionServiceHandler is implemented by the comment service.
+type ExtensionServiceHandler interface {
+	UpdateComment(context.Context, *connect.Request[UpdateCommentRequest]) (*connect.Response[UpdateCommentResponse], error)
+	ListCommentRevisions(context.Context, *connect.Request[ListCommentRevisionsRequest]) (*connect.Response[ListCommentRevisionsResponse], error)
+	DeleteComment(context.Context, *connect.Request[DeleteCommentRequest]) (*connect.Response[DeleteCommentResponse], error)
+	ListCommentThreads(context.Context, *connect.Request[ListCommentThreadsRequest]) (*connect.Response[ListCommentThreadsResponse], error)
+	SearchComments(context.Context, *connect.Request[SearchCommentsRequest]) (*connect.Response[SearchCommentsResponse], error)
+	ListOutboxEntries(context.Context, *connect.Request[ListOutboxEntriesRequest]) (*connect.Response[ListOutboxEntriesResponse], error)
+	RetryOutboxEntry(context.Context, *connect.Request[RetryOutboxEntryRequest]) (*connect.Response[RetryOutboxEntryResponse], error)
+	DiscardOutboxEntry(context.Context, *connect.Request[DiscardOutboxEntryRequest]) (*connect.Response[DiscardOutboxEntryResponse], error)
+	Subscribe(context.Context, *connect.Request[SubscribeRequest]) (*connect.Response[SubscribeResponse], error)
+	Mute(context.Context, *connect.Request[MuteRequest]) (*connect.Response[MuteResponse], error)
+	Unsubscribe(context.Context, *connect.Request[UnsubscribeRequest]) (*connect.Response[UnsubscribeResponse], error)
+	ListSubscriptions(context.Context, *connect.Request[ListSubscriptionsRequest]) (*connect.Response[ListSubscriptionsResponse], error)
+	GetScopeAccess(context.Context, *connect.Request[GetScopeAccessRequest]) (*connect.Response[GetScopeAccessResponse], error)
+	UpdateScopeAccess(context.Context, *connect.Request[UpdateScopeAccessRequest]) (*connect.Response[UpdateScopeAccessResponse], error)
+	ListReadableScopes(context.Context, *connect.Request[ListReadableScopesRequest]) (*connect.Response[ListReadableScopesResponse], error)
+	UpdateOwnedScope(context.Context, *connect.Request[UpdateOwnedScopeRequest]) (*connect.Response[UpdateOwnedScopeResponse], error)
+	DeleteOwnedScope(context.Context, *connect.Request[DeleteOwnedScopeRequest]) (*connect.Response[DeleteOwnedScopeResponse], error)
+	GetCommentDetails(context.Context, *connect.Request[GetCommentDetailsRequest]) (*connect.Response[GetCommentDetailsResponse], error)
+	AddReaction(context.Context, *connect.Request[AddReactionRequest]) (*connect.Response[AddReactionResponse], error)
+	RemoveReaction(context.Context, *connect.Request[RemoveReactionRequest]) (*connect.Response[RemoveReactionResponse], error)
+	WatchComments(context.Context, *connect.Request[WatchCommentsRequest], *connect.ServerStream[CommentEvent]) error
+	CreateWebhook(context.Context, *connect.Request[CreateWebhookRequest]) (*connect.Response[CreateWebhookResponse], error)
+	ListWebhooks(context.Context, *connect.Request[ListWebhooksRequest]) (*connect.Response[ListWebhooksResponse], error)
+	DeleteWebhook(context.Context, *connect.Request[DeleteWebhookRequest]) (*connect.Response[DeleteWebhookResponse], error)
+	ListWebhookDeliveries(context.Context, *connect.Request[ListWebhookDeliveriesRequest]) (*connect.Response[ListWebhookDeliveriesResponse], error)
+	RetryWebhookDelivery(context.Context, *connect.Request[RetryWebhookDeliveryRequest]) (*connect.Response[RetryWebhookDeliveryResponse], error)
+	GetScopeSettings(context.Context, *connect.Request[GetScopeSettingsRequest]) (*connect.Response[GetScopeSettingsResponse], error)
+	UpdateScopeSettings(context.Context, *connect.Request[UpdateScopeSettingsRequest]) (*connect.Response[UpdateScopeSettingsResponse], error)
+	ExportScope(context.Context, *connect.Request[ExportScopeRequest], *connect.ServerStream[ArchiveRecord]) error
+	ImportScope(context.Context, *connect.ClientStream[ImportScopeRequest]) (*connect.Response[ImportScopeResponse], error)
+	PreviewComment(context.Context, *connect.Request[PreviewCommentRequest]) (*connect.Response[PreviewCommentResponse], error)
+}
+
+// NewExtensionServiceHandler builds an HTTP handler for svc and returns the
+// path on which to mount the handler.
+func NewExtensionServiceHandler(svc ExtensionServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	opts = append([]connect.HandlerOption{connect.WithCodec(jsonCodec{})}, opts...)
+
+	mux := http.NewServeMux()
+
+	mux.Handle(UpdateCommentProcedure, connect.NewUnaryHandler(UpdateCommentProcedure, svc.UpdateComment, opts...))
+	mux.Handle(ListCommentRevisionsProcedure, connect.NewUnaryHandler(ListCommentRevisionsProcedure, svc.ListCommentRevisions, opts...))
+	mux.Handle(DeleteCommentProcedure, connect.NewUnaryHandler(DeleteCommentProcedure, svc.DeleteComment, opts...))
+	mux.Handle(ListCommentThreadsProcedure, connect.NewUnaryHandler(ListCommentThreadsProcedure, svc.ListCommentThreads, opts...))
+	mux.Handle(SearchCommentsProcedure, connect.NewUnaryHandler(SearchCommentsProcedure, svc.SearchComments, opts...))
+	mux.Handle(ListOutboxEntriesProcedure, connect.NewUnaryHandler(ListOutboxEntriesProcedure, svc.ListOutboxEntries, opts...))
+	mux.Handle(RetryOutboxEntryProcedure, connect.NewUnaryHandler(RetryOutboxEntryProcedure, svc.RetryOutboxEntry, opts...))
+	mux.Handle(DiscardOutboxEntryProcedure, connect.NewUnaryHandler(DiscardOutboxEntryProcedure, svc.DiscardOutboxEntry, opts...))
+	mux.Handle(SubscribeProcedure, connect.NewUnaryHandler(SubscribeProcedure, svc.Subscribe, opts...))
+	mux.Handle(MuteProcedure, connect.NewUnaryHandler(MuteProcedure, svc.Mute, opts...))
+	mux.Handle(UnsubscribeProcedure, connect.NewUnaryHandler(UnsubscribeProcedure, svc.Unsubscribe, opts...))
+	mux.Handle(ListSubscriptionsProcedure, connect.NewUnaryHandler(ListSubscriptionsProcedure, svc.ListSubscriptions, opts...))
+	mux.Handle(GetScopeAccessProcedure, connect.NewUnaryHandler(GetScopeAccessProcedure, svc.GetScopeAccess, opts...))
+	mux.Handle(UpdateScopeAccessProcedure, connect.NewUnaryHandler(UpdateScopeAccessProcedure, svc.UpdateScopeAccess, opts...))
+	mux.Handle(ListReadableScopesProcedure, connect.NewUnaryHandler(ListReadableScopesProcedure, svc.ListReadableScopes, opts...))
+	mux.Handle(UpdateOwnedScopeProcedure, connect.NewUnaryHandler(UpdateOwnedScopeProcedure, svc.UpdateOwnedScope, opts...))
+	mux.Handle(DeleteOwnedScopeProcedure, connect.NewUnaryHandler(DeleteOwnedScopeProcedure, svc.DeleteOwnedScope, opts...))
+	mux.Handle(GetCommentDetailsProcedure, connect.NewUnaryHandler(GetCommentDetailsProcedure, svc.GetCommentDetails, opts...))
+	mux.Handle(AddReactionProcedure, connect.NewUnaryHandler(AddReactionProcedure, svc.AddReaction, opts...))
+	mux.Handle(RemoveReactionProcedure, connect.NewUnaryHandler(RemoveReactionProcedure, svc.RemoveReaction, opts...))
+	mux.Handle(WatchCommentsProcedure, connect.NewServerStreamHandler(WatchCommentsProcedure, svc.WatchComments, opts...))
+	mux.Handle(CreateWebhookProcedure, connect.NewUnaryHandler(CreateWebhookProcedure, svc.CreateWebhook, opts...))
+	mux.Handle(ListWebhooksProcedure, connect.NewUnaryHandler(ListWebhooksProcedure, svc.ListWebhooks, opts...))
+	mux.Handle(DeleteWebhookProcedure, connect.NewUnaryHandler(DeleteWebhookProcedure, svc.DeleteWebhook, opts...))
+	mux.Handle(ListWebhookDeliveriesProcedure, connect.NewUnaryHandler(ListWebhookDeliveriesProcedure, svc.ListWebhookDeliveries, opts...))
+	mux.Handle(RetryWebhookDeliveryProcedure, connect.NewUnaryHandler(RetryWebhookDeliveryProcedure, svc.RetryWebhookDelivery, opts...))
+	mux.Handle(GetScopeSettingsProcedure, connect.NewUnaryHandler(GetScopeSettingsProcedure, svc.GetScopeSettings, opts...))
+	mux.Handle(UpdateScopeSettingsProcedure, connect.NewUnaryHandler(UpdateScopeSettingsProcedure, svc.UpdateScopeSettings, opts...))
+	mux.Handle(ExportScopeProcedure, connect.NewServerStreamHandler(ExportScopeProcedure, svc.ExportScope, opts...))
+	mux.Handle(ImportScopeProcedure, connect.NewClientStreamHandler(ImportScopeProcedure, svc.ImportScope, opts...))
+	mux.Handle(PreviewCommentProcedure, connect.NewUnaryHandler(PreviewCommentProcedure, svc.PreviewComment, opts...))
+
+	return "/" + ServiceName + "/", mux
+}
+
+// ExtensionServiceClient is a client for the extension service.
+type ExtensionServiceClient interface {
+	UpdateComment(context.Context, *connect.Request[UpdateCommentRequest]) (*connect.Response[UpdateCommentResponse], error)
+	ListCommentRevisions(context.Context, *connect.Request[ListCommentRevisionsRequest]) (*connect.Response[ListCommentRevisionsResponse], error)
+	DeleteComment(context.Context, *connect.Request[DeleteCommentRequest]) (*connect.Response[DeleteCommentResponse], error)
+	ListCommentThreads(context.Context, *connect.Request[ListCommentThreadsRequest]) (*connect.Response[ListCommentThreadsResponse], error)
+	SearchComments(context.Context, *connect.Request[SearchCommentsRequest]) (*connect.Response[SearchCommentsResponse], error)
+	ListOutboxEntries(context.Context, *connect.Request[ListOutboxEntriesRequest]) (*connect.Response[ListOutboxEntriesResponse], error)
+	RetryOutboxEntry(context.Context, *connect.Request[RetryOutboxEntryRequest]) (*connect.Response[RetryOutboxEntryResponse], error)
+	DiscardOutboxEntry(context.Context, *connect.Request[DiscardOutboxEntryRequest]) (*connect.Response[DiscardOutboxEntryResponse], error)
+	Subscribe(context.Context, *connect.Request[SubscribeRequest]) (*connect.Response[SubscribeResponse], error)
+	Mute(context.Context, *connect.Request[MuteRequest]) (*connect.Response[MuteResponse], error)
+	Unsubscribe(context.Context, *connect.Request[UnsubscribeRequest]) (*connect.Response[UnsubscribeResponse], error)
+	ListSubscriptions(context.Context, *connect.Request[ListSubscriptionsRequest]) (*connect.Response[ListSubscriptionsResponse], error)
+	GetScopeAccess(context.Context, *connect.Request[GetScopeAccessRequest]) (*connect.Response[GetScopeAccessResponse], error)
+	UpdateScopeAccess(context.Context, *connect.Request[UpdateScopeAccessRequest]) (*connect.Response[UpdateScopeAccessResponse], error)
+	ListReadableScopes(context.Context, *connect.Request[ListReadableScopesRequest]) (*connect.Response[ListReadableScopesResponse], error)
+	UpdateOwnedScope(context.Context, *connect.Request[UpdateOwnedScopeRequest]) (*connect.Response[UpdateOwnedScopeResponse], error)
+	DeleteOwnedScope(context.Context, *connect.Request[DeleteOwnedScopeRequest]) (*connect.Response[DeleteOwnedScopeResponse], error)
+	GetCommentDetails(context.Context, *connect.Request[GetCommentDetailsRequest]) (*connect.Response[GetCommentDetailsResponse], error)
+	AddReaction(context.Context, *connect.Request[AddReactionRequest]) (*connect.Response[AddReactionResponse], error)
+	RemoveReaction(context.Context, *connect.Request[RemoveReactionRequest]) (*connect.Response[RemoveReactionResponse], error)
+	WatchComments(context.Context, *connect.Request[WatchCommentsRequest]) (*connect.ServerStreamForClient[CommentEvent], error)
+	CreateWebhook(context.Context, *connect.Request[CreateWebhookRequest]) (*connect.Response[CreateWebhookResponse], error)
+	ListWebhooks(context.Context, *connect.Request[ListWebhooksRequest]) (*connect.Response[ListWebhooksResponse], error)
+	DeleteWebhook(context.Context, *connect.Request[DeleteWebhookRequest]) (*connect.Response[DeleteWebhookResponse], error)
+	ListWebhookDeliveries(context.Context, *connect.Request[ListWebhookDeliveriesRequest]) (*connect.Response[ListWebhookDeliveriesResponse], error)
+	RetryWebhookDelivery(context.Context, *connect.Request[RetryWebhookDeliveryRequest]) (*connect.Response[RetryWebhookDeliveryResponse], error)
+	GetScopeSettings(context.Context, *connect.Request[GetScopeSettingsRequest]) (*connect.Response[GetScopeSettingsResponse], error)
+	UpdateScopeSettings(context.Context, *connect.Request[UpdateScopeSettingsRequest]) (*connect.Response[UpdateScopeSettingsResponse], error)
+	ExportScope(ctx context.Context, req *connect.Request[ExportScopeRequest]) (*connect.ServerStreamForClient[ArchiveRecord], error)
+	ImportScope(ctx context.Context) *connect.ClientStreamForClient[ImportScopeRequest, ImportScopeResponse]
+	PreviewComment(context.Context, *connect.Request[PreviewCommentRequest]) (*connect.Response[PreviewCommentResponse], error)
+}
+
+// NewExtensionServiceClient returns a new client for the extension service
+// running at baseURL.
+func NewExtensionServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) ExtensionServiceClient {
+	opts = append([]connect.ClientOption{connect.WithCodec(jsonCodec{})}, opts...)
+
+	return &extensionServiceClient{
+		updateComment:         connect.NewClient[UpdateCommentRequest, UpdateCommentResponse](httpClient, baseURL+UpdateCommentProcedure, opts...),
+		listCommentRevisions:  connect.NewClient[ListCommentRevisionsRequest, ListCommentRevisionsResponse](httpClient, baseURL+ListCommentRevisionsProcedure, opts...),
+		deleteComment:         connect.NewClient[DeleteCommentRequest, DeleteCommentResponse](httpClient, baseURL+DeleteCommentProcedure, opts...),
+		listCommentThreads:    connect.NewClient[ListCommentThreadsRequest, ListCommentThreadsResponse](httpClient, baseURL+ListCommentThreadsProcedure, opts...),
+		searchComments:        connect.NewClient[SearchCommentsRequest, SearchCommentsResponse](httpClient, baseURL+SearchCommentsProcedure, opts...),
+		listOutboxEntries:     connect.NewClient[ListOutboxEntriesRequest, ListOutboxEntriesResponse](httpClient, baseURL+ListOutboxEntriesProcedure, opts...),
+		retryOutboxEntry:      connect.NewClient[RetryOutboxEntryRequest, RetryOutboxEntryResponse](httpClient, baseURL+RetryOutboxEntryProcedure, opts...),
+		discardOutboxEntry:    connect.NewClient[DiscardOutboxEntryRequest, DiscardOutboxEntryResponse](httpClient, baseURL+DiscardOutboxEntryProcedure, opts...),
+		subscribe:             connect.NewClient[SubscribeRequest, SubscribeResponse](httpClient, baseURL+SubscribeProcedure, opts...),
+		mute:                  connect.NewClient[MuteRequest, MuteResponse](httpClient, baseURL+MuteProcedure, opts...),
+		unsubscribe:           connect.NewClient[UnsubscribeRequest, UnsubscribeResponse](httpClient, baseURL+UnsubscribeProcedure, opts...),
+		listSubscriptions:     connect.NewClient[ListSubscriptionsRequest, ListSubscriptionsResponse](httpClient, baseURL+ListSubscriptionsProcedure, opts...),
+		getScopeAccess:        connect.NewClient[GetScopeAccessRequest, GetScopeAccessResponse](httpClient, baseURL+GetScopeAccessProcedure, opts...),
+		updateScopeAccess:     connect.NewClient[UpdateScopeAccessRequest, UpdateScopeAccessResponse](httpClient, baseURL+UpdateScopeAccessProcedure, opts...),
+		listReadableScopes:    connect.NewClient[ListReadableScopesRequest, ListReadableScopesResponse](httpClient, baseURL+ListReadableScopesProcedure, opts...),
+		updateOwnedScope:      connect.NewClient[UpdateOwnedScopeRequest, UpdateOwnedScopeResponse](httpClient, baseURL+UpdateOwnedScopeProcedure, opts...),
+		deleteOwnedScope:      connect.NewClient[DeleteOwnedScopeRequest, DeleteOwnedScopeResponse](httpClient, baseURL+DeleteOwnedScopeProcedure, opts...),
+		getCommentDetails:     connect.NewClient[GetCommentDetailsRequest, GetCommentDetailsResponse](httpClient, baseURL+GetCommentDetailsProcedure, opts...),
+		addReaction:           connect.NewClient[AddReactionRequest, AddReactionResponse](httpClient, baseURL+AddReactionProcedure, opts...),
+		removeReaction:        connect.NewClient[RemoveReactionRequest, RemoveReactionResponse](httpClient, baseURL+RemoveReactionProcedure, opts...),
+		watchComments:         connect.NewClient[WatchCommentsRequest, CommentEvent](httpClient, baseURL+WatchCommentsProcedure, opts...),
+		createWebhook:         connect.NewClient[CreateWebhookRequest, CreateWebhookResponse](httpClient, baseURL+CreateWebhookProcedure, opts...),
+		listWebhooks:          connect.NewClient[ListWebhooksRequest, ListWebhooksResponse](httpClient, baseURL+ListWebhooksProcedure, opts...),
+		deleteWebhook:         connect.NewClient[DeleteWebhookRequest, DeleteWebhookResponse](httpClient, baseURL+DeleteWebhookProcedure, opts...),
+		listWebhookDeliveries: connect.NewClient[ListWebhookDeliveriesRequest, ListWebhookDeliveriesResponse](httpClient, baseURL+ListWebhookDeliveriesProcedure, opts...),
+		retryWebhookDelivery:  connect.NewClient[RetryWebhookDeliveryRequest, RetryWebhookDeliveryResponse](httpClient, baseURL+RetryWebhookDeliveryProcedure, opts...),
+		getScopeSettings:      connect.NewClient[GetScopeSettingsRequest, GetScopeSettingsResponse](httpClient, baseURL+GetScopeSettingsProcedure, opts...),
+		updateScopeSettings:   connect.NewClient[UpdateScopeSettingsRequest, UpdateScopeSettingsResponse](httpClient, baseURL+UpdateScopeSettingsProcedure, opts...),
+		exportScope:           connect.NewClient[ExportScopeRequest, ArchiveRecord](httpClient, baseURL+ExportScopeProcedure, opts...),
+		importScope:           connect.NewClient[ImportScopeRequest, ImportScopeResponse](httpClient, baseURL+ImportScopeProcedure, opts...),
+		previewComment:        connect.NewClient[PreviewCommentRequest, PreviewCommentResponse](httpClient, baseURL+PreviewCommentProcedure, opts...),
+	}
+}
+
+type extensionServiceClient struct {
+	updateComment         *connect.Client[UpdateCommentRequest, UpdateCommentResponse]
+	listCommentRevisions  *connect.Client[ListCommentRevisionsRequest, ListCommentRevisionsResponse]
+	deleteComment         *connect.Client[DeleteCommentRequest, DeleteCommentResponse]
+	listCommentThreads    *connect.Client[ListCommentThreadsRequest, ListCommentThreadsResponse]
+	searchComments        *connect.Client[SearchCommentsRequest, SearchCommentsResponse]
+	listOutboxEntries     *connect.Client[ListOutboxEntriesRequest, ListOutboxEntriesResponse]
+	retryOutboxEntry      *connect.Client[RetryOutboxEntryRequest, RetryOutboxEntryResponse]
+	discardOutboxEntry    *connect.Client[DiscardOutboxEntryRequest, DiscardOutboxEntryResponse]
+	subscribe             *connect.Client[SubscribeRequest, SubscribeResponse]
+	mute                  *connect.Client[MuteRequest, MuteResponse]
+	unsubscribe           *connect.Client[UnsubscribeRequest, UnsubscribeResponse]
+	listSubscriptions     *connect.Client[ListSubscriptionsRequest, ListSubscriptionsResponse]
+	getScopeAccess        *connect.Client[GetScopeAccessRequest, GetScopeAccessResponse]
+	updateScopeAccess     *connect.Client[UpdateScopeAccessRequest, UpdateScopeAccessResponse]
+	listReadableScopes    *connect.Client[ListReadableScopesRequest, ListReadableScopesResponse]
+	updateOwnedScope      *connect.Client[UpdateOwnedScopeRequest, UpdateOwnedScopeResponse]
+	deleteOwnedScope      *connect.Client[DeleteOwnedScopeRequest, DeleteOwnedScopeResponse]
+	getCommentDetails     *connect.Client[GetCommentDetailsRequest, GetCommentDetailsResponse]
+	addReaction           *connect.Client[AddReactionRequest, AddReactionResponse]
+	removeReaction        *connect.Client[RemoveReactionRequest, RemoveReactionResponse]
+	watchComments         *connect.Client[WatchCommentsRequest, CommentEvent]
+	createWebhook         *connect.Client[CreateWebhookRequest, CreateWebhookResponse]
+	listWebhooks          *connect.Client[ListWebhooksRequest, ListWebhooksResponse]
+	deleteWebhook         *connect.Client[DeleteWebhookRequest, DeleteWebhookResponse]
+	listWebhookDeliveries *connect.Client[ListWebhookDeliveriesRequest, ListWebhookDeliveriesResponse]
+	retryWebhookDelivery  *connect.Client[RetryWebhookDeliveryRequest, RetryWebhookDeliveryResponse]
+	getScopeSettings      *connect.Client[GetScopeSettingsRequest, GetScopeSettingsResponse]
+	updateScopeSettings   *connect.Client[UpdateScopeSettingsRequest, UpdateScopeSettingsResponse]
+	exportScope           *connect.Client[ExportScopeRequest, ArchiveRecord]
+	importScope           *connect.Client[ImportScopeRequest, ImportScopeResponse]
+	previewComment        *connect.Client[PreviewCommentRequest, PreviewCommentResponse]
+}
+
+func (c *extensionServiceClient) UpdateComment(ctx context.Context, req *connect.Request[UpdateCommentRequest]) (*connect.Response[UpdateCommentResponse], error) {
+	return c.updateComment.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ListCommentRevisions(ctx context.Context, req *connect.Request[ListCommentRevisionsRequest]) (*connect.Response[ListCommentRevisionsResponse], error) {
+	return c.listCommentRevisions.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) DeleteComment(ctx context.Context, req *connect.Request[DeleteCommentRequest]) (*connect.Response[DeleteCommentResponse], error) {
+	return c.deleteComment.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ListCommentThreads(ctx context.Context, req *connect.Request[ListCommentThreadsRequest]) (*connect.Response[ListCommentThreadsResponse], error) {
+	return c.listCommentThreads.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) SearchComments(ctx context.Context, req *connect.Request[SearchCommentsRequest]) (*connect.Response[SearchCommentsResponse], error) {
+	return c.searchComments.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ListOutboxEntries(ctx context.Context, req *connect.Request[ListOutboxEntriesRequest]) (*connect.Response[ListOutboxEntriesResponse], error) {
+	return c.listOutboxEntries.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) RetryOutboxEntry(ctx context.Context, req *connect.Request[RetryOutboxEntryRequest]) (*connect.Response[RetryOutboxEntryResponse], error) {
+	return c.retryOutboxEntry.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) DiscardOutboxEntry(ctx context.Context, req *connect.Request[DiscardOutboxEntryRequest]) (*connect.Response[DiscardOutboxEntryResponse], error) {
+	return c.discardOutboxEntry.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) Subscribe(ctx context.Context, req *connect.Request[SubscribeRequest]) (*connect.Response[SubscribeResponse], error) {
+	return c.subscribe.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) Mute(ctx context.Context, req *connect.Request[MuteRequest]) (*connect.Response[MuteResponse], error) {
+	return c.mute.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) Unsubscribe(ctx context.Context, req *connect.Request[UnsubscribeRequest]) (*connect.Response[UnsubscribeResponse], error) {
+	return c.unsubscribe.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ListSubscriptions(ctx context.Context, req *connect.Request[ListSubscriptionsRequest]) (*connect.Response[ListSubscriptionsResponse], error) {
+	return c.listSubscriptions.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) GetScopeAccess(ctx context.Context, req *connect.Request[GetScopeAccessRequest]) (*connect.Response[GetScopeAccessResponse], error) {
+	return c.getScopeAccess.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) UpdateScopeAccess(ctx context.Context, req *connect.Request[UpdateScopeAccessRequest]) (*connect.Response[UpdateScopeAccessResponse], error) {
+	return c.updateScopeAccess.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ListReadableScopes(ctx context.Context, req *connect.Request[ListReadableScopesRequest]) (*connect.Response[ListReadableScopesResponse], error) {
+	return c.listReadableScopes.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) UpdateOwnedScope(ctx context.Context, req *connect.Request[UpdateOwnedScopeRequest]) (*connect.Response[UpdateOwnedScopeResponse], error) {
+	return c.updateOwnedScope.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) DeleteOwnedScope(ctx context.Context, req *connect.Request[DeleteOwnedScopeRequest]) (*connect.Response[DeleteOwnedScopeResponse], error) {
+	return c.deleteOwnedScope.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) GetCommentDetails(ctx context.Context, req *connect.Request[GetCommentDetailsRequest]) (*connect.Response[GetCommentDetailsResponse], error) {
+	return c.getCommentDetails.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) AddReaction(ctx context.Context, req *connect.Request[AddReactionRequest]) (*connect.Response[AddReactionResponse], error) {
+	return c.addReaction.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) RemoveReaction(ctx context.Context, req *connect.Request[RemoveReactionRequest]) (*connect.Response[RemoveReactionResponse], error) {
+	return c.removeReaction.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) WatchComments(ctx context.Context, req *connect.Request[WatchCommentsRequest]) (*connect.ServerStreamForClient[CommentEvent], error) {
+	return c.watchComments.CallServerStream(ctx, req)
+}
+
+func (c *extensionServiceClient) CreateWebhook(ctx context.Context, req *connect.Request[CreateWebhookRequest]) (*connect.Response[CreateWebhookResponse], error) {
+	return c.createWebhook.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ListWebhooks(ctx context.Context, req *connect.Request[ListWebhooksRequest]) (*connect.Response[ListWebhooksResponse], error) {
+	return c.listWebhooks.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) DeleteWebhook(ctx context.Context, req *connect.Request[DeleteWebhookRequest]) (*connect.Response[DeleteWebhookResponse], error) {
+	return c.deleteWebhook.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ListWebhookDeliveries(ctx context.Context, req *connect.Request[ListWebhookDeliveriesRequest]) (*connect.Response[ListWebhookDeliveriesResponse], error) {
+	return c.listWebhookDeliveries.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) RetryWebhookDelivery(ctx context.Context, req *connect.Request[RetryWebhookDeliveryRequest]) (*connect.Response[RetryWebhookDeliveryResponse], error) {
+	return c.retryWebhookDelivery.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) GetScopeSettings(ctx context.Context, req *connect.Request[GetScopeSettingsRequest]) (*connect.Response[GetScopeSettingsResponse], error) {
+	return c.getScopeSettings.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) UpdateScopeSettings(ctx context.Context, req *connect.Request[UpdateScopeSettingsRequest]) (*connect.Response[UpdateScopeSettingsResponse], error) {
+	return c.updateScopeSettings.CallUnary(ctx, req)
+}
+
+func (c *extensionServiceClient) ExportScope(ctx context.Context, req *connect.Request[ExportScopeRequest]) (*connect.ServerStreamForClient[ArchiveRecord], error) {
+	return c.exportScope.CallServerStream(ctx, req)
+}
+
+func (c *extensionServiceClient) ImportScope(ctx context.Context) *connect.ClientStreamForClient[ImportScopeRequest, ImportScopeResponse] {
+	return c.importScope.CallClientStream(ctx)
+}
+
+func (c *extensionServiceClient) PreviewComment(ctx context.Context, req *connect.Request[PreviewCommentRequest]) (*connect.Response[PreviewCommentResponse], error) {
+	return c.previewComment.CallUnary(ctx, req)
+}
+
+// UnimplementedExtensionServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedExtensionServiceHandler struct{}
+
+func (UnimplementedExtensionServiceHandler) UpdateComment(context.Context, *connect.Request[UpdateCommentRequest]) (*connect.Response[UpdateCommentResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(UpdateCommentProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ListCommentRevisions(context.Context, *connect.Request[ListCommentRevisionsRequest]) (*connect.Response[ListCommentRevisionsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ListCommentRevisionsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) DeleteComment(context.Context, *connect.Request[DeleteCommentRequest]) (*connect.Response[DeleteCommentResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(DeleteCommentProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ListCommentThreads(context.Context, *connect.Request[ListCommentThreadsRequest]) (*connect.Response[ListCommentThreadsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ListCommentThreadsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) SearchComments(context.Context, *connect.Request[SearchCommentsRequest]) (*connect.Response[SearchCommentsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(SearchCommentsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ListOutboxEntries(context.Context, *connect.Request[ListOutboxEntriesRequest]) (*connect.Response[ListOutboxEntriesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ListOutboxEntriesProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) RetryOutboxEntry(context.Context, *connect.Request[RetryOutboxEntryRequest]) (*connect.Response[RetryOutboxEntryResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(RetryOutboxEntryProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) DiscardOutboxEntry(context.Context, *connect.Request[DiscardOutboxEntryRequest]) (*connect.Response[DiscardOutboxEntryResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(DiscardOutboxEntryProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) Subscribe(context.Context, *connect.Request[SubscribeRequest]) (*connect.Response[SubscribeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(SubscribeProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) Mute(context.Context, *connect.Request[MuteRequest]) (*connect.Response[MuteResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(MuteProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) Unsubscribe(context.Context, *connect.Request[UnsubscribeRequest]) (*connect.Response[UnsubscribeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(UnsubscribeProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ListSubscriptions(context.Context, *connect.Request[ListSubscriptionsRequest]) (*connect.Response[ListSubscriptionsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ListSubscriptionsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) GetScopeAccess(context.Context, *connect.Request[GetScopeAccessRequest]) (*connect.Response[GetScopeAccessResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(GetScopeAccessProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) UpdateScopeAccess(context.Context, *connect.Request[UpdateScopeAccessRequest]) (*connect.Response[UpdateScopeAccessResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(UpdateScopeAccessProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ListReadableScopes(context.Context, *connect.Request[ListReadableScopesRequest]) (*connect.Response[ListReadableScopesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ListReadableScopesProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) UpdateOwnedScope(context.Context, *connect.Request[UpdateOwnedScopeRequest]) (*connect.Response[UpdateOwnedScopeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(UpdateOwnedScopeProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) DeleteOwnedScope(context.Context, *connect.Request[DeleteOwnedScopeRequest]) (*connect.Response[DeleteOwnedScopeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(DeleteOwnedScopeProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) GetCommentDetails(context.Context, *connect.Request[GetCommentDetailsRequest]) (*connect.Response[GetCommentDetailsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(GetCommentDetailsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) AddReaction(context.Context, *connect.Request[AddReactionRequest]) (*connect.Response[AddReactionResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(AddReactionProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) RemoveReaction(context.Context, *connect.Request[RemoveReactionRequest]) (*connect.Response[RemoveReactionResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(RemoveReactionProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) WatchComments(context.Context, *connect.Request[WatchCommentsRequest], *connect.ServerStream[CommentEvent]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New(WatchCommentsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) CreateWebhook(context.Context, *connect.Request[CreateWebhookRequest]) (*connect.Response[CreateWebhookResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(CreateWebhookProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ListWebhooks(context.Context, *connect.Request[ListWebhooksRequest]) (*connect.Response[ListWebhooksResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ListWebhooksProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) DeleteWebhook(context.Context, *connect.Request[DeleteWebhookRequest]) (*connect.Response[DeleteWebhookResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(DeleteWebhookProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ListWebhookDeliveries(context.Context, *connect.Request[ListWebhookDeliveriesRequest]) (*connect.Response[ListWebhookDeliveriesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ListWebhookDeliveriesProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) RetryWebhookDelivery(context.Context, *connect.Request[RetryWebhookDeliveryRequest]) (*connect.Response[RetryWebhookDeliveryResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(RetryWebhookDeliveryProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) GetScopeSettings(context.Context, *connect.Request[GetScopeSettingsRequest]) (*connect.Response[GetScopeSettingsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(GetScopeSettingsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) UpdateScopeSettings(context.Context, *connect.Request[UpdateScopeSettingsRequest]) (*connect.Response[UpdateScopeSettingsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(UpdateScopeSettingsProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ExportScope(context.Context, *connect.Request[ExportScopeRequest], *connect.ServerStream[ArchiveRecord]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New(ExportScopeProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) ImportScope(context.Context, *connect.ClientStream[ImportScopeRequest]) (*connect.Response[ImportScopeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(ImportScopeProcedure+" is not implemented"))
+}
+
+func (UnimplementedExtensionServiceHandler) PreviewComment(context.Context, *connect.Request[PreviewCommentRequest]) (*connect.Response[PreviewCommentResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New(PreviewCommentProcedure+" is not implemented"))
+}
+
+var _ ExtensionServiceHandler = UnimplementedExtensionServiceHandler{}
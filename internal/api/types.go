@@ -0,0 +1,626 @@
+package api
+
+import "time"
+
+type (
+	// Comment is the JSON representation of a comment used by the extension
+	// service. In contrast to commentv1.Comment it also carries editing
+	// metadata.
+	Comment struct {
+		ID            string     `json:"id"`
+		Scope         string     `json:"scope"`
+		Reference     string     `json:"reference,omitempty"`
+		ParentID      string     `json:"parentId,omitempty"`
+		Content       string     `json:"content"`
+		CreatedAt     time.Time  `json:"createdAt"`
+		CreatorID     string     `json:"creatorId"`
+		Edited        bool       `json:"edited"`
+		RevisionCount int        `json:"revisionCount"`
+		UpdatedAt     *time.Time `json:"updatedAt,omitempty"`
+		Deleted       bool       `json:"deleted,omitempty"`
+		DeletedAt     *time.Time `json:"deletedAt,omitempty"`
+		DeletedBy     string     `json:"deletedBy,omitempty"`
+		Reactions     []Reaction `json:"reactions,omitempty"`
+		// Mentions holds the IDs of all users mentioned in Content.
+		Mentions []string `json:"mentions,omitempty"`
+		// MentionedUsers holds the profiles of the users in Mentions. It is
+		// only set by GetCommentDetails; commentv1.Comment, as returned by
+		// the GetComment method of the CommentService, has no field for
+		// mentions. Users that no longer exist only have the ID set.
+		MentionedUsers []MentionedUser `json:"mentionedUsers,omitempty"`
+	}
+
+	// Reaction summarizes all reactions with the same emoji on a comment.
+	Reaction struct {
+		// Emoji is the shortcode of the emoji without colons, like "+1".
+		Emoji   string   `json:"emoji"`
+		Count   int      `json:"count"`
+		UserIDs []string `json:"userIds"`
+		// Reacted is true if the calling user is one of UserIDs.
+		Reacted bool `json:"reacted"`
+	}
+
+	// CommentTree is a comment together with all answers.
+	CommentTree struct {
+		Comment Comment       `json:"comment"`
+		Answers []CommentTree `json:"answers,omitempty"`
+	}
+
+	// CommentRevision is a previous version of a comment's content.
+	CommentRevision struct {
+		Content string `json:"content"`
+		// EditedAt is the time at which this version has been replaced.
+		EditedAt time.Time `json:"editedAt"`
+		// EditorID is the ID of the user that replaced this version.
+		EditorID string `json:"editorId"`
+	}
+)
+
+// Comment Editing
+
+type (
+	UpdateCommentRequest struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	}
+
+	UpdateCommentResponse struct {
+		Comment Comment `json:"comment"`
+	}
+
+	ListCommentRevisionsRequest struct {
+		ID string `json:"id"`
+	}
+
+	ListCommentRevisionsResponse struct {
+		Comment   Comment           `json:"comment"`
+		Revisions []CommentRevision `json:"revisions"`
+	}
+)
+
+// Comment Deletion
+
+type (
+	DeleteCommentRequest struct {
+		ID string `json:"id"`
+		// Purge removes the comment and all answers from the database
+		// instead of replacing the content with a tombstone. Only
+		// administrators may purge comments.
+		Purge bool `json:"purge,omitempty"`
+	}
+
+	DeleteCommentResponse struct {
+		// Comment is the soft-deleted comment. It is nil if the comment
+		// has been purged.
+		Comment *Comment `json:"comment,omitempty"`
+		// PurgedCount holds the number of comments that have been
+		// removed when Purge was set.
+		PurgedCount int64 `json:"purgedCount,omitempty"`
+	}
+)
+
+// Comment Listing
+
+type (
+	ListCommentThreadsRequest struct {
+		Scope      string `json:"scope"`
+		Reference  string `json:"reference,omitempty"`
+		Recurse    bool   `json:"recurse,omitempty"`
+		RenderHTML bool   `json:"renderHtml,omitempty"`
+
+		// PageSize is the maximum number of root comments to return.
+		// Defaults to 25, the maximum is 100.
+		PageSize int `json:"pageSize,omitempty"`
+		// PageToken is the NextPageToken of a previous response.
+		PageToken string `json:"pageToken,omitempty"`
+		// Order is either "asc" (default) or "desc" and sorts root comments
+		// by their creation time.
+		Order string `json:"order,omitempty"`
+	}
+
+	ListCommentThreadsResponse struct {
+		Threads       []CommentTree `json:"threads"`
+		NextPageToken string        `json:"nextPageToken,omitempty"`
+	}
+)
+
+// Single Comments
+
+type (
+	GetCommentDetailsRequest struct {
+		ID         string `json:"id"`
+		Recurse    bool   `json:"recurse,omitempty"`
+		RenderHTML bool   `json:"renderHtml,omitempty"`
+	}
+
+	GetCommentDetailsResponse struct {
+		Result CommentTree `json:"result"`
+	}
+)
+
+// Comment Preview
+
+type (
+	// PreviewCommentRequest renders Content as it would be rendered for a
+	// new comment in Scope. Nothing is stored and no notifications are
+	// sent.
+	PreviewCommentRequest struct {
+		Scope   string `json:"scope"`
+		Content string `json:"content"`
+	}
+
+	PreviewCommentResponse struct {
+		// HTML is the sanitized HTML of the comment.
+		HTML string `json:"html"`
+
+		// Mentions holds all users mentioned in the comment.
+		Mentions []MentionedUser `json:"mentions,omitempty"`
+
+		// GroupMentions holds all roles and special groups (owners, thread)
+		// mentioned in the comment.
+		GroupMentions []MentionedGroup `json:"groupMentions,omitempty"`
+
+		// Warnings lists problems of the content. Warnings with Fatal set
+		// cause the comment to be rejected when it is created.
+		Warnings []PreviewWarning `json:"warnings,omitempty"`
+	}
+
+	MentionedUser struct {
+		ID          string `json:"id"`
+		Username    string `json:"username"`
+		DisplayName string `json:"displayName,omitempty"`
+	}
+
+	MentionedGroup struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	PreviewWarning struct {
+		// Code identifies the kind of warning, like "unresolved_mention".
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Fatal   bool   `json:"fatal,omitempty"`
+	}
+)
+
+// Comment Search
+
+type (
+	SearchCommentsRequest struct {
+		// Query is the full-text search query. Phrases may be quoted and
+		// terms may be excluded by prefixing them with a minus.
+		Query string `json:"query"`
+
+		Scope         string     `json:"scope,omitempty"`
+		Reference     string     `json:"reference,omitempty"`
+		CreatorID     string     `json:"creatorId,omitempty"`
+		CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
+		CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+
+		PageSize  int    `json:"pageSize,omitempty"`
+		PageToken string `json:"pageToken,omitempty"`
+	}
+
+	SearchResult struct {
+		Comment Comment `json:"comment"`
+		Score   float64 `json:"score"`
+		// RootID is the ID of the thread's root comment. Use
+		// GetComment(recurse=true) to load the whole conversation.
+		RootID string `json:"rootId"`
+		// Snippet is an HTML-escaped excerpt of the comment content with
+		// all matching terms wrapped in <mark> elements.
+		Snippet string `json:"snippet"`
+	}
+
+	SearchCommentsResponse struct {
+		Results       []SearchResult `json:"results"`
+		NextPageToken string         `json:"nextPageToken,omitempty"`
+	}
+)
+
+// Notification Outbox
+
+type (
+	OutboxEntry struct {
+		ID            string    `json:"id"`
+		CommentID     string    `json:"commentId"`
+		State         string    `json:"state"`
+		Attempts      int       `json:"attempts"`
+		NextAttemptAt time.Time `json:"nextAttemptAt"`
+		LastError     string    `json:"lastError,omitempty"`
+		DeliveredTo   []string  `json:"deliveredTo,omitempty"`
+		CreatedAt     time.Time `json:"createdAt"`
+		UpdatedAt     time.Time `json:"updatedAt"`
+	}
+
+	ListOutboxEntriesRequest struct {
+		// State filters entries by state (pending, delivered, failed or
+		// discarded). Defaults to failed.
+		State string `json:"state,omitempty"`
+	}
+
+	ListOutboxEntriesResponse struct {
+		Entries []OutboxEntry `json:"entries"`
+	}
+
+	RetryOutboxEntryRequest struct {
+		ID string `json:"id"`
+	}
+
+	RetryOutboxEntryResponse struct {
+		Entry OutboxEntry `json:"entry"`
+	}
+
+	DiscardOutboxEntryRequest struct {
+		ID string `json:"id"`
+	}
+
+	DiscardOutboxEntryResponse struct {
+		Entry OutboxEntry `json:"entry"`
+	}
+)
+
+// Subscriptions
+
+type (
+	// SubscriptionTarget is either a comment thread or a scope with an
+	// optional reference. If ThreadID is set, Scope and Reference are
+	// ignored in requests. ThreadID may be the ID of any comment in the
+	// thread.
+	SubscriptionTarget struct {
+		ThreadID  string `json:"threadId,omitempty"`
+		Scope     string `json:"scope,omitempty"`
+		Reference string `json:"reference,omitempty"`
+	}
+
+	Subscription struct {
+		Target SubscriptionTarget `json:"target"`
+		// State is either "subscribed" or "muted".
+		State     string    `json:"state"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+
+	SubscribeRequest struct {
+		Target SubscriptionTarget `json:"target"`
+	}
+
+	SubscribeResponse struct {
+		Subscription Subscription `json:"subscription"`
+	}
+
+	MuteRequest struct {
+		Target SubscriptionTarget `json:"target"`
+	}
+
+	MuteResponse struct {
+		Subscription Subscription `json:"subscription"`
+	}
+
+	UnsubscribeRequest struct {
+		Target SubscriptionTarget `json:"target"`
+	}
+
+	UnsubscribeResponse struct{}
+
+	ListSubscriptionsRequest struct{}
+
+	ListSubscriptionsResponse struct {
+		Subscriptions []Subscription `json:"subscriptions"`
+	}
+)
+
+type (
+	// Scope describes a comment scope. NotificationType is either empty,
+	// "sms" or "email".
+	Scope struct {
+		ID               string   `json:"id"`
+		Name             string   `json:"name"`
+		NotificationType string   `json:"notificationType,omitempty"`
+		ViewURLTemplate  string   `json:"viewUrlTemplate,omitempty"`
+		OwnerIDs         []string `json:"ownerIds,omitempty"`
+	}
+
+	// ListReadableScopesRequest lists all scopes the calling user may read
+	// comments of.
+	ListReadableScopesRequest struct{}
+
+	ListReadableScopesResponse struct {
+		Scopes []Scope `json:"scopes"`
+	}
+
+	// UpdateOwnedScopeRequest updates a scope. It is allowed for scope owners
+	// and administrators. Paths selects the fields to update, valid paths are
+	// "name", "notificationType", "viewUrlTemplate", "addOwnerIds" and
+	// "removeOwnerIds". All fields are updated if Paths is empty.
+	UpdateOwnedScopeRequest struct {
+		ID               string   `json:"id"`
+		Paths            []string `json:"paths,omitempty"`
+		Name             string   `json:"name,omitempty"`
+		NotificationType string   `json:"notificationType,omitempty"`
+		ViewURLTemplate  string   `json:"viewUrlTemplate,omitempty"`
+		AddOwnerIDs      []string `json:"addOwnerIds,omitempty"`
+		RemoveOwnerIDs   []string `json:"removeOwnerIds,omitempty"`
+	}
+
+	UpdateOwnedScopeResponse struct {
+		Scope Scope `json:"scope"`
+	}
+
+	// DeleteOwnedScopeRequest deletes a scope and all of its comments. It is
+	// allowed for scope owners and administrators.
+	DeleteOwnedScopeRequest struct {
+		ID string `json:"id"`
+	}
+
+	DeleteOwnedScopeResponse struct{}
+)
+
+type (
+	// ScopeAccess describes which roles are allowed to read or write the
+	// comments of a scope. Roles may be specified by ID or name. Empty lists
+	// allow access for all authenticated users. Scope owners and
+	// administrators are always allowed.
+	ScopeAccess struct {
+		Scope       string   `json:"scope"`
+		ReaderRoles []string `json:"readerRoles"`
+		WriterRoles []string `json:"writerRoles"`
+	}
+
+	GetScopeAccessRequest struct {
+		Scope string `json:"scope"`
+	}
+
+	GetScopeAccessResponse struct {
+		Access ScopeAccess `json:"access"`
+	}
+
+	// UpdateScopeAccessRequest replaces the reader and writer roles of a
+	// scope.
+	UpdateScopeAccessRequest struct {
+		Access ScopeAccess `json:"access"`
+	}
+
+	UpdateScopeAccessResponse struct {
+		Access ScopeAccess `json:"access"`
+	}
+)
+
+// Reactions
+
+type (
+	AddReactionRequest struct {
+		CommentID string `json:"commentId"`
+		// Emoji is the shortcode of the emoji, with or without colons.
+		Emoji string `json:"emoji"`
+	}
+
+	AddReactionResponse struct {
+		Comment Comment `json:"comment"`
+	}
+
+	RemoveReactionRequest struct {
+		CommentID string `json:"commentId"`
+		Emoji     string `json:"emoji"`
+	}
+
+	RemoveReactionResponse struct {
+		Comment Comment `json:"comment"`
+	}
+)
+
+// Comment Events
+
+type (
+	WatchCommentsRequest struct {
+		Scope string `json:"scope"`
+		// Reference optionally restricts events to a single reference
+		// within Scope.
+		Reference string `json:"reference,omitempty"`
+	}
+
+	// CommentEvent is streamed by WatchComments whenever a comment has
+	// been created, edited or deleted.
+	CommentEvent struct {
+		// Type is either "created", "edited" or "deleted".
+		Type    string  `json:"type"`
+		Comment Comment `json:"comment"`
+	}
+)
+
+// Webhooks
+
+type (
+	Webhook struct {
+		ID    string `json:"id"`
+		Scope string `json:"scope"`
+		URL   string `json:"url"`
+		// Secret is only returned when the webhook is created.
+		Secret    string    `json:"secret,omitempty"`
+		Events    []string  `json:"events,omitempty"`
+		CreatedAt time.Time `json:"createdAt"`
+		CreatorID string    `json:"creatorId"`
+	}
+
+	// WebhookPayload is the JSON body sent to webhooks. The body is signed
+	// using HMAC-SHA256 with the webhook secret and the hex encoded
+	// signature is sent in the X-Comment-Signature-256 header, prefixed with
+	// "sha256=".
+	WebhookPayload struct {
+		// DeliveryID is unique per delivery and stays the same for retries.
+		DeliveryID string    `json:"deliveryId"`
+		WebhookID  string    `json:"webhookId"`
+		Event      string    `json:"event"`
+		Scope      string    `json:"scope"`
+		Timestamp  time.Time `json:"timestamp"`
+		Comment    Comment   `json:"comment"`
+	}
+
+	WebhookDelivery struct {
+		ID             string    `json:"id"`
+		WebhookID      string    `json:"webhookId"`
+		Event          string    `json:"event"`
+		CommentID      string    `json:"commentId"`
+		State          string    `json:"state"`
+		Attempts       int       `json:"attempts"`
+		NextAttemptAt  time.Time `json:"nextAttemptAt"`
+		LastStatusCode int       `json:"lastStatusCode,omitempty"`
+		LastError      string    `json:"lastError,omitempty"`
+		CreatedAt      time.Time `json:"createdAt"`
+		UpdatedAt      time.Time `json:"updatedAt"`
+	}
+
+	CreateWebhookRequest struct {
+		Scope string `json:"scope"`
+		URL   string `json:"url"`
+		// Events restricts the webhook to "created", "edited" or
+		// "deleted" events. Defaults to all events.
+		Events []string `json:"events,omitempty"`
+		// Secret is generated if empty.
+		Secret string `json:"secret,omitempty"`
+	}
+
+	CreateWebhookResponse struct {
+		Webhook Webhook `json:"webhook"`
+	}
+
+	ListWebhooksRequest struct {
+		Scope string `json:"scope"`
+	}
+
+	ListWebhooksResponse struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+
+	DeleteWebhookRequest struct {
+		ID string `json:"id"`
+	}
+
+	DeleteWebhookResponse struct{}
+
+	ListWebhookDeliveriesRequest struct {
+		WebhookID string `json:"webhookId"`
+		// State optionally filters deliveries by state (pending,
+		// delivered or failed).
+		State string `json:"state,omitempty"`
+		// Limit is the maximum number of deliveries to return, newest
+		// first. Defaults to 25, the maximum is 100.
+		Limit int `json:"limit,omitempty"`
+	}
+
+	ListWebhookDeliveriesResponse struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+	}
+
+	RetryWebhookDeliveryRequest struct {
+		ID string `json:"id"`
+	}
+
+	RetryWebhookDeliveryResponse struct {
+		Delivery WebhookDelivery `json:"delivery"`
+	}
+)
+
+// Scope Settings
+
+type (
+	// ScopeSettings holds scope configuration that is not part of the
+	// commentv1.Scope message.
+	ScopeSettings struct {
+		Scope string `json:"scope"`
+		// HTMLPolicy is either empty (raw HTML is omitted), "allow" (raw
+		// HTML is sanitized and rendered) or "forbid" (comments containing
+		// raw HTML are rejected).
+		HTMLPolicy string `json:"htmlPolicy,omitempty"`
+	}
+
+	GetScopeSettingsRequest struct {
+		Scope string `json:"scope"`
+	}
+
+	GetScopeSettingsResponse struct {
+		Settings ScopeSettings `json:"settings"`
+	}
+
+	UpdateScopeSettingsRequest struct {
+		Settings ScopeSettings `json:"settings"`
+	}
+
+	UpdateScopeSettingsResponse struct {
+		Settings ScopeSettings `json:"settings"`
+	}
+)
+
+// Scope Archives
+
+type (
+	// ArchiveRecord is a single line of an NDJSON scope archive. The first
+	// record of an archive holds the scope definition, all following records
+	// hold one comment each. Parents are always written before their
+	// answers.
+	ArchiveRecord struct {
+		Scope   *ArchivedScope   `json:"scope,omitempty"`
+		Comment *ArchivedComment `json:"comment,omitempty"`
+	}
+
+	ArchivedScope struct {
+		ID               string   `json:"id"`
+		Name             string   `json:"name"`
+		NotificationType string   `json:"notificationType,omitempty"`
+		ViewURLTemplate  string   `json:"viewUrlTemplate,omitempty"`
+		OwnerIDs         []string `json:"ownerIds,omitempty"`
+		ReaderRoles      []string `json:"readerRoles,omitempty"`
+		WriterRoles      []string `json:"writerRoles,omitempty"`
+		HTMLPolicy       string   `json:"htmlPolicy,omitempty"`
+	}
+
+	// ArchivedComment holds a comment as it is stored. Revisions are not
+	// part of an archive.
+	ArchivedComment struct {
+		ID                string             `json:"_id"`
+		ParentID          string             `json:"parentId,omitempty"`
+		Reference         string             `json:"ref,omitempty"`
+		Content           string             `json:"content"`
+		CreatedAt         time.Time          `json:"createdAt"`
+		CreatorID         string             `json:"creatorId"`
+		UpdatedAt         *time.Time         `json:"updatedAt,omitempty"`
+		DeletedAt         *time.Time         `json:"deletedAt,omitempty"`
+		DeletedBy         string             `json:"deletedBy,omitempty"`
+		Reactions         []ArchivedReaction `json:"reactions,omitempty"`
+		Mentions          []string           `json:"mentions,omitempty"`
+		CanonicalMentions bool               `json:"canonicalMentions,omitempty"`
+	}
+
+	ArchivedReaction struct {
+		Emoji     string    `json:"emoji"`
+		UserID    string    `json:"userId"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	ExportScopeRequest struct {
+		Scope string `json:"scope"`
+	}
+
+	// ImportScopeRequest is sent once for each record of an archive. The
+	// import options are only read from the first message.
+	ImportScopeRequest struct {
+		// Scope imports the archive into a scope with this ID instead of
+		// the archived one.
+		Scope string `json:"scope,omitempty"`
+		// KeepIDs keeps the archived comment IDs. By default, all comments
+		// get new IDs.
+		KeepIDs bool `json:"keepIds,omitempty"`
+		// OnConflict is either empty (existing scopes and comments abort
+		// the import), "skip" or "overwrite". Comment IDs that are used in
+		// another scope always abort the import.
+		OnConflict string `json:"onConflict,omitempty"`
+
+		Record ArchiveRecord `json:"record"`
+	}
+
+	ImportScopeResponse struct {
+		Scope    string `json:"scope"`
+		Imported int    `json:"imported"`
+		Skipped  int    `json:"skipped"`
+	}
+)
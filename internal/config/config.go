@@ -11,6 +11,7 @@ import (
 
 	"github.com/ghodss/yaml"
 	"github.com/sethvargo/go-envconfig"
+	"github.com/tierklinik-dobersberg/comment-service/pkg/goldmark-extensions/mentions"
 )
 
 type Config struct {
@@ -18,8 +19,31 @@ type Config struct {
 	Database            string   `env:"DATABASE" json:"database"`
 	AllowedOrigins      []string `env:"ALLOWED_ORIGINS" json:"allowedOrigins"`
 	PublicListenAddress string   `env:"PUBLIC_LISTEN" json:"publicListen"`
+
+	// NotificationTemplates is an optional directory that contains
+	// notification templates overwriting the built-in defaults.
+	NotificationTemplates string `env:"NOTIFICATION_TEMPLATES" json:"notificationTemplates"`
+
+	// EventSource configures how comment events for WatchComments are
+	// collected. Either EventSourceLocal (default) or EventSourceChangeStream
+	// which is required if multiple replicas are deployed.
+	EventSource string `env:"EVENT_SOURCE" json:"eventSource"`
+
+	// UnresolvedMentions defines how @-mentions are handled that cannot
+	// be resolved to a user, role or group. Either "text" (default), "span"
+	// or "reject" to reject comments with unresolved mentions.
+	UnresolvedMentions string `env:"UNRESOLVED_MENTIONS" json:"unresolvedMentions"`
+
+	// SkipMigrations disables applying database migrations on startup.
+	// Migrations must then be applied using the migrate sub-command.
+	SkipMigrations bool `env:"SKIP_MIGRATIONS" json:"skipMigrations"`
 }
 
+const (
+	EventSourceLocal        = "local"
+	EventSourceChangeStream = "changestream"
+)
+
 func LoadConfig(ctx context.Context, path string) (*Config, error) {
 	var cfg Config
 
@@ -55,6 +79,21 @@ func LoadConfig(ctx context.Context, path string) (*Config, error) {
 		cfg.PublicListenAddress = ":8080"
 	}
 
+	switch cfg.EventSource {
+	case "":
+		cfg.EventSource = EventSourceLocal
+	case EventSourceLocal, EventSourceChangeStream:
+	default:
+		return nil, fmt.Errorf("invalid EVENT_SOURCE %q, expected %q or %q", cfg.EventSource, EventSourceLocal, EventSourceChangeStream)
+	}
+
+	switch mode := mentions.UnresolvedMode(cfg.UnresolvedMentions); {
+	case mode == "":
+		cfg.UnresolvedMentions = string(mentions.UnresolvedText)
+	case !mode.Valid():
+		return nil, fmt.Errorf("invalid UNRESOLVED_MENTIONS %q, expected %q, %q or %q", cfg.UnresolvedMentions, mentions.UnresolvedText, mentions.UnresolvedSpan, mentions.UnresolvedReject)
+	}
+
 	if len(cfg.AllowedOrigins) == 0 {
 		cfg.AllowedOrigins = []string{"*"}
 	}
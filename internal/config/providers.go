@@ -4,17 +4,31 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/profiles"
 	"github.com/tierklinik-dobersberg/comment-service/internal/repo"
+	"github.com/tierklinik-dobersberg/comment-service/internal/templates"
 )
 
+// profileCacheTTL is how long user profiles are cached before they are
+// loaded from the IDM again.
+const profileCacheTTL = 5 * time.Minute
+
 type Providers struct {
 	Users  idmv1connect.UserServiceClient
 	Roles  idmv1connect.RoleServiceClient
 	Notify idmv1connect.NotifyServiceClient
 
-	Repository *repo.Repository
+	// Profiles caches user profiles and roles loaded through Users and
+	// Roles.
+	Profiles *profiles.Cache
+
+	Repository repo.Repository
+	Templates  *templates.Engine
+	Events     *events.Bus
 
 	Config Config
 }
@@ -22,16 +36,37 @@ type Providers struct {
 func NewProviders(ctx context.Context, cfg Config) (*Providers, error) {
 	httpClient := http.DefaultClient
 
-	repo, err := repo.NewRepository(ctx, cfg.Database)
+	repository, err := repo.New(ctx, cfg.Database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create repository: %w", err)
 	}
 
+	if !cfg.SkipMigrations {
+		if err := repo.Migrate(ctx, repository); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	if _, ok := repository.(repo.CommentWatcher); !ok && cfg.EventSource == EventSourceChangeStream {
+		return nil, fmt.Errorf("EVENT_SOURCE %q is not supported by the configured database", cfg.EventSource)
+	}
+
+	tmpls, err := templates.New(cfg.NotificationTemplates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notification templates: %w", err)
+	}
+
+	users := idmv1connect.NewUserServiceClient(httpClient, cfg.IdmURL)
+	roles := idmv1connect.NewRoleServiceClient(httpClient, cfg.IdmURL)
+
 	p := &Providers{
-		Users:      idmv1connect.NewUserServiceClient(httpClient, cfg.IdmURL),
-		Roles:      idmv1connect.NewRoleServiceClient(httpClient, cfg.IdmURL),
+		Users:      users,
+		Roles:      roles,
 		Notify:     idmv1connect.NewNotifyServiceClient(httpClient, cfg.IdmURL),
-		Repository: repo,
+		Profiles:   profiles.NewCache(users, roles, profileCacheTTL),
+		Repository: repository,
+		Templates:  tmpls,
+		Events:     events.NewBus(),
 		Config:     cfg,
 	}
 
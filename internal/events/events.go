@@ -0,0 +1,105 @@
+// Package events distributes comment events to subscribers within the
+// service process.
+package events
+
+import (
+	"sync"
+
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+// Type describes what happened to a comment.
+type Type string
+
+const (
+	Created = Type("created")
+	Edited  = Type("edited")
+	Deleted = Type("deleted")
+)
+
+// subscriberBuffer is the number of events buffered per subscriber. If a
+// subscriber falls behind, it's channel is closed.
+const subscriberBuffer = 64
+
+// Event is published whenever a comment is created, edited or deleted.
+type Event struct {
+	Type    Type
+	Comment models.Comment
+}
+
+type subscriber struct {
+	scope     string
+	reference string
+	ch        chan Event
+}
+
+// Bus is an in-process event bus. Subscribers receive all events for a
+// scope and, optionally, a reference.
+type Bus struct {
+	l    sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+// NewBus returns a new, empty event bus.
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*subscriber]struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives all events for scope. If reference
+// is set, only events for comments with that reference are delivered. The
+// returned function must be called to release the subscription. The channel
+// is closed if the subscriber cannot keep up with published events.
+func (b *Bus) Subscribe(scope string, reference string) (<-chan Event, func()) {
+	sub := &subscriber{
+		scope:     scope,
+		reference: reference,
+		ch:        make(chan Event, subscriberBuffer),
+	}
+
+	b.l.Lock()
+	b.subs[sub] = struct{}{}
+	b.l.Unlock()
+
+	return sub.ch, func() {
+		b.remove(sub)
+	}
+}
+
+// Publish delivers evt to all matching subscribers. It never blocks.
+func (b *Bus) Publish(evt Event) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	for sub := range b.subs {
+		if sub.scope != evt.Comment.Scope {
+			continue
+		}
+
+		if sub.reference != "" && sub.reference != evt.Comment.Reference {
+			continue
+		}
+
+		select {
+		case sub.ch <- evt:
+		default:
+			// the subscriber is too slow, drop it so it can reconnect
+			// instead of silently missing events.
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+func (b *Bus) remove(sub *subscriber) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+
+	delete(b.subs, sub)
+	close(sub.ch)
+}
@@ -1,2 +0,0 @@
-// Package mentions is a goldmark extension for user mentions.
-package mentions
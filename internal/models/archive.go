@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s Scope) ToArchive() api.ArchivedScope {
+	return api.ArchivedScope{
+		ID:               s.ID,
+		Name:             s.Name,
+		NotificationType: string(s.NotificationType),
+		ViewURLTemplate:  s.CommentViewURLTemplate,
+		OwnerIDs:         s.OwnerIDs,
+		ReaderRoles:      s.ReaderRoles,
+		WriterRoles:      s.WriterRoles,
+		HTMLPolicy:       string(s.HTMLPolicy),
+	}
+}
+
+// ScopeFromArchive converts an archived scope back to a Scope. The internal
+// ID is left empty.
+func ScopeFromArchive(s api.ArchivedScope) Scope {
+	return Scope{
+		ID:                     s.ID,
+		Name:                   s.Name,
+		NotificationType:       NotificationType(s.NotificationType),
+		CommentViewURLTemplate: s.ViewURLTemplate,
+		OwnerIDs:               s.OwnerIDs,
+		ReaderRoles:            s.ReaderRoles,
+		WriterRoles:            s.WriterRoles,
+		HTMLPolicy:             HTMLPolicy(s.HTMLPolicy),
+	}
+}
+
+func (c Comment) ToArchive() api.ArchivedComment {
+	res := api.ArchivedComment{
+		ID:                c.ID.Hex(),
+		Reference:         c.Reference,
+		Content:           c.Content,
+		CreatedAt:         c.CreatedAt,
+		CreatorID:         c.CreatorID,
+		DeletedBy:         c.DeletedBy,
+		Mentions:          c.Mentions,
+		CanonicalMentions: c.CanonicalMentions,
+	}
+
+	if !c.ParentID.IsZero() {
+		res.ParentID = c.ParentID.Hex()
+	}
+
+	if !c.UpdatedAt.IsZero() {
+		updatedAt := c.UpdatedAt
+		res.UpdatedAt = &updatedAt
+	}
+
+	if c.Deleted() {
+		deletedAt := c.DeletedAt
+		res.DeletedAt = &deletedAt
+	}
+
+	for _, r := range c.Reactions {
+		res.Reactions = append(res.Reactions, api.ArchivedReaction{
+			Emoji:     r.Emoji,
+			UserID:    r.UserID,
+			CreatedAt: r.CreatedAt,
+		})
+	}
+
+	return res
+}
+
+// CommentFromArchive converts an archived comment back to a Comment of
+// scope.
+func CommentFromArchive(scope string, c api.ArchivedComment) (Comment, error) {
+	res := Comment{
+		Scope:             scope,
+		Reference:         c.Reference,
+		Content:           c.Content,
+		CreatedAt:         c.CreatedAt,
+		CreatorID:         c.CreatorID,
+		DeletedBy:         c.DeletedBy,
+		Mentions:          c.Mentions,
+		CanonicalMentions: c.CanonicalMentions,
+	}
+
+	var err error
+	if res.ID, err = primitive.ObjectIDFromHex(c.ID); err != nil {
+		return Comment{}, fmt.Errorf("invalid comment id %q: %w", c.ID, err)
+	}
+
+	if c.ParentID != "" {
+		if res.ParentID, err = primitive.ObjectIDFromHex(c.ParentID); err != nil {
+			return Comment{}, fmt.Errorf("comment %s: invalid parent id %q: %w", c.ID, c.ParentID, err)
+		}
+	}
+
+	if c.UpdatedAt != nil {
+		res.UpdatedAt = *c.UpdatedAt
+	}
+
+	if c.DeletedAt != nil {
+		res.DeletedAt = *c.DeletedAt
+	}
+
+	for _, r := range c.Reactions {
+		res.Reactions = append(res.Reactions, Reaction{
+			Emoji:     r.Emoji,
+			UserID:    r.UserID,
+			CreatedAt: r.CreatedAt,
+		})
+	}
+
+	return res, nil
+}
@@ -1,13 +1,33 @@
 package models
 
 import (
+	"slices"
+	"strings"
 	"time"
 
 	commentv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/comment/v1"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// TombstoneContent replaces the content of soft-deleted comments.
+const TombstoneContent = "_This comment has been deleted._"
+
+// HTMLPolicy controls how raw HTML in comments of a scope is handled.
+type HTMLPolicy string
+
+var (
+	// HTMLPolicyOmit drops raw HTML when rendering comments. This is the
+	// default.
+	HTMLPolicyOmit = HTMLPolicy("")
+	// HTMLPolicyAllow renders raw HTML. It's still sanitized so only a safe
+	// subset of elements and attributes is kept.
+	HTMLPolicyAllow = HTMLPolicy("allow")
+	// HTMLPolicyForbid rejects comments that contain raw HTML.
+	HTMLPolicyForbid = HTMLPolicy("forbid")
+)
+
 type NotificationType string
 
 var (
@@ -24,6 +44,14 @@ type (
 		NotificationType       NotificationType   `bson:"notificationType"`
 		CommentViewURLTemplate string             `bson:"viewUrlTemplate"`
 		OwnerIDs               []string           `bson:"scopeOwnerIds"`
+
+		// ReaderRoles and WriterRoles restrict which users may read or
+		// write comments. Each entry is either a role ID or a role name.
+		// If empty, all authenticated users are allowed.
+		ReaderRoles []string `bson:"readerRoles,omitempty"`
+		WriterRoles []string `bson:"writerRoles,omitempty"`
+
+		HTMLPolicy HTMLPolicy `bson:"htmlPolicy,omitempty"`
 	}
 
 	Comment struct {
@@ -34,6 +62,50 @@ type (
 		ParentID  primitive.ObjectID `bson:"parentId,omitempty"`
 		CreatedAt time.Time          `bson:"createdAt"`
 		CreatorID string             `bson:"creatorId"`
+
+		// UpdatedAt is set to the time of the last edit.
+		UpdatedAt time.Time `bson:"updatedAt,omitempty"`
+		// RevisionCount holds the number of previous versions stored in
+		// the revision collection.
+		RevisionCount int `bson:"revisionCount,omitempty"`
+
+		// DeletedAt and DeletedBy are set when the comment has been
+		// soft-deleted. The content is replaced by TombstoneContent in that case.
+		DeletedAt time.Time `bson:"deletedAt,omitempty"`
+		DeletedBy string    `bson:"deletedBy,omitempty"`
+
+		// Reactions holds all emoji reactions in the order they have
+		// been added.
+		Reactions []Reaction `bson:"reactions,omitempty"`
+
+		// Mentions holds the IDs of all users mentioned in Content. They
+		// are resolved when the comment is created or edited and the
+		// mentions in Content are rewritten to use the user ID as well.
+		Mentions []string `bson:"mentions,omitempty"`
+		// CanonicalMentions is set if the mentions in Content have been
+		// rewritten as described above. Remaining mentions did not match a
+		// user at that time and must not be resolved to users later on.
+		// Comments written before mentions were stored by ID may still
+		// mention users by name.
+		CanonicalMentions bool `bson:"canonicalMentions,omitempty"`
+	}
+
+	// Reaction is an emoji reaction of a user on a comment.
+	Reaction struct {
+		Emoji     string    `bson:"emoji"`
+		UserID    string    `bson:"userId"`
+		CreatedAt time.Time `bson:"createdAt"`
+	}
+
+	// CommentRevision holds a previous version of a comment's content.
+	CommentRevision struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		CommentID primitive.ObjectID `bson:"commentId"`
+		Content   string             `bson:"content"`
+		// EditedAt is the time at which Content has been replaced.
+		EditedAt time.Time `bson:"editedAt"`
+		// EditorID is the ID of the user that replaced Content.
+		EditorID string `bson:"editorId"`
 	}
 
 	CommentTree struct {
@@ -52,6 +124,31 @@ func (s Scope) ToProto() *commentv1.Scope {
 	}
 }
 
+func (s Scope) ToAPI() api.Scope {
+	return api.Scope{
+		ID:               s.ID,
+		Name:             s.Name,
+		NotificationType: string(s.NotificationType),
+		ViewURLTemplate:  s.CommentViewURLTemplate,
+		OwnerIDs:         s.OwnerIDs,
+	}
+}
+
+func (s Scope) SettingsToAPI() api.ScopeSettings {
+	return api.ScopeSettings{
+		Scope:      s.ID,
+		HTMLPolicy: string(s.HTMLPolicy),
+	}
+}
+
+func (s Scope) AccessToAPI() api.ScopeAccess {
+	return api.ScopeAccess{
+		Scope:       s.ID,
+		ReaderRoles: s.ReaderRoles,
+		WriterRoles: s.WriterRoles,
+	}
+}
+
 func (c Comment) ToProto() *commentv1.Comment {
 	cpb := &commentv1.Comment{
 		Scope:     c.Scope,
@@ -69,6 +166,58 @@ func (c Comment) ToProto() *commentv1.Comment {
 	return cpb
 }
 
+// Deleted returns true if the comment has been soft-deleted.
+func (c Comment) Deleted() bool {
+	return !c.DeletedAt.IsZero()
+}
+
+// Edited returns true if the comment has been edited at least once.
+func (c Comment) Edited() bool {
+	return c.RevisionCount > 0
+}
+
+func (c Comment) ToAPI() api.Comment {
+	res := api.Comment{
+		ID:            c.ID.Hex(),
+		Scope:         c.Scope,
+		Reference:     c.Reference,
+		Content:       c.Content,
+		CreatedAt:     c.CreatedAt,
+		CreatorID:     c.CreatorID,
+		Edited:        c.Edited(),
+		RevisionCount: c.RevisionCount,
+	}
+
+	if !c.ParentID.IsZero() {
+		res.ParentID = c.ParentID.Hex()
+	}
+
+	res.Reactions = c.ReactionsToAPI()
+	res.Mentions = c.Mentions
+
+	if !c.UpdatedAt.IsZero() {
+		updatedAt := c.UpdatedAt
+		res.UpdatedAt = &updatedAt
+	}
+
+	if c.Deleted() {
+		deletedAt := c.DeletedAt
+		res.Deleted = true
+		res.DeletedAt = &deletedAt
+		res.DeletedBy = c.DeletedBy
+	}
+
+	return res
+}
+
+func (r CommentRevision) ToAPI() api.CommentRevision {
+	return api.CommentRevision{
+		Content:  r.Content,
+		EditedAt: r.EditedAt,
+		EditorID: r.EditorID,
+	}
+}
+
 func (ct CommentTree) ToProto(recurse bool) *commentv1.CommentTree {
 	tree := &commentv1.CommentTree{
 		Comment: ct.Comment.ToProto(),
@@ -86,6 +235,62 @@ func (ct CommentTree) ToProto(recurse bool) *commentv1.CommentTree {
 	return tree
 }
 
+// ReactionsToAPI groups all reactions by emoji. Groups are sorted by the time
+// of the first reaction.
+func (c Comment) ReactionsToAPI() []api.Reaction {
+	var result []api.Reaction
+
+	for _, r := range c.Reactions {
+		idx := slices.IndexFunc(result, func(a api.Reaction) bool {
+			return a.Emoji == r.Emoji
+		})
+
+		if idx < 0 {
+			result = append(result, api.Reaction{
+				Emoji: r.Emoji,
+			})
+			idx = len(result) - 1
+		}
+
+		result[idx].Count++
+		result[idx].UserIDs = append(result[idx].UserIDs, r.UserID)
+	}
+
+	return result
+}
+
+// SortAnswers sorts all answers of the tree, recursively, by creation time.
+func (ct *CommentTree) SortAnswers() {
+	slices.SortStableFunc(ct.Answers, func(a, b *CommentTree) int {
+		if c := a.Comment.CreatedAt.Compare(b.Comment.CreatedAt); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Comment.ID.Hex(), b.Comment.ID.Hex())
+	})
+
+	for _, answer := range ct.Answers {
+		answer.SortAnswers()
+	}
+}
+
+func (ct CommentTree) ToAPI(recurse bool) api.CommentTree {
+	tree := api.CommentTree{
+		Comment: ct.Comment.ToAPI(),
+	}
+
+	if !recurse {
+		return tree
+	}
+
+	tree.Answers = make([]api.CommentTree, len(ct.Answers))
+	for idx, answer := range ct.Answers {
+		tree.Answers[idx] = answer.ToAPI(recurse)
+	}
+
+	return tree
+}
+
 func NotificationTypeToProto(nt NotificationType) commentv1.NotificationType {
 	switch nt {
 	case NotificationTypeEMail:
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OutboxState string
+
+var (
+	// OutboxStatePending marks entries that still need to be delivered.
+	OutboxStatePending = OutboxState("pending")
+	// OutboxStateDelivered marks entries that have been delivered successfully.
+	OutboxStateDelivered = OutboxState("delivered")
+	// OutboxStateFailed marks entries that failed too often and need
+	// operator attention.
+	OutboxStateFailed = OutboxState("failed")
+	// OutboxStateDiscarded marks entries that have been discarded by an
+	// operator.
+	OutboxStateDiscarded = OutboxState("discarded")
+)
+
+// OutboxEntry is a pending notification delivery for a newly created comment.
+type OutboxEntry struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	CommentID primitive.ObjectID `bson:"commentId"`
+	State     OutboxState        `bson:"state"`
+	Attempts  int                `bson:"attempts"`
+
+	// NextAttemptAt is the time at which the entry is due for delivery.
+	// While an entry is being processed it is set to the end of the
+	// processing lease.
+	NextAttemptAt time.Time `bson:"nextAttemptAt"`
+	LastError     string    `bson:"lastError,omitempty"`
+
+	// DeliveredTo holds the IDs of all users that have already been
+	// notified so they are skipped when retrying.
+	DeliveredTo []string `bson:"deliveredTo,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+func (e OutboxEntry) ToAPI() api.OutboxEntry {
+	return api.OutboxEntry{
+		ID:            e.ID.Hex(),
+		CommentID:     e.CommentID.Hex(),
+		State:         string(e.State),
+		Attempts:      e.Attempts,
+		NextAttemptAt: e.NextAttemptAt,
+		LastError:     e.LastError,
+		DeliveredTo:   e.DeliveredTo,
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+	}
+}
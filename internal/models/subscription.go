@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SubscriptionState string
+
+var (
+	// SubscriptionStateSubscribed notifies the user about all new comments
+	// of the subscription target.
+	SubscriptionStateSubscribed = SubscriptionState("subscribed")
+	// SubscriptionStateMuted suppresses all notifications for the
+	// subscription target.
+	SubscriptionStateMuted = SubscriptionState("muted")
+)
+
+type (
+	// SubscriptionTarget is either a comment thread, identified by the
+	// root comment, or a whole scope with an optional reference.
+	SubscriptionTarget struct {
+		Scope     string             `bson:"scopeId"`
+		Reference string             `bson:"ref"`
+		RootID    primitive.ObjectID `bson:"rootId"`
+	}
+
+	// Subscription is a per-user notification setting for a
+	// SubscriptionTarget.
+	Subscription struct {
+		ID                 primitive.ObjectID `bson:"_id"`
+		UserID             string             `bson:"userId"`
+		SubscriptionTarget `bson:",inline"`
+		State              SubscriptionState `bson:"state"`
+		UpdatedAt          time.Time         `bson:"updatedAt"`
+	}
+)
+
+// Specificity returns how specific the subscription target is. Settings on
+// more specific targets take precedence.
+func (t SubscriptionTarget) Specificity() int {
+	switch {
+	case !t.RootID.IsZero():
+		return 2
+	case t.Reference != "":
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (s Subscription) ToAPI() api.Subscription {
+	res := api.Subscription{
+		Target: api.SubscriptionTarget{
+			Scope:     s.Scope,
+			Reference: s.Reference,
+		},
+		State:     string(s.State),
+		UpdatedAt: s.UpdatedAt,
+	}
+
+	if !s.RootID.IsZero() {
+		res.Target.ThreadID = s.RootID.Hex()
+	}
+
+	return res
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ViewURLContext is passed to the CommentViewURLTemplate of a scope. The
+// field names are aligned with the protobuf comment message so templates
+// like "https://example.com/comments/{{ .Scope }}/{{ .Id }}" keep working.
+type ViewURLContext struct {
+	Id        string
+	Scope     string
+	ScopeName string
+	Reference string
+	ParentId  string
+	CreatorId string
+
+	// RootId is the ID of the root comment of the thread. It's equal to
+	// Id for root comments.
+	RootId string
+}
+
+// NewViewURLContext returns the template context for comment. rootId may be
+// zero for root comments.
+func NewViewURLContext(scope Scope, comment Comment, rootId primitive.ObjectID) ViewURLContext {
+	ctx := ViewURLContext{
+		Id:        comment.ID.Hex(),
+		Scope:     scope.ID,
+		ScopeName: scope.Name,
+		Reference: comment.Reference,
+		CreatorId: comment.CreatorID,
+		RootId:    comment.ID.Hex(),
+	}
+
+	if !comment.ParentID.IsZero() {
+		ctx.ParentId = comment.ParentID.Hex()
+	}
+
+	if !rootId.IsZero() {
+		ctx.RootId = rootId.Hex()
+	}
+
+	return ctx
+}
+
+// ViewURLTemplate parses the CommentViewURLTemplate of the scope. It returns
+// nil if the scope does not have a view URL template.
+func (s Scope) ViewURLTemplate() (*template.Template, error) {
+	if strings.TrimSpace(s.CommentViewURLTemplate) == "" {
+		return nil, nil
+	}
+
+	return template.New(s.ID).
+		Option("missingkey=error").
+		Parse(s.CommentViewURLTemplate)
+}
+
+// RenderViewURL renders the view-comment URL for the given template context.
+// It returns an empty string if the scope does not have a view URL template.
+func (s Scope) RenderViewURL(ctx ViewURLContext) (string, error) {
+	tmpl, err := s.ViewURLTemplate()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse view URL template: %w", err)
+	}
+
+	if tmpl == nil {
+		return "", nil
+	}
+
+	buf := new(strings.Builder)
+	if err := tmpl.Execute(buf, ctx); err != nil {
+		return "", fmt.Errorf("failed to execute view URL template: %w", err)
+	}
+
+	result := strings.TrimSpace(buf.String())
+
+	if _, err := url.Parse(result); err != nil {
+		return "", fmt.Errorf("view URL template rendered an invalid URL: %w", err)
+	}
+
+	return result, nil
+}
+
+// ValidateViewURLTemplate makes sure the view URL template of the scope can
+// be parsed and executed.
+func (s Scope) ValidateViewURLTemplate() error {
+	sample := ViewURLContext{
+		Id:        primitive.NewObjectID().Hex(),
+		Scope:     s.ID,
+		ScopeName: s.Name,
+		Reference: "reference",
+		ParentId:  primitive.NewObjectID().Hex(),
+		CreatorId: "user-id",
+	}
+	sample.RootId = sample.ParentId
+
+	_, err := s.RenderViewURL(sample)
+
+	return err
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook is an URL that receives comment events of a scope.
+type Webhook struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Scope string             `bson:"scopeId"`
+	URL   string             `bson:"url"`
+
+	// Secret is used to sign the payload of each delivery using
+	// HMAC-SHA256.
+	Secret string `bson:"secret"`
+
+	// Events holds the event types the webhook is interested in. If empty,
+	// all events are delivered.
+	Events []string `bson:"events,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt"`
+	CreatorID string    `bson:"creatorId"`
+}
+
+// Wants returns true if the webhook should be called for eventType.
+func (w Webhook) Wants(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// ToAPI converts the webhook to it's API representation. The secret is only
+// included if withSecret is true.
+func (w Webhook) ToAPI(withSecret bool) api.Webhook {
+	res := api.Webhook{
+		ID:        w.ID.Hex(),
+		Scope:     w.Scope,
+		URL:       w.URL,
+		Events:    w.Events,
+		CreatedAt: w.CreatedAt,
+		CreatorID: w.CreatorID,
+	}
+
+	if withSecret {
+		res.Secret = w.Secret
+	}
+
+	return res
+}
+
+type WebhookDeliveryState string
+
+var (
+	WebhookDeliveryStatePending   = WebhookDeliveryState("pending")
+	WebhookDeliveryStateDelivered = WebhookDeliveryState("delivered")
+	WebhookDeliveryStateFailed    = WebhookDeliveryState("failed")
+)
+
+// WebhookDelivery is a single call of a webhook. Deliveries are kept as a
+// delivery log after they have been completed.
+type WebhookDelivery struct {
+	ID        primitive.ObjectID   `bson:"_id"`
+	WebhookID primitive.ObjectID   `bson:"webhookId"`
+	Event     string               `bson:"event"`
+	CommentID primitive.ObjectID   `bson:"commentId"`
+	State     WebhookDeliveryState `bson:"state"`
+	Attempts  int                  `bson:"attempts"`
+
+	// Payload is the JSON body sent to the webhook. It's rendered once so
+	// retries send exactly the same content.
+	Payload string `bson:"payload"`
+
+	// NextAttemptAt is the time at which the delivery is due. While a
+	// delivery is being processed it is set to the end of the processing
+	// lease.
+	NextAttemptAt time.Time `bson:"nextAttemptAt"`
+
+	LastStatusCode int    `bson:"lastStatusCode,omitempty"`
+	LastError      string `bson:"lastError,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// NewWebhookDeliveries returns a pending delivery of event for each webhook
+// that wants it. The payload is rendered from comment.
+func NewWebhookDeliveries(webhooks []Webhook, event string, comment Comment) ([]WebhookDelivery, error) {
+	now := time.Now()
+
+	var result []WebhookDelivery
+	for _, w := range webhooks {
+		if !w.Wants(event) {
+			continue
+		}
+
+		delivery := WebhookDelivery{
+			ID:            primitive.NewObjectID(),
+			WebhookID:     w.ID,
+			Event:         event,
+			CommentID:     comment.ID,
+			State:         WebhookDeliveryStatePending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+
+		payload, err := json.Marshal(api.WebhookPayload{
+			DeliveryID: delivery.ID.Hex(),
+			WebhookID:  w.ID.Hex(),
+			Event:      event,
+			Scope:      comment.Scope,
+			Timestamp:  now,
+			Comment:    comment.ToAPI(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+		}
+
+		delivery.Payload = string(payload)
+
+		result = append(result, delivery)
+	}
+
+	return result, nil
+}
+
+func (d WebhookDelivery) ToAPI() api.WebhookDelivery {
+	return api.WebhookDelivery{
+		ID:             d.ID.Hex(),
+		WebhookID:      d.WebhookID.Hex(),
+		Event:          d.Event,
+		CommentID:      d.CommentID.Hex(),
+		State:          string(d.State),
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
@@ -0,0 +1,438 @@
+// Package profiles caches user profiles and roles loaded from the IDM.
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+// Cache resolves user IDs and names to profiles. All profiles are loaded
+// with a single ListUsers call and kept for the configured TTL, so resolving
+// the mentions of a large thread or the recipients of a notification does not
+// cause a round trip per user.
+//
+// Roles are loaded with a single ListRoles call and cached the same way.
+//
+// Tags that do not match any of the loaded profiles cause a single reload
+// so users created or renamed within the TTL can be mentioned. User IDs and
+// tags that are not known to the IDM are remembered until the profiles
+// expire so stale IDs, for example of deleted users, are only looked up once.
+//
+// If reloading the profiles or roles fails, the expired data is used until
+// the IDM is reachable again.
+type Cache struct {
+	users idmv1connect.UserServiceClient
+	roles idmv1connect.RoleServiceClient
+	ttl   time.Duration
+
+	l             sync.Mutex
+	loadedAt      time.Time
+	generation    int
+	byId          map[string]*idmv1.Profile
+	byName        map[string]*idmv1.Profile
+	byDisplayName map[string]*idmv1.Profile
+	missing       map[string]bool
+
+	rolesLoadedAt time.Time
+	rolesById     map[string]*idmv1.Role
+	rolesByName   map[string]*idmv1.Role
+
+	// the IDM is called without holding l, concurrent reloads are
+	// deduplicated instead.
+	usersFlight flight
+	rolesFlight flight
+}
+
+// NewCache returns a new profile cache that loads profiles from users and
+// roles from roles and keeps them for ttl.
+func NewCache(users idmv1connect.UserServiceClient, roles idmv1connect.RoleServiceClient, ttl time.Duration) *Cache {
+	return &Cache{
+		users: users,
+		roles: roles,
+		ttl:   ttl,
+	}
+}
+
+// Get returns the profile of the user with userId. Users that have been
+// created after the profiles were loaded are fetched from the IDM directly.
+func (c *Cache) Get(ctx context.Context, userId string) (*idmv1.Profile, error) {
+	byId, _, _, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile, ok := byId[userId]; ok {
+		return profile, nil
+	}
+
+	if c.isMissing(userId) {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user %q not found", userId))
+	}
+
+	res, err := c.users.GetUser(ctx, connect.NewRequest(&idmv1.GetUserRequest{
+		Search: &idmv1.GetUserRequest_Id{
+			Id: userId,
+		},
+	}))
+	if err != nil {
+		if connect.CodeOf(err) == connect.CodeNotFound {
+			c.addMissing(userId)
+		}
+
+		return nil, err
+	}
+
+	c.add(res.Msg.GetProfile())
+
+	return res.Msg.GetProfile(), nil
+}
+
+// ResolveIDs returns the profiles of the users with ids. In contrast to
+// Resolve, ids are never matched against user or display names. Like Get,
+// users that are not part of the loaded profiles are fetched from the IDM
+// and unknown IDs are not part of the returned map.
+func (c *Cache) ResolveIDs(ctx context.Context, ids []string) (map[string]*idmv1.Profile, error) {
+	result := make(map[string]*idmv1.Profile, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	byId, _, _, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if profile, ok := byId[id]; ok {
+			result[id] = profile
+
+			continue
+		}
+
+		profile, err := c.Get(ctx, id)
+		if err != nil {
+			if connect.CodeOf(err) == connect.CodeNotFound {
+				continue
+			}
+
+			return result, err
+		}
+
+		result[id] = profile
+	}
+
+	return result, nil
+}
+
+// Resolve resolves tags, which are either user IDs, user names or display
+// names, to profiles. Display names are only used if they are unique. Tags
+// that do not match any user are not part of the returned map.
+//
+// If some tags do not match the loaded profiles, the profiles are reloaded
+// once for all of them. Tags that still do not match are not tried again
+// until the profiles expire.
+func (c *Cache) Resolve(ctx context.Context, tags []string) (map[string]*idmv1.Profile, error) {
+	result := make(map[string]*idmv1.Profile, len(tags))
+	if len(tags) == 0 {
+		return result, nil
+	}
+
+	// there is no need to reload the profiles again if load just did
+	c.l.Lock()
+	generation := c.generation
+	c.l.Unlock()
+
+	byId, byName, byDisplayName, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	misses := resolveTags(result, tags, byId, byName, byDisplayName)
+
+	misses = slices.DeleteFunc(misses, c.isMissing)
+	if len(misses) == 0 {
+		return result, nil
+	}
+
+	err = c.usersFlight.do(ctx, func(ctx context.Context) error {
+		return c.reloadUsers(ctx, generation, false)
+	})
+	if err != nil {
+		log.L(ctx).Errorf("failed to reload user profiles for unknown mentions: %s", err)
+
+		return result, nil
+	}
+
+	c.l.Lock()
+	byId, byName, byDisplayName = c.byId, c.byName, c.byDisplayName
+	c.l.Unlock()
+
+	for _, tag := range resolveTags(result, misses, byId, byName, byDisplayName) {
+		c.addMissing(tag)
+	}
+
+	return result, nil
+}
+
+// resolveTags adds the profiles matching tags to result and returns the tags
+// that do not match any profile.
+func resolveTags(result map[string]*idmv1.Profile, tags []string, byId, byName, byDisplayName map[string]*idmv1.Profile) []string {
+	var misses []string
+
+	for _, tag := range tags {
+		if profile, ok := byId[tag]; ok {
+			result[tag] = profile
+		} else if profile, ok := byName[tag]; ok {
+			result[tag] = profile
+		} else if profile := byDisplayName[tag]; profile != nil {
+			result[tag] = profile
+		} else if !slices.Contains(misses, tag) {
+			misses = append(misses, tag)
+		}
+	}
+
+	return misses
+}
+
+// ResolveRoles resolves tags, which are either role IDs or role names, to
+// roles. Tags that do not match any role are not part of the returned map.
+func (c *Cache) ResolveRoles(ctx context.Context, tags []string) (map[string]*idmv1.Role, error) {
+	result := make(map[string]*idmv1.Role, len(tags))
+	if len(tags) == 0 {
+		return result, nil
+	}
+
+	byId, byName, err := c.loadRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range tags {
+		if role, ok := byId[tag]; ok {
+			result[tag] = role
+		} else if role, ok := byName[tag]; ok {
+			result[tag] = role
+		}
+	}
+
+	return result, nil
+}
+
+// RoleMembers returns the profiles of all users that have the role with
+// roleId assigned.
+func (c *Cache) RoleMembers(ctx context.Context, roleId string) ([]*idmv1.Profile, error) {
+	byId, _, _, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*idmv1.Profile
+	for _, profile := range byId {
+		for _, role := range profile.GetRoles() {
+			if role.GetId() == roleId {
+				result = append(result, profile)
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// load returns the cached profiles indexed by user ID, name and display name
+// and reloads them from the IDM if they have expired.
+func (c *Cache) load(ctx context.Context) (byId, byName, byDisplayName map[string]*idmv1.Profile, err error) {
+	c.l.Lock()
+	byId, byName, byDisplayName = c.byId, c.byName, c.byDisplayName
+	loadedAt, generation := c.loadedAt, c.generation
+	c.l.Unlock()
+
+	if byId != nil && time.Since(loadedAt) < c.ttl {
+		return byId, byName, byDisplayName, nil
+	}
+
+	err = c.usersFlight.do(ctx, func(ctx context.Context) error {
+		return c.reloadUsers(ctx, generation, true)
+	})
+
+	c.l.Lock()
+	byId, byName, byDisplayName = c.byId, c.byName, c.byDisplayName
+	c.l.Unlock()
+
+	if err != nil {
+		if byId != nil {
+			log.L(ctx).Errorf("failed to reload user profiles, using expired profiles: %s", err)
+
+			return byId, byName, byDisplayName, nil
+		}
+
+		return nil, nil, nil, fmt.Errorf("failed to load user profiles: %w", err)
+	}
+
+	return byId, byName, byDisplayName, nil
+}
+
+// reloadUsers loads all profiles from the IDM unless they have been reloaded
+// since generation. If expired is false, the profiles are reloaded before
+// they expire, which keeps the unknown users and the expiry time.
+func (c *Cache) reloadUsers(ctx context.Context, generation int, expired bool) error {
+	c.l.Lock()
+	reloaded := c.generation != generation
+	c.l.Unlock()
+
+	if reloaded {
+		return nil
+	}
+
+	res, err := c.users.ListUsers(ctx, connect.NewRequest(&idmv1.ListUsersRequest{}))
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[string]*idmv1.Profile, len(res.Msg.GetUsers()))
+	byName := make(map[string]*idmv1.Profile, len(res.Msg.GetUsers()))
+	byDisplayName := make(map[string]*idmv1.Profile, len(res.Msg.GetUsers()))
+
+	for _, profile := range res.Msg.GetUsers() {
+		byId[profile.GetUser().GetId()] = profile
+		byName[profile.GetUser().GetUsername()] = profile
+
+		// display names are not unique, ambiguous ones are stored as nil
+		if name := profile.GetUser().GetDisplayName(); name != "" {
+			if _, ok := byDisplayName[name]; ok {
+				byDisplayName[name] = nil
+			} else {
+				byDisplayName[name] = profile
+			}
+		}
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.byId = byId
+	c.byName = byName
+	c.byDisplayName = byDisplayName
+	c.generation++
+
+	if expired {
+		c.missing = nil
+		c.loadedAt = time.Now()
+	}
+
+	return nil
+}
+
+// loadRoles returns the cached roles indexed by ID and name and reloads them
+// from the IDM if they have expired.
+func (c *Cache) loadRoles(ctx context.Context) (byId, byName map[string]*idmv1.Role, err error) {
+	c.l.Lock()
+	byId, byName = c.rolesById, c.rolesByName
+	loadedAt := c.rolesLoadedAt
+	c.l.Unlock()
+
+	if byId != nil && time.Since(loadedAt) < c.ttl {
+		return byId, byName, nil
+	}
+
+	err = c.rolesFlight.do(ctx, func(ctx context.Context) error {
+		return c.reloadRoles(ctx, loadedAt)
+	})
+
+	c.l.Lock()
+	byId, byName = c.rolesById, c.rolesByName
+	c.l.Unlock()
+
+	if err != nil {
+		if byId != nil {
+			log.L(ctx).Errorf("failed to reload roles, using expired roles: %s", err)
+
+			return byId, byName, nil
+		}
+
+		return nil, nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
+	return byId, byName, nil
+}
+
+// reloadRoles loads all roles from the IDM unless they have been reloaded
+// since loadedAt.
+func (c *Cache) reloadRoles(ctx context.Context, loadedAt time.Time) error {
+	c.l.Lock()
+	reloaded := !c.rolesLoadedAt.Equal(loadedAt)
+	c.l.Unlock()
+
+	if reloaded {
+		return nil
+	}
+
+	res, err := c.roles.ListRoles(ctx, connect.NewRequest(&idmv1.ListRolesRequest{}))
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[string]*idmv1.Role, len(res.Msg.GetRoles()))
+	byName := make(map[string]*idmv1.Role, len(res.Msg.GetRoles()))
+
+	for _, role := range res.Msg.GetRoles() {
+		byId[role.GetId()] = role
+		byName[role.GetName()] = role
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.rolesById = byId
+	c.rolesByName = byName
+	c.rolesLoadedAt = time.Now()
+
+	return nil
+}
+
+// add adds profile to the cache until the next reload. The maps are copied
+// because callers of load may still use them.
+func (c *Cache) add(profile *idmv1.Profile) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	byId := maps.Clone(c.byId)
+	byName := maps.Clone(c.byName)
+
+	byId[profile.GetUser().GetId()] = profile
+	byName[profile.GetUser().GetUsername()] = profile
+
+	c.byId = byId
+	c.byName = byName
+}
+
+// isMissing reports whether the IDM did not know userId, or a tag passed to
+// Resolve, since the profiles have been loaded.
+func (c *Cache) isMissing(userId string) bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.missing[userId]
+}
+
+// addMissing remembers that userId is not known to the IDM until the next
+// reload.
+func (c *Cache) addMissing(userId string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.missing == nil {
+		c.missing = make(map[string]bool)
+	}
+
+	c.missing[userId] = true
+}
@@ -0,0 +1,395 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
+)
+
+// fakeUsers is a UserServiceClient that serves profiles and counts the
+// calls. ListUsers and GetUser fail with err if set. GetUser also finds
+// profiles in hidden, which are not returned by ListUsers. If block is set,
+// ListUsers signals entered and waits until block is closed.
+type fakeUsers struct {
+	idmv1connect.UserServiceClient
+
+	profiles []*idmv1.Profile
+	hidden   []*idmv1.Profile
+	err      error
+
+	block   chan struct{}
+	entered chan struct{}
+
+	listCalls int
+	getCalls  int
+}
+
+func (f *fakeUsers) ListUsers(ctx context.Context, req *connect.Request[idmv1.ListUsersRequest]) (*connect.Response[idmv1.ListUsersResponse], error) {
+	f.listCalls++
+
+	if f.block != nil {
+		f.entered <- struct{}{}
+		<-f.block
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, connect.NewError(connect.CodeCanceled, err)
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return connect.NewResponse(&idmv1.ListUsersResponse{
+		Users: f.profiles,
+	}), nil
+}
+
+func (f *fakeUsers) GetUser(ctx context.Context, req *connect.Request[idmv1.GetUserRequest]) (*connect.Response[idmv1.GetUserResponse], error) {
+	f.getCalls++
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	for _, p := range append(f.profiles, f.hidden...) {
+		if p.GetUser().GetId() == req.Msg.GetId() {
+			return connect.NewResponse(&idmv1.GetUserResponse{
+				Profile: p,
+			}), nil
+		}
+	}
+
+	return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
+}
+
+func profile(id, username, displayName string) *idmv1.Profile {
+	return &idmv1.Profile{
+		User: &idmv1.User{Id: id, Username: username, DisplayName: displayName},
+	}
+}
+
+// expire makes the cached profiles expire without waiting for the TTL.
+func expire(c *Cache) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.loadedAt = time.Now().Add(-2 * c.ttl)
+}
+
+func resolvedIds(t *testing.T, c *Cache, tags ...string) []string {
+	t.Helper()
+
+	result, err := c.Resolve(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("failed to resolve %v: %s", tags, err)
+	}
+
+	ids := make([]string, len(tags))
+	for idx, tag := range tags {
+		ids[idx] = result[tag].GetUser().GetId()
+	}
+
+	return ids
+}
+
+func TestCacheTTL(t *testing.T) {
+	users := &fakeUsers{profiles: []*idmv1.Profile{profile("alice-id", "alice", "Alice")}}
+	c := NewCache(users, nil, time.Hour)
+
+	for range 3 {
+		if got := resolvedIds(t, c, "alice"); !slices.Equal(got, []string{"alice-id"}) {
+			t.Fatalf("expected alice to resolve to alice-id, got %v", got)
+		}
+	}
+
+	if users.listCalls != 1 {
+		t.Errorf("expected one ListUsers call within the TTL, got %d", users.listCalls)
+	}
+
+	users.profiles = append(users.profiles, profile("bob-id", "bob", "Bob"))
+	expire(c)
+
+	if got := resolvedIds(t, c, "bob", "alice"); !slices.Equal(got, []string{"bob-id", "alice-id"}) {
+		t.Errorf("expected bob and alice to resolve after reloading, got %v", got)
+	}
+
+	if users.listCalls != 2 {
+		t.Errorf("expected ListUsers to be called again after expiry, got %d calls", users.listCalls)
+	}
+}
+
+func TestCacheResolveUnknown(t *testing.T) {
+	users := &fakeUsers{profiles: []*idmv1.Profile{profile("alice-id", "alice", "Alice")}}
+	c := NewCache(users, nil, time.Hour)
+
+	if got := resolvedIds(t, c, "alice"); !slices.Equal(got, []string{"alice-id"}) {
+		t.Fatalf("expected alice to resolve, got %v", got)
+	}
+
+	// users created or renamed within the TTL are found with a single reload
+	users.profiles = []*idmv1.Profile{
+		profile("alice-id", "alice.b", "Alice"),
+		profile("bob-id", "bob", "Bob"),
+		profile("carol-id", "carol", "Carol"),
+	}
+
+	if got := resolvedIds(t, c, "bob", "alice.b", "Carol", "bob"); !slices.Equal(got, []string{"bob-id", "alice-id", "carol-id", "bob-id"}) {
+		t.Errorf("expected all users to resolve, got %v", got)
+	}
+
+	if users.listCalls != 2 {
+		t.Errorf("expected a single reload for all unknown tags, got %d ListUsers calls", users.listCalls)
+	}
+
+	// unknown tags are only looked up once until the profiles expire
+	for range 3 {
+		if got := resolvedIds(t, c, "nobody", "alice.b"); !slices.Equal(got, []string{"", "alice-id"}) {
+			t.Errorf("expected nobody to be unknown, got %v", got)
+		}
+	}
+
+	if users.listCalls != 3 {
+		t.Errorf("expected one reload for an unknown tag, got %d ListUsers calls", users.listCalls)
+	}
+
+	// the expiry reload is not repeated for unknown tags
+	expire(c)
+
+	if got := resolvedIds(t, c, "nobody"); !slices.Equal(got, []string{""}) {
+		t.Errorf("expected nobody to be unknown, got %v", got)
+	}
+
+	if users.listCalls != 4 {
+		t.Errorf("expected a single reload after expiry, got %d ListUsers calls", users.listCalls)
+	}
+
+	// failed reloads do not mark tags as unknown
+	users.err = connect.NewError(connect.CodeUnavailable, fmt.Errorf("idm is down"))
+
+	if got := resolvedIds(t, c, "dave"); !slices.Equal(got, []string{""}) {
+		t.Errorf("expected dave to be unknown, got %v", got)
+	}
+
+	users.err = nil
+	users.profiles = append(users.profiles, profile("dave-id", "dave", "Dave"))
+
+	if got := resolvedIds(t, c, "dave"); !slices.Equal(got, []string{"dave-id"}) {
+		t.Errorf("expected dave to resolve once the IDM is reachable, got %v", got)
+	}
+}
+
+func TestCacheStaleOnError(t *testing.T) {
+	users := &fakeUsers{err: connect.NewError(connect.CodeUnavailable, fmt.Errorf("idm is down"))}
+	c := NewCache(users, nil, time.Hour)
+
+	// without any profiles the error is returned
+	if _, err := c.Resolve(context.Background(), []string{"alice"}); err == nil {
+		t.Fatalf("expected an error if the profiles were never loaded")
+	}
+
+	users.err = nil
+	users.profiles = []*idmv1.Profile{profile("alice-id", "alice", "Alice")}
+
+	if got := resolvedIds(t, c, "alice"); !slices.Equal(got, []string{"alice-id"}) {
+		t.Fatalf("expected alice to resolve, got %v", got)
+	}
+
+	users.err = connect.NewError(connect.CodeUnavailable, fmt.Errorf("idm is down"))
+	expire(c)
+
+	// the expired profiles are used while the IDM is unreachable
+	if got := resolvedIds(t, c, "alice"); !slices.Equal(got, []string{"alice-id"}) {
+		t.Errorf("expected the expired profile of alice to be used, got %v", got)
+	}
+
+	if users.listCalls != 3 {
+		t.Errorf("expected a reload attempt, got %d ListUsers calls", users.listCalls)
+	}
+
+	p, err := c.Get(context.Background(), "alice-id")
+	if err != nil || p.GetUser().GetUsername() != "alice" {
+		t.Errorf("expected Get to return the expired profile, got %v (%v)", p, err)
+	}
+}
+
+func TestCacheAmbiguousDisplayNames(t *testing.T) {
+	users := &fakeUsers{profiles: []*idmv1.Profile{
+		profile("alex-1", "alex.a", "Alex"),
+		profile("alex-2", "alex.b", "Alex"),
+		profile("bob-id", "bob", "Bob"),
+		profile("carol-id", "carol", ""),
+	}}
+	c := NewCache(users, nil, time.Hour)
+
+	cases := []struct {
+		tag  string
+		want string
+	}{
+		{"Alex", ""},
+		{"alex.a", "alex-1"},
+		{"alex-2", "alex-2"},
+		{"Bob", "bob-id"},
+		{"carol", "carol-id"},
+		{"", ""},
+		{"unknown", ""},
+	}
+
+	for _, tc := range cases {
+		if got := resolvedIds(t, c, tc.tag); got[0] != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.tag, tc.want, got[0])
+		}
+	}
+
+	// user names and IDs take precedence over display names
+	users.profiles = append(users.profiles, profile("dave-id", "Bob", "Dave"))
+	expire(c)
+
+	if got := resolvedIds(t, c, "Bob"); got[0] != "dave-id" {
+		t.Errorf("expected the user name Bob to resolve to dave-id, got %q", got[0])
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	users := &fakeUsers{
+		profiles: []*idmv1.Profile{profile("alice-id", "alice", "Alice")},
+		hidden:   []*idmv1.Profile{profile("bob-id", "bob", "Bob")},
+	}
+	c := NewCache(users, nil, time.Hour)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "alice-id"); err != nil || users.getCalls != 0 {
+		t.Fatalf("expected alice to be served from the cache, got %v (%d GetUser calls)", err, users.getCalls)
+	}
+
+	// users created after the profiles were loaded are fetched once
+	for range 2 {
+		p, err := c.Get(ctx, "bob-id")
+		if err != nil || p.GetUser().GetUsername() != "bob" {
+			t.Fatalf("expected bob to be fetched, got %v (%v)", p, err)
+		}
+	}
+
+	if users.getCalls != 1 {
+		t.Errorf("expected one GetUser call for bob, got %d", users.getCalls)
+	}
+
+	// unknown users are looked up once until the next reload
+	users.getCalls = 0
+
+	for range 3 {
+		_, err := c.Get(ctx, "unknown-id")
+		if connect.CodeOf(err) != connect.CodeNotFound {
+			t.Fatalf("expected a not found error, got %v", err)
+		}
+	}
+
+	if users.getCalls != 1 {
+		t.Errorf("expected one GetUser call for an unknown user, got %d", users.getCalls)
+	}
+
+	expire(c)
+
+	if _, err := c.Get(ctx, "unknown-id"); connect.CodeOf(err) != connect.CodeNotFound {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	if users.getCalls != 2 {
+		t.Errorf("expected unknown users to be looked up again after a reload, got %d GetUser calls", users.getCalls)
+	}
+
+	// other errors are not cached
+	users.getCalls = 0
+	users.err = connect.NewError(connect.CodeUnavailable, fmt.Errorf("idm is down"))
+
+	for range 2 {
+		if _, err := c.Get(ctx, "carol-id"); connect.CodeOf(err) != connect.CodeUnavailable {
+			t.Fatalf("expected an unavailable error, got %v", err)
+		}
+	}
+
+	if users.getCalls != 2 {
+		t.Errorf("expected failed lookups to be retried, got %d GetUser calls", users.getCalls)
+	}
+}
+
+func TestCacheResolveIDs(t *testing.T) {
+	users := &fakeUsers{
+		profiles: []*idmv1.Profile{
+			profile("alice-id", "alice", "Alice"),
+			profile("bob-id", "carol-id", "Bob"),
+		},
+		hidden: []*idmv1.Profile{profile("carol-id", "carol", "Carol")},
+	}
+	c := NewCache(users, nil, time.Hour)
+
+	ids := []string{"alice-id", "carol-id", "alice", "gone-id", "gone-id"}
+
+	result, err := c.ResolveIDs(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("failed to resolve IDs: %s", err)
+	}
+
+	got := make([]string, len(ids))
+	for idx, id := range ids {
+		got[idx] = result[id].GetUser().GetUsername()
+	}
+
+	// IDs are never matched against user names
+	if want := []string{"alice", "carol", "", "", ""}; !slices.Equal(want, got) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if users.listCalls != 1 || users.getCalls != 3 {
+		t.Errorf("expected one ListUsers and three GetUser calls, got %d and %d", users.listCalls, users.getCalls)
+	}
+}
+
+func TestCacheReload(t *testing.T) {
+	users := &fakeUsers{profiles: []*idmv1.Profile{profile("alice-id", "alice", "Alice")}}
+	c := NewCache(users, nil, time.Hour)
+
+	// the profiles are loaded even if the request that triggered the
+	// reload is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := c.Resolve(ctx, []string{"alice"})
+	if err != nil || result["alice"].GetUser().GetId() != "alice-id" {
+		t.Fatalf("expected alice to resolve with a cancelled context, got %v (%v)", result, err)
+	}
+
+	users.profiles = append(users.profiles, profile("bob-id", "bob", "Bob"))
+	users.block = make(chan struct{})
+	users.entered = make(chan struct{})
+	expire(c)
+
+	done := make(chan string)
+	go func() {
+		result, _ := c.Resolve(context.Background(), []string{"bob"})
+		done <- result["bob"].GetUser().GetId()
+	}()
+
+	<-users.entered
+
+	// waiting for the running reload is given up once the context is done
+	if p, err := c.Get(ctx, "alice-id"); err != nil || p.GetUser().GetUsername() != "alice" {
+		t.Errorf("expected the expired profile of alice while reloading, got %v (%v)", p, err)
+	}
+
+	close(users.block)
+
+	if got := <-done; got != "bob-id" {
+		t.Errorf("expected bob to resolve after reloading, got %q", got)
+	}
+
+	if users.listCalls != 2 {
+		t.Errorf("expected two ListUsers calls, got %d", users.listCalls)
+	}
+}
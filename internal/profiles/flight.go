@@ -0,0 +1,55 @@
+package profiles
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// reloadTimeout limits how long reloading the profiles or roles may take.
+const reloadTimeout = 30 * time.Second
+
+// flight runs at most one reload at a time. Callers that arrive while a
+// reload is running wait for its result instead of starting another one.
+type flight struct {
+	l       sync.Mutex
+	running *flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	err  error
+}
+
+// do calls fn unless another call is already running and returns its error.
+// fn is shared by all waiting callers, so its context is not cancelled
+// together with ctx. Waiting callers give up once ctx is done.
+func (f *flight) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.l.Lock()
+	if call := f.running; call != nil {
+		f.l.Unlock()
+
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	f.running = call
+	f.l.Unlock()
+
+	fnCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reloadTimeout)
+	call.err = fn(fnCtx)
+	cancel()
+
+	f.l.Lock()
+	f.running = nil
+	f.l.Unlock()
+
+	close(call.done)
+
+	return call.err
+}
@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type commentChange struct {
+	OperationType     string          `bson:"operationType"`
+	FullDocument      *models.Comment `bson:"fullDocument"`
+	FullDocumentPrior *models.Comment `bson:"fullDocumentBeforeChange"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// WatchComments opens a change stream on the comment collection and calls
+// publish for each created, edited or deleted comment. If resumeAfter is
+// set, the stream resumes after that token. WatchComments blocks until ctx
+// is cancelled or the change stream fails and returns the last seen resume
+// token.
+//
+// Change streams require a replica set. Purged comments are only reported if
+// pre-images are enabled for the comment collection.
+func (r *MongoRepository) WatchComments(ctx context.Context, resumeAfter bson.Raw, publish func(events.Event)) (bson.Raw, error) {
+	pipeline := mongo.Pipeline{
+		{{
+			Key: "$match",
+			Value: bson.M{
+				"operationType": bson.M{
+					"$in": bson.A{"insert", "update", "replace", "delete"},
+				},
+			},
+		}},
+	}
+
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+
+	if resumeAfter != nil {
+		opts.SetResumeAfter(resumeAfter)
+	}
+
+	stream, err := r.comments.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return resumeAfter, fmt.Errorf("failed to open change stream: %w", err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		resumeAfter = stream.ResumeToken()
+
+		var change commentChange
+		if err := stream.Decode(&change); err != nil {
+			return resumeAfter, fmt.Errorf("failed to decode change event: %w", err)
+		}
+
+		if evt, ok := change.toEvent(); ok {
+			publish(evt)
+		}
+	}
+
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		return resumeAfter, fmt.Errorf("change stream failed: %w", err)
+	}
+
+	return resumeAfter, nil
+}
+
+func (c commentChange) toEvent() (events.Event, bool) {
+	switch c.OperationType {
+	case "insert":
+		if c.FullDocument != nil {
+			return events.Event{Type: events.Created, Comment: *c.FullDocument}, true
+		}
+
+	case "update", "replace":
+		if c.FullDocument == nil {
+			// the comment has been removed in the meantime
+			return events.Event{}, false
+		}
+
+		if _, ok := c.UpdateDescription.UpdatedFields["deletedAt"]; ok {
+			return events.Event{Type: events.Deleted, Comment: *c.FullDocument}, true
+		}
+
+		if _, ok := c.UpdateDescription.UpdatedFields["content"]; ok || c.OperationType == "replace" {
+			return events.Event{Type: events.Edited, Comment: *c.FullDocument}, true
+		}
+
+	case "delete":
+		if c.FullDocumentPrior != nil {
+			return events.Event{Type: events.Deleted, Comment: *c.FullDocumentPrior}, true
+		}
+	}
+
+	return events.Event{}, false
+}
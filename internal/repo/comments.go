@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
 	"github.com/tierklinik-dobersberg/comment-service/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var graphLookupStep = bson.D{
@@ -25,7 +28,7 @@ var graphLookupStep = bson.D{
 	},
 }
 
-func (r *Repository) CreateComment(ctx context.Context, model models.Comment) (string, error) {
+func (r *MongoRepository) CreateComment(ctx context.Context, model models.Comment) (string, error) {
 	// verify that the scope actually exists
 	if _, err := r.GetScopeByID(ctx, model.Scope); err != nil {
 		return "", err
@@ -35,15 +38,94 @@ func (r *Repository) CreateComment(ctx context.Context, model models.Comment) (s
 		model.ID = primitive.NewObjectID()
 	}
 
-	// insert the actual scope
-	if _, err := r.comments.InsertOne(ctx, model); err != nil {
+	// The notification outbox entry, the comment and the webhook deliveries
+	// are written in the same transaction. On standalone servers, without
+	// transaction support, the outbox entry is written first so
+	// notifications are not lost if we crash right after inserting the
+	// comment. The dispatcher retries entries for comments that are not
+	// visible yet and discards them once they are older than the lease.
+	err := r.withTransaction(ctx, func(ctx context.Context) error {
+		outboxId, err := r.createOutboxEntry(ctx, model.ID)
+		if err != nil {
+			return err
+		}
+
+		// insert the actual comment
+		if _, err := r.comments.InsertOne(ctx, model); err != nil {
+			if r.transactions {
+				return err
+			}
+
+			if _, delErr := r.outbox.DeleteOne(ctx, bson.M{"_id": outboxId}); delErr != nil {
+				return fmt.Errorf("%w (and failed to remove outbox entry: %s)", err, delErr)
+			}
+
+			return err
+		}
+
+		return r.enqueueWebhooks(ctx, events.Created, model)
+	})
+	if err != nil {
 		return "", err
 	}
 
 	return model.ID.Hex(), nil
 }
 
-func (r *Repository) GetComment(ctx context.Context, id string) (models.Comment, error) {
+func (r *MongoRepository) ImportComments(ctx context.Context, comments []models.Comment, overwrite bool) (int, error) {
+	written := 0
+
+	err := r.withTransaction(ctx, func(ctx context.Context) error {
+		written = 0
+
+		for _, c := range comments {
+			if overwrite {
+				// the scope filter makes the upsert fail with a duplicate
+				// key error if the ID is used in another scope.
+				_, err := r.comments.ReplaceOne(ctx, bson.M{"_id": c.ID, "scopeId": c.Scope}, c, options.Replace().SetUpsert(true))
+				if mongo.IsDuplicateKeyError(err) {
+					return errCommentInOtherScope(c.ID)
+				}
+
+				if err != nil {
+					return fmt.Errorf("failed to save comment %s: %w", c.ID.Hex(), err)
+				}
+
+				written++
+
+				continue
+			}
+
+			if _, err := r.comments.InsertOne(ctx, c); err != nil {
+				if !mongo.IsDuplicateKeyError(err) {
+					return fmt.Errorf("failed to save comment %s: %w", c.ID.Hex(), err)
+				}
+
+				count, err := r.comments.CountDocuments(ctx, bson.M{"_id": c.ID, "scopeId": c.Scope})
+				if err != nil {
+					return fmt.Errorf("failed to check comment %s: %w", c.ID.Hex(), err)
+				}
+
+				if count == 0 {
+					return errCommentInOtherScope(c.ID)
+				}
+
+				continue
+			}
+
+			written++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return written, nil
+}
+
+func (r *MongoRepository) GetComment(ctx context.Context, id string) (models.Comment, error) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
@@ -66,7 +148,7 @@ func (r *Repository) GetComment(ctx context.Context, id string) (models.Comment,
 	return c, nil
 }
 
-func (r *Repository) GetParentComments(ctx context.Context, id string) ([]models.Comment, error) {
+func (r *MongoRepository) GetParentComments(ctx context.Context, id string) ([]models.Comment, error) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument, err)
@@ -108,7 +190,7 @@ func (r *Repository) GetParentComments(ctx context.Context, id string) ([]models
 	return result[0].Tree, nil
 }
 
-func (r *Repository) GetCommentTreeFromCommentID(ctx context.Context, id string) (*models.CommentTree, error) {
+func (r *MongoRepository) GetCommentTreeFromCommentID(ctx context.Context, id string) (*models.CommentTree, error) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument, err)
@@ -141,7 +223,17 @@ func (r *Repository) GetCommentTreeFromCommentID(ctx context.Context, id string)
 	return result[0].buildCommentTree()
 }
 
-func (r *Repository) GetCommentTreeByScope(ctx context.Context, scopeId string, reference string) ([]*models.CommentTree, error) {
+func (r *MongoRepository) GetCommentTreeByScope(ctx context.Context, scopeId string, reference string) ([]*models.CommentTree, error) {
+	trees, _, err := r.ListCommentTrees(ctx, scopeId, reference, ListOptions{})
+
+	return trees, err
+}
+
+// ListCommentTrees returns the comment trees of all root comments in scopeId
+// (and reference, if set) ordered by creation time. If opts.PageSize is set, at
+// most PageSize trees are returned and nextPageToken is set if there are more
+// results available.
+func (r *MongoRepository) ListCommentTrees(ctx context.Context, scopeId string, reference string, opts ListOptions) (trees []*models.CommentTree, nextPageToken string, err error) {
 	filter := bson.M{
 		"scopeId": scopeId,
 		"parentId": bson.M{
@@ -153,33 +245,77 @@ func (r *Repository) GetCommentTreeByScope(ctx context.Context, scopeId string,
 		filter["ref"] = reference
 	}
 
+	if opts.PageToken != "" {
+		token, err := decodePageToken(opts.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if token.Descending != opts.Descending {
+			return nil, "", connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("page token does not match the requested sort order"))
+		}
+
+		for key, value := range token.filter() {
+			filter[key] = value
+		}
+	}
+
+	sortDirection := 1
+	if opts.Descending {
+		sortDirection = -1
+	}
+
 	pipeline := mongo.Pipeline{
 		{{
 			Key:   "$match",
 			Value: filter,
 		}},
-		graphLookupStep,
+		{{
+			Key: "$sort",
+			Value: bson.D{
+				{Key: "createdAt", Value: sortDirection},
+				{Key: "_id", Value: sortDirection},
+			},
+		}},
+	}
+
+	if opts.PageSize > 0 {
+		// fetch one more document so we know if there's a next page
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: opts.PageSize + 1}})
 	}
 
+	pipeline = append(pipeline, graphLookupStep)
+
 	res, err := r.comments.Aggregate(ctx, pipeline)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var result []treeResult
 	if err := res.All(ctx, &result); err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	if opts.PageSize > 0 && len(result) > opts.PageSize {
+		result = result[:opts.PageSize]
+
+		last := result[len(result)-1]
+		nextPageToken = pageToken{
+			CreatedAt:  last.CreatedAt,
+			ID:         last.ID,
+			Descending: opts.Descending,
+		}.encode()
 	}
 
-	trees := make([]*models.CommentTree, len(result))
+	trees = make([]*models.CommentTree, len(result))
 	for idx, r := range result {
 		trees[idx], err = r.buildCommentTree()
 		if err != nil {
-			return nil, fmt.Errorf("failed to build comment tree for %q: %w", r.Comment.ID.Hex(), err)
+			return nil, "", fmt.Errorf("failed to build comment tree for %q: %w", r.Comment.ID.Hex(), err)
 		}
 	}
 
-	return trees, nil
+	return trees, nextPageToken, nil
 }
 
 type treeResult struct {
@@ -225,5 +361,129 @@ func (tr treeResult) buildCommentTree() (*models.CommentTree, error) {
 		}
 	}
 
+	// answers are returned in an undefined order so make sure they are
+	// sorted chronologically.
+	resultTree.SortAnswers()
+
 	return resultTree, nil
 }
+
+// SoftDeleteComment replaces the content of the comment with
+// models.TombstoneContent and records who deleted the comment and when. The
+// comment stays in the database so answers stay attached to the thread.
+func (r *MongoRepository) SoftDeleteComment(ctx context.Context, id string, userId string) (models.Comment, error) {
+	var result models.Comment
+
+	err := r.withTransaction(ctx, func(ctx context.Context) error {
+		comment, err := r.GetComment(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if comment.Deleted() {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("comment has already been deleted"))
+		}
+
+		now := time.Now()
+
+		res, err := r.comments.UpdateOne(ctx, bson.M{
+			"_id": comment.ID,
+			"deletedAt": bson.M{
+				"$exists": false,
+			},
+		}, bson.M{
+			"$set": bson.M{
+				"content":   models.TombstoneContent,
+				"deletedAt": now,
+				"deletedBy": userId,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+
+		if res.MatchedCount == 0 {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("comment has already been deleted"))
+		}
+
+		comment.Content = models.TombstoneContent
+		comment.DeletedAt = now
+		comment.DeletedBy = userId
+
+		result = comment
+
+		return r.enqueueWebhooks(ctx, events.Deleted, comment)
+	})
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	return result, nil
+}
+
+// PurgeCommentTree removes the comment with id and all of its answers,
+// including their revisions, from the database. It returns the number of
+// deleted comments. Webhooks receive a single deleted event for the comment
+// with id.
+func (r *MongoRepository) PurgeCommentTree(ctx context.Context, id string, userId string) (int64, error) {
+	var deleted int64
+
+	err := r.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		deleted, err = r.purgeCommentTree(ctx, id, userId)
+
+		return err
+	})
+
+	return deleted, err
+}
+
+func (r *MongoRepository) purgeCommentTree(ctx context.Context, id string, userId string) (int64, error) {
+	tree, err := r.GetCommentTreeFromCommentID(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []primitive.ObjectID
+
+	var collect func(t *models.CommentTree)
+	collect = func(t *models.CommentTree) {
+		ids = append(ids, t.Comment.ID)
+
+		for _, answer := range t.Answers {
+			collect(answer)
+		}
+	}
+	collect(tree)
+
+	filter := bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	}
+
+	res, err := r.comments.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete comments: %w", err)
+	}
+
+	if _, err := r.revisions.DeleteMany(ctx, bson.M{"commentId": filter["_id"]}); err != nil {
+		return res.DeletedCount, fmt.Errorf("failed to delete revisions: %w", err)
+	}
+
+	if _, err := r.subscriptions.DeleteMany(ctx, bson.M{"rootId": filter["_id"]}); err != nil {
+		return res.DeletedCount, fmt.Errorf("failed to delete subscriptions: %w", err)
+	}
+
+	comment := tree.Comment
+	comment.Content = models.TombstoneContent
+	comment.DeletedAt = time.Now()
+	comment.DeletedBy = userId
+
+	if err := r.enqueueWebhooks(ctx, events.Deleted, comment); err != nil {
+		return res.DeletedCount, err
+	}
+
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,840 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Repository conformance tests
+//
+// The tests in this file run against every Repository implementation to
+// make sure all backends behave the same. The memory and the SQLite backend
+// are always tested. PostgreSQL and MongoDB are only tested if a database
+// URL is set in TEST_POSTGRES_URL or TEST_MONGODB_URL. Each test runs in a
+// fresh schema or database that is dropped afterwards.
+
+// testBackend creates a new, empty repository.
+type testBackend struct {
+	name string
+	open func(t *testing.T) Repository
+}
+
+func testBackends() []testBackend {
+	return []testBackend{
+		{name: "memory", open: openMemoryRepository},
+		{name: "sqlite", open: openSQLiteRepository},
+		{name: "postgres", open: openPostgresRepository},
+		{name: "mongodb", open: openMongoRepository},
+	}
+}
+
+func openMemoryRepository(t *testing.T) Repository {
+	return NewMemoryRepository()
+}
+
+func openSQLiteRepository(t *testing.T) Repository {
+	r, err := NewSQLRepository(context.Background(), "sqlite://"+filepath.Join(t.TempDir(), "comments.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %s", err)
+	}
+
+	t.Cleanup(func() { _ = r.db.Close() })
+
+	return migrateTestRepository(t, r)
+}
+
+func openPostgresRepository(t *testing.T) Repository {
+	databaseURL := os.Getenv("TEST_POSTGRES_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+
+	ctx := context.Background()
+	schema := "comments_test_" + primitive.NewObjectID().Hex()
+
+	admin, err := sql.Open(postgresDialect.driver, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to open postgres database: %s", err)
+	}
+	defer admin.Close()
+
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("failed to create schema: %s", err)
+	}
+
+	t.Cleanup(func() {
+		admin, err := sql.Open(postgresDialect.driver, databaseURL)
+		if err != nil {
+			t.Errorf("failed to open postgres database: %s", err)
+			return
+		}
+		defer admin.Close()
+
+		if _, err := admin.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %s", schema, err)
+		}
+	})
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatalf("invalid TEST_POSTGRES_URL: %s", err)
+	}
+
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	r, err := NewSQLRepository(ctx, u.String())
+	if err != nil {
+		t.Fatalf("failed to open postgres database: %s", err)
+	}
+
+	t.Cleanup(func() { _ = r.db.Close() })
+
+	return migrateTestRepository(t, r)
+}
+
+func openMongoRepository(t *testing.T) Repository {
+	databaseURL := os.Getenv("TEST_MONGODB_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_MONGODB_URL is not set")
+	}
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatalf("invalid TEST_MONGODB_URL: %s", err)
+	}
+
+	u.Path = "/comments_test_" + primitive.NewObjectID().Hex()
+
+	r, err := NewMongoRepository(context.Background(), u.String())
+	if err != nil {
+		t.Fatalf("failed to connect to mongodb: %s", err)
+	}
+
+	t.Cleanup(func() {
+		ctx := context.Background()
+
+		if err := r.cli.Database(r.db).Drop(ctx); err != nil {
+			t.Errorf("failed to drop database %s: %s", r.db, err)
+		}
+
+		_ = r.cli.Disconnect(ctx)
+	})
+
+	return migrateTestRepository(t, r)
+}
+
+func migrateTestRepository(t *testing.T, r Repository) Repository {
+	if err := r.(Migrator).Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+
+	return r
+}
+
+// runConformance runs fn against a fresh repository of every backend.
+func runConformance(t *testing.T, fn func(t *testing.T, r Repository)) {
+	for _, backend := range testBackends() {
+		t.Run(backend.name, func(t *testing.T) {
+			fn(t, backend.open(t))
+		})
+	}
+}
+
+// fixture creates scopes and comments with predictable creation times.
+type fixture struct {
+	t    *testing.T
+	r    Repository
+	base time.Time
+}
+
+func newFixture(t *testing.T, r Repository, scopes ...string) *fixture {
+	t.Helper()
+
+	for _, id := range scopes {
+		if _, err := r.CreateScope(context.Background(), &models.Scope{ID: id, Name: id}); err != nil {
+			t.Fatalf("failed to create scope %s: %s", id, err)
+		}
+	}
+
+	return &fixture{
+		t:    t,
+		r:    r,
+		base: time.Now().Add(-time.Hour).Truncate(time.Second),
+	}
+}
+
+// comment creates a comment that has been created offset seconds after the
+// fixture's base time.
+func (f *fixture) comment(offset int, c models.Comment) models.Comment {
+	f.t.Helper()
+
+	if c.CreatorID == "" {
+		c.CreatorID = "alice"
+	}
+
+	c.CreatedAt = f.base.Add(time.Duration(offset) * time.Second)
+
+	id, err := f.r.CreateComment(context.Background(), c)
+	if err != nil {
+		f.t.Fatalf("failed to create comment: %s", err)
+	}
+
+	c.ID, _ = primitive.ObjectIDFromHex(id)
+
+	return c
+}
+
+func requireCode(t *testing.T, err error, code connect.Code) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected a %s error, got nil", code)
+	}
+
+	if got := connect.CodeOf(err); got != code {
+		t.Fatalf("expected a %s error, got %s: %s", code, got, err)
+	}
+}
+
+func commentIds(comments []models.Comment) []string {
+	result := make([]string, len(comments))
+	for idx, c := range comments {
+		result[idx] = c.ID.Hex()
+	}
+
+	return result
+}
+
+func treeIds(trees []*models.CommentTree) []string {
+	result := make([]string, len(trees))
+	for idx, tree := range trees {
+		result[idx] = tree.Comment.ID.Hex()
+	}
+
+	return result
+}
+
+func TestConformanceScopes(t *testing.T) {
+	runConformance(t, func(t *testing.T, r Repository) {
+		ctx := context.Background()
+
+		scope := models.Scope{
+			ID:          "patients",
+			Name:        "Patients",
+			OwnerIDs:    []string{"alice"},
+			ReaderRoles: []string{"vets"},
+		}
+
+		if _, err := r.CreateScope(ctx, &scope); err != nil {
+			t.Fatalf("failed to create scope: %s", err)
+		}
+
+		_, err := r.CreateScope(ctx, &models.Scope{ID: "patients", Name: "Other"})
+		requireCode(t, err, connect.CodeAlreadyExists)
+
+		got, err := r.GetScopeByID(ctx, "patients")
+		if err != nil {
+			t.Fatalf("failed to get scope: %s", err)
+		}
+
+		if got.Name != "Patients" || !slices.Equal(got.OwnerIDs, scope.OwnerIDs) || !slices.Equal(got.ReaderRoles, scope.ReaderRoles) {
+			t.Errorf("unexpected scope: %+v", got)
+		}
+
+		_, err = r.GetScopeByID(ctx, "unknown")
+		requireCode(t, err, connect.CodeNotFound)
+
+		got.Name = "Renamed"
+		if err := r.UpdateScope(ctx, "patients", &got); err != nil {
+			t.Fatalf("failed to update scope: %s", err)
+		}
+
+		scopes, err := r.ListScopes(ctx)
+		if err != nil {
+			t.Fatalf("failed to list scopes: %s", err)
+		}
+
+		if len(scopes) != 1 || scopes[0].Name != "Renamed" {
+			t.Errorf("unexpected scopes: %+v", scopes)
+		}
+	})
+}
+
+func TestConformanceCommentTrees(t *testing.T) {
+	runConformance(t, func(t *testing.T, r Repository) {
+		ctx := context.Background()
+		f := newFixture(t, r, "patients")
+
+		root := f.comment(0, models.Comment{Scope: "patients", Reference: "cat", Content: "root"})
+		second := f.comment(2, models.Comment{Scope: "patients", Reference: "cat", ParentID: root.ID, Content: "second answer"})
+		first := f.comment(1, models.Comment{Scope: "patients", Reference: "cat", ParentID: root.ID, Content: "first answer @bob", Mentions: []string{"bob"}, CanonicalMentions: true})
+		nested := f.comment(3, models.Comment{Scope: "patients", Reference: "cat", ParentID: first.ID, Content: "nested"})
+		other := f.comment(4, models.Comment{Scope: "patients", Reference: "dog", Content: "other root"})
+
+		_, err := r.CreateComment(ctx, models.Comment{Scope: "unknown", Content: "x", CreatedAt: time.Now()})
+		requireCode(t, err, connect.CodeNotFound)
+
+		_, err = r.CreateComment(ctx, models.Comment{ID: root.ID, Scope: "patients", Content: "x", CreatedAt: time.Now()})
+		requireCode(t, err, connect.CodeAlreadyExists)
+
+		got, err := r.GetComment(ctx, first.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to get comment: %s", err)
+		}
+
+		if got.Content != "first answer @bob" || got.ParentID != root.ID || got.Reference != "cat" || !got.CreatedAt.Equal(first.CreatedAt) {
+			t.Errorf("unexpected comment: %+v", got)
+		}
+
+		if !got.CanonicalMentions || !slices.Equal(got.Mentions, []string{"bob"}) {
+			t.Errorf("expected the mentions to be stored: %+v", got)
+		}
+
+		if got, _ := r.GetComment(ctx, root.ID.Hex()); got.CanonicalMentions {
+			t.Errorf("expected comments without canonical mentions by default: %+v", got)
+		}
+
+		_, err = r.GetComment(ctx, primitive.NewObjectID().Hex())
+		requireCode(t, err, connect.CodeNotFound)
+
+		_, err = r.GetComment(ctx, "not-an-id")
+		requireCode(t, err, connect.CodeInvalidArgument)
+
+		// answers are sorted by creation time, recursively
+		tree, err := r.GetCommentTreeFromCommentID(ctx, root.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to get comment tree: %s", err)
+		}
+
+		if want, got := []string{first.ID.Hex(), second.ID.Hex()}, treeIds(tree.Answers); !slices.Equal(want, got) {
+			t.Fatalf("expected answers %v, got %v", want, got)
+		}
+
+		if want, got := []string{nested.ID.Hex()}, treeIds(tree.Answers[0].Answers); !slices.Equal(want, got) {
+			t.Errorf("expected nested answers %v, got %v", want, got)
+		}
+
+		if len(tree.Answers[1].Answers) != 0 {
+			t.Errorf("expected no answers for the second answer, got %v", treeIds(tree.Answers[1].Answers))
+		}
+
+		// sub-trees can be loaded as well
+		tree, err = r.GetCommentTreeFromCommentID(ctx, first.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to get comment tree: %s", err)
+		}
+
+		if tree.Comment.ID != first.ID || len(tree.Answers) != 1 {
+			t.Errorf("unexpected sub-tree for %s: %v", first.ID.Hex(), treeIds(tree.Answers))
+		}
+
+		parents, err := r.GetParentComments(ctx, nested.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to get parent comments: %s", err)
+		}
+
+		want := []string{nested.ID.Hex(), first.ID.Hex(), root.ID.Hex()}
+		got2 := commentIds(parents)
+		slices.Sort(want)
+		slices.Sort(got2)
+
+		if !slices.Equal(want, got2) {
+			t.Errorf("expected parents %v, got %v", want, got2)
+		}
+
+		trees, err := r.GetCommentTreeByScope(ctx, "patients", "")
+		if err != nil {
+			t.Fatalf("failed to get comment trees: %s", err)
+		}
+
+		gotRoots := treeIds(trees)
+		slices.Sort(gotRoots)
+
+		wantRoots := []string{root.ID.Hex(), other.ID.Hex()}
+		slices.Sort(wantRoots)
+
+		if !slices.Equal(wantRoots, gotRoots) {
+			t.Errorf("expected root comments %v, got %v", wantRoots, gotRoots)
+		}
+
+		trees, err = r.GetCommentTreeByScope(ctx, "patients", "dog")
+		if err != nil {
+			t.Fatalf("failed to get comment trees: %s", err)
+		}
+
+		if want, got := []string{other.ID.Hex()}, treeIds(trees); !slices.Equal(want, got) {
+			t.Errorf("expected root comments %v for reference dog, got %v", want, got)
+		}
+	})
+}
+
+func TestConformancePagination(t *testing.T) {
+	runConformance(t, func(t *testing.T, r Repository) {
+		ctx := context.Background()
+		f := newFixture(t, r, "patients")
+
+		var roots []models.Comment
+		for idx := range 5 {
+			roots = append(roots, f.comment(idx, models.Comment{Scope: "patients", Reference: "cat", Content: fmt.Sprintf("root %d", idx)}))
+		}
+
+		// same creation time as roots[2], the ID breaks the tie
+		roots = slices.Insert(roots, 3, f.comment(2, models.Comment{Scope: "patients", Reference: "cat", Content: "tie"}))
+
+		f.comment(10, models.Comment{Scope: "patients", Reference: "cat", ParentID: roots[0].ID, Content: "answer"})
+		f.comment(11, models.Comment{Scope: "patients", Reference: "dog", Content: "other reference"})
+
+		listAll := func(opts ListOptions) []string {
+			t.Helper()
+
+			var (
+				result []string
+				pages  int
+			)
+
+			for {
+				trees, next, err := r.ListCommentTrees(ctx, "patients", "cat", opts)
+				if err != nil {
+					t.Fatalf("failed to list comment trees: %s", err)
+				}
+
+				if opts.PageSize > 0 && len(trees) > opts.PageSize {
+					t.Fatalf("expected at most %d trees, got %d", opts.PageSize, len(trees))
+				}
+
+				result = append(result, treeIds(trees)...)
+				pages++
+
+				if next == "" {
+					break
+				}
+
+				if pages > 10 {
+					t.Fatalf("pagination does not terminate")
+				}
+
+				opts.PageToken = next
+			}
+
+			return result
+		}
+
+		want := commentIds(roots)
+
+		if got := listAll(ListOptions{}); !slices.Equal(want, got) {
+			t.Errorf("expected %v without pagination, got %v", want, got)
+		}
+
+		for _, size := range []int{1, 2, 4, 6} {
+			if got := listAll(ListOptions{PageSize: size}); !slices.Equal(want, got) {
+				t.Errorf("page size %d: expected %v, got %v", size, want, got)
+			}
+		}
+
+		slices.Reverse(want)
+
+		if got := listAll(ListOptions{PageSize: 4, Descending: true}); !slices.Equal(want, got) {
+			t.Errorf("descending: expected %v, got %v", want, got)
+		}
+
+		// answers are loaded for each root comment
+		trees, _, err := r.ListCommentTrees(ctx, "patients", "cat", ListOptions{PageSize: 1})
+		if err != nil {
+			t.Fatalf("failed to list comment trees: %s", err)
+		}
+
+		if len(trees) != 1 || len(trees[0].Answers) != 1 {
+			t.Errorf("expected the first root to have one answer, got %+v", trees)
+		}
+
+		_, next, err := r.ListCommentTrees(ctx, "patients", "cat", ListOptions{PageSize: 2})
+		if err != nil {
+			t.Fatalf("failed to list comment trees: %s", err)
+		}
+
+		_, _, err = r.ListCommentTrees(ctx, "patients", "cat", ListOptions{PageSize: 2, PageToken: "invalid"})
+		requireCode(t, err, connect.CodeInvalidArgument)
+
+		// tokens cannot be used with a different order
+		_, _, err = r.ListCommentTrees(ctx, "patients", "cat", ListOptions{PageSize: 2, PageToken: next, Descending: true})
+		requireCode(t, err, connect.CodeInvalidArgument)
+	})
+}
+
+func TestConformanceSearch(t *testing.T) {
+	runConformance(t, func(t *testing.T, r Repository) {
+		ctx := context.Background()
+		f := newFixture(t, r, "patients", "internal")
+
+		root := f.comment(0, models.Comment{Scope: "patients", Reference: "cat", Content: "the cat needs a vaccination"})
+		answer := f.comment(1, models.Comment{Scope: "patients", Reference: "cat", ParentID: root.ID, CreatorID: "bob", Content: "vaccination scheduled for monday"})
+		nested := f.comment(2, models.Comment{Scope: "patients", Reference: "cat", ParentID: answer.ID, Content: "thanks, monday works"})
+		dog := f.comment(3, models.Comment{Scope: "patients", Reference: "dog", Content: "the dog is fine, no vaccination needed"})
+		internal := f.comment(4, models.Comment{Scope: "internal", Content: "vaccination stock is low"})
+		deleted := f.comment(5, models.Comment{Scope: "patients", Content: "deleted vaccination comment"})
+
+		if _, err := r.SoftDeleteComment(ctx, deleted.ID.Hex(), "alice"); err != nil {
+			t.Fatalf("failed to delete comment: %s", err)
+		}
+
+		search := func(q SearchQuery) []string {
+			t.Helper()
+
+			results, err := r.SearchComments(ctx, q)
+			if err != nil {
+				t.Fatalf("failed to search %+v: %s", q, err)
+			}
+
+			var ids []string
+			for _, res := range results {
+				ids = append(ids, res.Comment.ID.Hex())
+
+				if res.Score <= 0 {
+					t.Errorf("expected a positive score for %s, got %f", res.Comment.ID.Hex(), res.Score)
+				}
+			}
+
+			slices.Sort(ids)
+
+			return ids
+		}
+
+		expect := func(name string, q SearchQuery, comments ...models.Comment) {
+			t.Helper()
+
+			want := commentIds(comments)
+			slices.Sort(want)
+
+			if got := search(q); !slices.Equal(want, got) {
+				t.Errorf("%s: expected %v, got %v", name, want, got)
+			}
+		}
+
+		expect("word", SearchQuery{Text: "vaccination"}, root, answer, dog, internal)
+		expect("case insensitive", SearchQuery{Text: "VACCINATION"}, root, answer, dog, internal)
+		expect("any word", SearchQuery{Text: "monday cat"}, root, answer, nested)
+		expect("phrase", SearchQuery{Text: `"needs a vaccination"`}, root)
+		expect("negation", SearchQuery{Text: "vaccination -monday"}, root, dog, internal)
+		expect("scope", SearchQuery{Text: "vaccination", Scope: "internal"}, internal)
+		expect("scopes", SearchQuery{Text: "vaccination", Scopes: []string{"internal"}}, internal)
+		expect("no scopes", SearchQuery{Text: "vaccination", Scopes: []string{}})
+		expect("reference", SearchQuery{Text: "vaccination", Scope: "patients", Reference: "dog"}, dog)
+		expect("creator", SearchQuery{Text: "vaccination", CreatorID: "bob"}, answer)
+		expect("created after", SearchQuery{Text: "vaccination", CreatedAfter: f.base.Add(2 * time.Second)}, dog, internal)
+		expect("created before", SearchQuery{Text: "vaccination", CreatedBefore: f.base.Add(2 * time.Second)}, root, answer)
+		expect("no match", SearchQuery{Text: "horse"})
+		expect("only negation", SearchQuery{Text: "-vaccination"})
+
+		results, err := r.SearchComments(ctx, SearchQuery{Text: "monday"})
+		if err != nil {
+			t.Fatalf("failed to search: %s", err)
+		}
+
+		for _, res := range results {
+			if res.RootID != root.ID {
+				t.Errorf("expected root %s for %s, got %s", root.ID.Hex(), res.Comment.ID.Hex(), res.RootID.Hex())
+			}
+		}
+
+		// pages do not overlap
+		var paged []string
+		for offset := 0; offset < 4; offset += 2 {
+			results, err := r.SearchComments(ctx, SearchQuery{Text: "vaccination", Offset: offset, Limit: 2})
+			if err != nil {
+				t.Fatalf("failed to search: %s", err)
+			}
+
+			if len(results) != 2 {
+				t.Fatalf("expected 2 results at offset %d, got %d", offset, len(results))
+			}
+
+			for _, res := range results {
+				paged = append(paged, res.Comment.ID.Hex())
+			}
+		}
+
+		slices.Sort(paged)
+		if want := search(SearchQuery{Text: "vaccination"}); !slices.Equal(want, paged) {
+			t.Errorf("expected pages to contain %v, got %v", want, paged)
+		}
+	})
+}
+
+func TestConformanceCommentChanges(t *testing.T) {
+	runConformance(t, func(t *testing.T, r Repository) {
+		ctx := context.Background()
+		f := newFixture(t, r, "patients")
+
+		webhook := models.Webhook{Scope: "patients", URL: "https://example.com/hook", Secret: "secret", CreatedAt: time.Now()}
+		if err := r.CreateWebhook(ctx, &webhook); err != nil {
+			t.Fatalf("failed to create webhook: %s", err)
+		}
+
+		root := f.comment(0, models.Comment{Scope: "patients", Content: "first version"})
+		answer := f.comment(1, models.Comment{Scope: "patients", ParentID: root.ID, Content: "answer"})
+		nested := f.comment(2, models.Comment{Scope: "patients", ParentID: answer.ID, Content: "nested"})
+
+		updated, err := r.UpdateCommentContent(ctx, root.ID.Hex(), "second version", []string{"bob"}, "alice")
+		if err != nil {
+			t.Fatalf("failed to update comment: %s", err)
+		}
+
+		if updated.Content != "second version" || updated.RevisionCount != 1 || updated.UpdatedAt.IsZero() || !slices.Equal(updated.Mentions, []string{"bob"}) {
+			t.Errorf("unexpected updated comment: %+v", updated)
+		}
+
+		// edited comments always have canonical mentions
+		if stored, _ := r.GetComment(ctx, root.ID.Hex()); !stored.CanonicalMentions || !slices.Equal(stored.Mentions, []string{"bob"}) {
+			t.Errorf("expected the mentions of the edited comment to be stored: %+v", stored)
+		}
+
+		revisions, err := r.ListCommentRevisions(ctx, root.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to list revisions: %s", err)
+		}
+
+		if len(revisions) != 1 || revisions[0].Content != "first version" || revisions[0].EditorID != "alice" {
+			t.Errorf("unexpected revisions: %+v", revisions)
+		}
+
+		deleted, err := r.SoftDeleteComment(ctx, root.ID.Hex(), "bob")
+		if err != nil {
+			t.Fatalf("failed to delete comment: %s", err)
+		}
+
+		if !deleted.Deleted() || deleted.DeletedBy != "bob" || deleted.Content != models.TombstoneContent {
+			t.Errorf("unexpected deleted comment: %+v", deleted)
+		}
+
+		_, err = r.SoftDeleteComment(ctx, root.ID.Hex(), "bob")
+		requireCode(t, err, connect.CodeFailedPrecondition)
+
+		stored, err := r.GetComment(ctx, root.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to get comment: %s", err)
+		}
+
+		if !stored.Deleted() || stored.Content != models.TombstoneContent {
+			t.Errorf("expected the stored comment to be a tombstone: %+v", stored)
+		}
+
+		count, err := r.PurgeCommentTree(ctx, answer.ID.Hex(), "admin")
+		if err != nil {
+			t.Fatalf("failed to purge comments: %s", err)
+		}
+
+		if count != 2 {
+			t.Errorf("expected 2 purged comments, got %d", count)
+		}
+
+		_, err = r.GetComment(ctx, answer.ID.Hex())
+		requireCode(t, err, connect.CodeNotFound)
+
+		// every change enqueued a webhook delivery
+		deliveries, err := r.ListWebhookDeliveries(ctx, webhook.ID, models.WebhookDeliveryStatePending, 0)
+		if err != nil {
+			t.Fatalf("failed to list webhook deliveries: %s", err)
+		}
+
+		var got []string
+		for _, d := range deliveries {
+			got = append(got, d.Event+":"+d.CommentID.Hex())
+		}
+
+		slices.Sort(got)
+
+		want := []string{
+			"created:" + root.ID.Hex(),
+			"created:" + answer.ID.Hex(),
+			"created:" + nested.ID.Hex(),
+			"edited:" + root.ID.Hex(),
+			"deleted:" + root.ID.Hex(),
+			"deleted:" + answer.ID.Hex(),
+		}
+		slices.Sort(want)
+
+		if !slices.Equal(want, got) {
+			t.Errorf("expected webhook deliveries %v, got %v", want, got)
+		}
+	})
+}
+
+func TestConformanceOutbox(t *testing.T) {
+	runConformance(t, func(t *testing.T, r Repository) {
+		ctx := context.Background()
+		f := newFixture(t, r, "patients")
+
+		comment := f.comment(0, models.Comment{Scope: "patients", Content: "notify me"})
+
+		entry, err := r.ClaimOutboxEntry(ctx, time.Minute)
+		if err != nil {
+			t.Fatalf("failed to claim outbox entry: %s", err)
+		}
+
+		if entry == nil || entry.CommentID != comment.ID || entry.Attempts != 1 || entry.State != models.OutboxStatePending {
+			t.Fatalf("unexpected outbox entry: %+v", entry)
+		}
+
+		// the entry is leased
+		if other, err := r.ClaimOutboxEntry(ctx, time.Minute); err != nil || other != nil {
+			t.Fatalf("expected no claimable entry while leased, got %+v (%v)", other, err)
+		}
+
+		// a failed attempt is retried at the given time
+		if err := r.FailOutboxEntry(ctx, entry.ID, []string{"alice"}, "boom", time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("failed to fail outbox entry: %s", err)
+		}
+
+		entry, err = r.ClaimOutboxEntry(ctx, time.Millisecond)
+		if err != nil {
+			t.Fatalf("failed to claim outbox entry: %s", err)
+		}
+
+		if entry == nil || entry.Attempts != 2 || entry.LastError != "boom" || !slices.Equal(entry.DeliveredTo, []string{"alice"}) {
+			t.Fatalf("unexpected outbox entry after failure: %+v", entry)
+		}
+
+		// expired leases make the entry due again
+		time.Sleep(50 * time.Millisecond)
+
+		entry, err = r.ClaimOutboxEntry(ctx, time.Minute)
+		if err != nil {
+			t.Fatalf("failed to claim outbox entry: %s", err)
+		}
+
+		if entry == nil || entry.Attempts != 3 {
+			t.Fatalf("expected the entry to be claimable after the lease expired, got %+v", entry)
+		}
+
+		if err := r.CompleteOutboxEntry(ctx, entry.ID, []string{"alice", "bob"}); err != nil {
+			t.Fatalf("failed to complete outbox entry: %s", err)
+		}
+
+		if other, err := r.ClaimOutboxEntry(ctx, time.Minute); err != nil || other != nil {
+			t.Fatalf("expected no claimable entry after completion, got %+v (%v)", other, err)
+		}
+
+		delivered, err := r.ListOutboxEntries(ctx, models.OutboxStateDelivered)
+		if err != nil {
+			t.Fatalf("failed to list outbox entries: %s", err)
+		}
+
+		if len(delivered) != 1 || delivered[0].ID != entry.ID || !slices.Equal(delivered[0].DeliveredTo, []string{"alice", "bob"}) || delivered[0].LastError != "" {
+			t.Errorf("unexpected delivered entries: %+v", delivered)
+		}
+
+		// delivered entries cannot be retried or discarded
+		_, err = r.RetryOutboxEntry(ctx, entry.ID.Hex())
+		requireCode(t, err, connect.CodeFailedPrecondition)
+
+		_, err = r.DiscardOutboxEntry(ctx, primitive.NewObjectID().Hex())
+		requireCode(t, err, connect.CodeNotFound)
+
+		// entries that failed too often need to be retried manually
+		f.comment(1, models.Comment{Scope: "patients", Content: "fails"})
+
+		entry, err = r.ClaimOutboxEntry(ctx, time.Minute)
+		if err != nil || entry == nil {
+			t.Fatalf("failed to claim outbox entry: %+v (%v)", entry, err)
+		}
+
+		if err := r.FailOutboxEntry(ctx, entry.ID, nil, "gave up", time.Time{}); err != nil {
+			t.Fatalf("failed to fail outbox entry: %s", err)
+		}
+
+		if other, err := r.ClaimOutboxEntry(ctx, time.Minute); err != nil || other != nil {
+			t.Fatalf("expected failed entries not to be claimable, got %+v (%v)", other, err)
+		}
+
+		retried, err := r.RetryOutboxEntry(ctx, entry.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to retry outbox entry: %s", err)
+		}
+
+		if retried.State != models.OutboxStatePending || retried.Attempts != 0 {
+			t.Errorf("unexpected retried entry: %+v", retried)
+		}
+
+		discarded, err := r.DiscardOutboxEntry(ctx, entry.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to discard outbox entry: %s", err)
+		}
+
+		if discarded.State != models.OutboxStateDiscarded {
+			t.Errorf("unexpected discarded entry: %+v", discarded)
+		}
+
+		if other, err := r.ClaimOutboxEntry(ctx, time.Minute); err != nil || other != nil {
+			t.Fatalf("expected discarded entries not to be claimable, got %+v (%v)", other, err)
+		}
+	})
+}
+
+func TestConformanceImport(t *testing.T) {
+	runConformance(t, func(t *testing.T, r Repository) {
+		ctx := context.Background()
+		f := newFixture(t, r, "patients", "other")
+
+		existing := f.comment(0, models.Comment{Scope: "patients", Content: "existing"})
+
+		root := models.Comment{ID: primitive.NewObjectID(), Scope: "patients", Content: "imported", CreatorID: "bob", CreatedAt: f.base}
+		answer := models.Comment{ID: primitive.NewObjectID(), Scope: "patients", ParentID: root.ID, Content: "imported answer", CreatorID: "bob", CreatedAt: f.base}
+
+		updated := existing
+		updated.Content = "replaced"
+
+		n, err := r.ImportComments(ctx, []models.Comment{updated, root, answer}, false)
+		if err != nil {
+			t.Fatalf("failed to import comments: %s", err)
+		}
+
+		if n != 2 {
+			t.Errorf("expected 2 imported comments, got %d", n)
+		}
+
+		if c, _ := r.GetComment(ctx, existing.ID.Hex()); c.Content != "existing" {
+			t.Errorf("expected the existing comment to be skipped, got %q", c.Content)
+		}
+
+		n, err = r.ImportComments(ctx, []models.Comment{updated}, true)
+		if err != nil {
+			t.Fatalf("failed to import comments: %s", err)
+		}
+
+		if c, _ := r.GetComment(ctx, existing.ID.Hex()); n != 1 || c.Content != "replaced" {
+			t.Errorf("expected the existing comment to be replaced, got %q (%d)", c.Content, n)
+		}
+
+		// comments of other scopes are neither skipped nor replaced
+		foreign := existing
+		foreign.Scope = "other"
+		foreign.Content = "taken over"
+
+		for _, overwrite := range []bool{false, true} {
+			_, err := r.ImportComments(ctx, []models.Comment{foreign}, overwrite)
+			requireCode(t, err, connect.CodeAlreadyExists)
+		}
+
+		c, err := r.GetComment(ctx, existing.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to get comment: %s", err)
+		}
+
+		if c.Scope != "patients" || c.Content != "replaced" {
+			t.Errorf("expected the comment to stay in its scope, got %+v", c)
+		}
+	})
+}
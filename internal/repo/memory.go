@@ -0,0 +1,193 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryRepository implements Repository in memory. It's meant for local
+// development and tests, all data is lost when the process exits.
+//
+// Values are copied when they are stored or returned so callers can never
+// modify the stored data by accident.
+type MemoryRepository struct {
+	l sync.RWMutex
+
+	scopes    map[string]models.Scope
+	comments  map[primitive.ObjectID]models.Comment
+	revisions map[primitive.ObjectID][]models.CommentRevision
+	outbox    map[primitive.ObjectID]models.OutboxEntry
+
+	subscriptions map[primitive.ObjectID]models.Subscription
+
+	webhooks          map[primitive.ObjectID]models.Webhook
+	webhookDeliveries map[primitive.ObjectID]models.WebhookDelivery
+}
+
+// NewMemoryRepository returns a new, empty in-memory repository.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		scopes:            make(map[string]models.Scope),
+		comments:          make(map[primitive.ObjectID]models.Comment),
+		revisions:         make(map[primitive.ObjectID][]models.CommentRevision),
+		outbox:            make(map[primitive.ObjectID]models.OutboxEntry),
+		subscriptions:     make(map[primitive.ObjectID]models.Subscription),
+		webhooks:          make(map[primitive.ObjectID]models.Webhook),
+		webhookDeliveries: make(map[primitive.ObjectID]models.WebhookDelivery),
+	}
+}
+
+func (r *MemoryRepository) CreateScope(ctx context.Context, model *models.Scope) (id string, err error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if model.InternalID.IsZero() {
+		model.InternalID = primitive.NewObjectID()
+	}
+
+	if err := r.checkScopeUnique(*model, ""); err != nil {
+		return "", err
+	}
+
+	r.scopes[model.ID] = cloneScope(*model)
+
+	return model.InternalID.Hex(), nil
+}
+
+func (r *MemoryRepository) UpdateScope(ctx context.Context, id string, model *models.Scope) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	existing, ok := r.scopes[id]
+	if !ok {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("scope id not found"))
+	}
+
+	if err := r.checkScopeUnique(*model, id); err != nil {
+		return err
+	}
+
+	scope := cloneScope(*model)
+	scope.InternalID = existing.InternalID
+
+	delete(r.scopes, id)
+	r.scopes[scope.ID] = scope
+
+	return nil
+}
+
+// checkScopeUnique mimics the unique indexes on the scope ID and name. The
+// scope with the ID ignore is not considered.
+func (r *MemoryRepository) checkScopeUnique(model models.Scope, ignore string) error {
+	for _, s := range r.scopes {
+		if s.ID == ignore {
+			continue
+		}
+
+		if s.ID == model.ID || s.Name == model.Name {
+			return connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("scope id already exists"))
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) GetScopeByID(ctx context.Context, id string) (models.Scope, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	scope, ok := r.scopes[id]
+	if !ok {
+		return models.Scope{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("failed to find scope"))
+	}
+
+	return cloneScope(scope), nil
+}
+
+func (r *MemoryRepository) DeleteScope(ctx context.Context, id string, recurseComment bool) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if _, ok := r.scopes[id]; !ok {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("scope not found"))
+	}
+
+	delete(r.scopes, id)
+
+	if !recurseComment {
+		return nil
+	}
+
+	for commentId, c := range r.comments {
+		if c.Scope != id {
+			continue
+		}
+
+		delete(r.revisions, commentId)
+		delete(r.comments, commentId)
+	}
+
+	for subId, s := range r.subscriptions {
+		if s.Scope == id {
+			delete(r.subscriptions, subId)
+		}
+	}
+
+	for webhookId, w := range r.webhooks {
+		if w.Scope == id {
+			r.deleteWebhook(webhookId)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListScopes(ctx context.Context) ([]models.Scope, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	result := make([]models.Scope, 0, len(r.scopes))
+	for _, s := range r.scopes {
+		result = append(result, cloneScope(s))
+	}
+
+	// return scopes in the order they have been created
+	slices.SortFunc(result, func(a, b models.Scope) int {
+		return bytes.Compare(a.InternalID[:], b.InternalID[:])
+	})
+
+	return result, nil
+}
+
+func cloneScope(s models.Scope) models.Scope {
+	s.OwnerIDs = slices.Clone(s.OwnerIDs)
+	s.ReaderRoles = slices.Clone(s.ReaderRoles)
+	s.WriterRoles = slices.Clone(s.WriterRoles)
+
+	return s
+}
+
+// pruneExpired removes delivered outbox entries and webhook deliveries that
+// are past their retention period, like the TTL indexes of the mongo
+// collections do.
+func (r *MemoryRepository) pruneExpired(now time.Time) {
+	for id, e := range r.outbox {
+		if e.State == models.OutboxStateDelivered && now.Sub(e.UpdatedAt) > outboxRetention {
+			delete(r.outbox, id)
+		}
+	}
+
+	for id, d := range r.webhookDeliveries {
+		if now.Sub(d.CreatedAt) > webhookDeliveryRetention {
+			delete(r.webhookDeliveries, id)
+		}
+	}
+}
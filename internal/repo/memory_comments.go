@@ -0,0 +1,551 @@
+package repo
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (r *MemoryRepository) CreateComment(ctx context.Context, model models.Comment) (string, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	// verify that the scope actually exists
+	if _, ok := r.scopes[model.Scope]; !ok {
+		return "", connect.NewError(connect.CodeNotFound, fmt.Errorf("failed to find scope"))
+	}
+
+	if model.ID.IsZero() {
+		model.ID = primitive.NewObjectID()
+	}
+
+	if _, ok := r.comments[model.ID]; ok {
+		return "", connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("comment id already exists"))
+	}
+
+	// nothing is written unless the webhook payloads can be encoded
+	if err := r.enqueueWebhooks(events.Created, model); err != nil {
+		return "", err
+	}
+
+	r.comments[model.ID] = cloneComment(model)
+	r.createOutboxEntry(model.ID)
+
+	return model.ID.Hex(), nil
+}
+
+func (r *MemoryRepository) ImportComments(ctx context.Context, comments []models.Comment, overwrite bool) (int, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	for _, c := range comments {
+		if existing, ok := r.comments[c.ID]; ok && existing.Scope != c.Scope {
+			return 0, errCommentInOtherScope(c.ID)
+		}
+	}
+
+	written := 0
+
+	for _, c := range comments {
+		if _, ok := r.comments[c.ID]; ok && !overwrite {
+			continue
+		}
+
+		r.comments[c.ID] = cloneComment(c)
+		written++
+	}
+
+	return written, nil
+}
+
+func (r *MemoryRepository) GetComment(ctx context.Context, id string) (models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	c, ok := r.comments[oid]
+	if !ok {
+		return models.Comment{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	return cloneComment(c), nil
+}
+
+func (r *MemoryRepository) GetParentComments(ctx context.Context, id string) ([]models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	c, ok := r.comments[oid]
+	if !ok {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	return r.ancestors(c, true), nil
+}
+
+// ancestors returns all parent comments of c. If includeSelf is set, c is
+// returned as the first element.
+func (r *MemoryRepository) ancestors(c models.Comment, includeSelf bool) []models.Comment {
+	var result []models.Comment
+	if includeSelf {
+		result = append(result, cloneComment(c))
+	}
+
+	seen := map[primitive.ObjectID]struct{}{c.ID: {}}
+	for !c.ParentID.IsZero() {
+		parent, ok := r.comments[c.ParentID]
+		if !ok {
+			break
+		}
+
+		// guard against cycles in corrupted data
+		if _, ok := seen[parent.ID]; ok {
+			break
+		}
+		seen[parent.ID] = struct{}{}
+
+		result = append(result, cloneComment(parent))
+		c = parent
+	}
+
+	return result
+}
+
+func (r *MemoryRepository) GetCommentTreeFromCommentID(ctx context.Context, id string) (*models.CommentTree, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	c, ok := r.comments[oid]
+	if !ok {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	return r.buildTree(c, r.answersByParent())
+}
+
+func (r *MemoryRepository) GetCommentTreeByScope(ctx context.Context, scopeId string, reference string) ([]*models.CommentTree, error) {
+	trees, _, err := r.ListCommentTrees(ctx, scopeId, reference, ListOptions{})
+
+	return trees, err
+}
+
+// ListCommentTrees works like MongoRepository.ListCommentTrees.
+func (r *MemoryRepository) ListCommentTrees(ctx context.Context, scopeId string, reference string, opts ListOptions) (trees []*models.CommentTree, nextPageToken string, err error) {
+	var token *pageToken
+	if opts.PageToken != "" {
+		token, err = decodePageToken(opts.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if token.Descending != opts.Descending {
+			return nil, "", connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("page token does not match the requested sort order"))
+		}
+	}
+
+	direction := 1
+	if opts.Descending {
+		direction = -1
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var roots []models.Comment
+	for _, c := range r.comments {
+		if c.Scope != scopeId || !c.ParentID.IsZero() {
+			continue
+		}
+
+		if reference != "" && c.Reference != reference {
+			continue
+		}
+
+		if token != nil && compareCursor(c.CreatedAt, c.ID, token.CreatedAt, token.ID)*direction <= 0 {
+			continue
+		}
+
+		roots = append(roots, c)
+	}
+
+	slices.SortFunc(roots, func(a, b models.Comment) int {
+		return compareCursor(a.CreatedAt, a.ID, b.CreatedAt, b.ID) * direction
+	})
+
+	if opts.PageSize > 0 && len(roots) > opts.PageSize {
+		roots = roots[:opts.PageSize]
+
+		last := roots[len(roots)-1]
+		nextPageToken = pageToken{
+			CreatedAt:  last.CreatedAt,
+			ID:         last.ID,
+			Descending: opts.Descending,
+		}.encode()
+	}
+
+	answers := r.answersByParent()
+
+	trees = make([]*models.CommentTree, len(roots))
+	for idx, c := range roots {
+		trees[idx], err = r.buildTree(c, answers)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to build comment tree for %q: %w", c.ID.Hex(), err)
+		}
+	}
+
+	return trees, nextPageToken, nil
+}
+
+// compareCursor orders comments by creation time and ID, the same way root
+// comments are sorted by ListCommentTrees.
+func compareCursor(aCreatedAt time.Time, aID primitive.ObjectID, bCreatedAt time.Time, bID primitive.ObjectID) int {
+	if c := aCreatedAt.Compare(bCreatedAt); c != 0 {
+		return c
+	}
+
+	return bytes.Compare(aID[:], bID[:])
+}
+
+// answersByParent returns all comments indexed by their parent ID.
+func (r *MemoryRepository) answersByParent() map[primitive.ObjectID][]models.Comment {
+	result := make(map[primitive.ObjectID][]models.Comment)
+
+	for _, c := range r.comments {
+		if !c.ParentID.IsZero() {
+			result[c.ParentID] = append(result[c.ParentID], c)
+		}
+	}
+
+	return result
+}
+
+// buildTree returns the comment tree of c. It uses the same code as the mongo
+// repository so both return identical trees.
+func (r *MemoryRepository) buildTree(c models.Comment, answers map[primitive.ObjectID][]models.Comment) (*models.CommentTree, error) {
+	tr := treeResult{
+		Comment: cloneComment(c),
+	}
+
+	queue := []primitive.ObjectID{c.ID}
+	seen := map[primitive.ObjectID]struct{}{c.ID: {}}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		for _, answer := range answers[id] {
+			if _, ok := seen[answer.ID]; ok {
+				continue
+			}
+			seen[answer.ID] = struct{}{}
+
+			tr.Tree = append(tr.Tree, cloneComment(answer))
+			queue = append(queue, answer.ID)
+		}
+	}
+
+	return tr.buildCommentTree()
+}
+
+func (r *MemoryRepository) UpdateCommentContent(ctx context.Context, id string, content string, mentions []string, editorId string) (models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	comment, ok := r.comments[oid]
+	if !ok {
+		return models.Comment{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	now := time.Now()
+
+	revision := models.CommentRevision{
+		ID:        primitive.NewObjectID(),
+		CommentID: oid,
+		Content:   comment.Content,
+		EditedAt:  now,
+		EditorID:  editorId,
+	}
+
+	comment.Content = content
+	comment.Mentions = slices.Clone(mentions)
+	comment.CanonicalMentions = true
+	comment.UpdatedAt = now
+	comment.RevisionCount++
+
+	if err := r.enqueueWebhooks(events.Edited, comment); err != nil {
+		return models.Comment{}, err
+	}
+
+	r.revisions[oid] = append(r.revisions[oid], revision)
+	r.comments[oid] = comment
+
+	return cloneComment(comment), nil
+}
+
+func (r *MemoryRepository) ListCommentRevisions(ctx context.Context, id string) ([]models.CommentRevision, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	// revisions are appended in chronological order
+	return slices.Clone(r.revisions[oid]), nil
+}
+
+func (r *MemoryRepository) SoftDeleteComment(ctx context.Context, id string, userId string) (models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	comment, ok := r.comments[oid]
+	if !ok {
+		return models.Comment{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	if comment.Deleted() {
+		return models.Comment{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("comment has already been deleted"))
+	}
+
+	comment.Content = models.TombstoneContent
+	comment.DeletedAt = time.Now()
+	comment.DeletedBy = userId
+
+	if err := r.enqueueWebhooks(events.Deleted, comment); err != nil {
+		return models.Comment{}, err
+	}
+
+	r.comments[oid] = comment
+
+	return cloneComment(comment), nil
+}
+
+func (r *MemoryRepository) PurgeCommentTree(ctx context.Context, id string, userId string) (int64, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	c, ok := r.comments[oid]
+	if !ok {
+		return 0, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	tree, err := r.buildTree(c, r.answersByParent())
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make(map[primitive.ObjectID]struct{})
+
+	var collect func(t *models.CommentTree)
+	collect = func(t *models.CommentTree) {
+		ids[t.Comment.ID] = struct{}{}
+
+		for _, answer := range t.Answers {
+			collect(answer)
+		}
+	}
+	collect(tree)
+
+	c.Content = models.TombstoneContent
+	c.DeletedAt = time.Now()
+	c.DeletedBy = userId
+
+	if err := r.enqueueWebhooks(events.Deleted, c); err != nil {
+		return 0, err
+	}
+
+	for id := range ids {
+		delete(r.comments, id)
+		delete(r.revisions, id)
+	}
+
+	for subId, s := range r.subscriptions {
+		if _, ok := ids[s.RootID]; ok {
+			delete(r.subscriptions, subId)
+		}
+	}
+
+	return int64(len(ids)), nil
+}
+
+// SearchComments approximates the mongo $text search: the query is split
+// into words, "quoted phrases" and -negated words. A comment matches if it
+// contains all phrases (or at least one of the words if there are no phrases)
+// and none of the negated words. Matching is case-insensitive and the score is the number of matched
+// words.
+func (r *MemoryRepository) SearchComments(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	query := parseTextQuery(q.Text)
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var hits []SearchResult
+	for _, c := range r.comments {
+		if c.Deleted() {
+			continue
+		}
+
+		switch {
+		case q.Scope != "":
+			if c.Scope != q.Scope {
+				continue
+			}
+		case q.Scopes != nil:
+			if !slices.Contains(q.Scopes, c.Scope) {
+				continue
+			}
+		}
+
+		if q.Reference != "" && c.Reference != q.Reference {
+			continue
+		}
+
+		if q.CreatorID != "" && c.CreatorID != q.CreatorID {
+			continue
+		}
+
+		if !q.CreatedAfter.IsZero() && c.CreatedAt.Before(q.CreatedAfter) {
+			continue
+		}
+
+		if !q.CreatedBefore.IsZero() && !c.CreatedAt.Before(q.CreatedBefore) {
+			continue
+		}
+
+		score, ok := query.match(c.Content)
+		if !ok {
+			continue
+		}
+
+		hit := SearchResult{
+			Comment: cloneComment(c),
+			Score:   score,
+			RootID:  c.ID,
+		}
+
+		if ancestors := r.ancestors(c, false); len(ancestors) > 0 {
+			hit.RootID = ancestors[len(ancestors)-1].ID
+		}
+
+		hits = append(hits, hit)
+	}
+
+	slices.SortFunc(hits, func(a, b SearchResult) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+
+		return compareCursor(b.Comment.CreatedAt, b.Comment.ID, a.Comment.CreatedAt, a.Comment.ID)
+	})
+
+	if q.Offset > 0 {
+		hits = hits[min(q.Offset, len(hits)):]
+	}
+
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+
+	return hits, nil
+}
+
+func (r *MemoryRepository) AddReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error) {
+	return r.updateReactions(id, func(c *models.Comment) error {
+		if c.Deleted() {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("cannot react to a deleted comment"))
+		}
+
+		for _, reaction := range c.Reactions {
+			if reaction.Emoji == emoji && reaction.UserID == userId {
+				return nil
+			}
+		}
+
+		c.Reactions = append(c.Reactions, models.Reaction{
+			Emoji:     emoji,
+			UserID:    userId,
+			CreatedAt: time.Now(),
+		})
+
+		return nil
+	})
+}
+
+func (r *MemoryRepository) RemoveReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error) {
+	return r.updateReactions(id, func(c *models.Comment) error {
+		c.Reactions = slices.DeleteFunc(c.Reactions, func(reaction models.Reaction) bool {
+			return reaction.Emoji == emoji && reaction.UserID == userId
+		})
+
+		return nil
+	})
+}
+
+func (r *MemoryRepository) updateReactions(id string, fn func(c *models.Comment) error) (models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	c, ok := r.comments[oid]
+	if !ok {
+		return models.Comment{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	c = cloneComment(c)
+	if err := fn(&c); err != nil {
+		return models.Comment{}, err
+	}
+
+	r.comments[oid] = c
+
+	return cloneComment(c), nil
+}
+
+func cloneComment(c models.Comment) models.Comment {
+	c.Reactions = slices.Clone(c.Reactions)
+	c.Mentions = slices.Clone(c.Mentions)
+
+	return c
+}
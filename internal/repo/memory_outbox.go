@@ -0,0 +1,170 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (r *MemoryRepository) createOutboxEntry(commentId primitive.ObjectID) {
+	now := time.Now()
+
+	entry := models.OutboxEntry{
+		ID:            primitive.NewObjectID(),
+		CommentID:     commentId,
+		State:         models.OutboxStatePending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	r.outbox[entry.ID] = entry
+}
+
+func (r *MemoryRepository) ClaimOutboxEntry(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	now := time.Now()
+	r.pruneExpired(now)
+
+	var (
+		next  models.OutboxEntry
+		found bool
+	)
+	for _, e := range r.outbox {
+		if e.State != models.OutboxStatePending || e.NextAttemptAt.After(now) {
+			continue
+		}
+
+		if !found || e.NextAttemptAt.Before(next.NextAttemptAt) {
+			next = e
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	next.NextAttemptAt = now.Add(lease)
+	next.UpdatedAt = now
+	next.Attempts++
+
+	r.outbox[next.ID] = next
+
+	entry := cloneOutboxEntry(next)
+
+	return &entry, nil
+}
+
+func (r *MemoryRepository) CompleteOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if e, ok := r.outbox[id]; ok {
+		e.State = models.OutboxStateDelivered
+		e.DeliveredTo = slices.Clone(deliveredTo)
+		e.LastError = ""
+		e.UpdatedAt = time.Now()
+
+		r.outbox[id] = e
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) FailOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string, reason string, nextAttempt time.Time) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if e, ok := r.outbox[id]; ok {
+		e.DeliveredTo = slices.Clone(deliveredTo)
+		e.LastError = reason
+		e.UpdatedAt = time.Now()
+
+		if nextAttempt.IsZero() {
+			e.State = models.OutboxStateFailed
+		} else {
+			e.NextAttemptAt = nextAttempt
+		}
+
+		r.outbox[id] = e
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListOutboxEntries(ctx context.Context, state models.OutboxState) ([]models.OutboxEntry, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var result []models.OutboxEntry
+	for _, e := range r.outbox {
+		if e.State == state {
+			result = append(result, cloneOutboxEntry(e))
+		}
+	}
+
+	slices.SortFunc(result, func(a, b models.OutboxEntry) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+
+	return result, nil
+}
+
+func (r *MemoryRepository) RetryOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error) {
+	return r.transitionOutboxEntry(id, []models.OutboxState{models.OutboxStateFailed, models.OutboxStateDiscarded}, func(e *models.OutboxEntry) {
+		e.State = models.OutboxStatePending
+		e.Attempts = 0
+		e.NextAttemptAt = time.Now()
+	})
+}
+
+func (r *MemoryRepository) DiscardOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error) {
+	return r.transitionOutboxEntry(id, []models.OutboxState{models.OutboxStatePending, models.OutboxStateFailed}, func(e *models.OutboxEntry) {
+		e.State = models.OutboxStateDiscarded
+	})
+}
+
+func (r *MemoryRepository) transitionOutboxEntry(id string, from []models.OutboxState, update func(e *models.OutboxEntry)) (models.OutboxEntry, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.OutboxEntry{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	e, ok := r.outbox[oid]
+	if !ok {
+		return models.OutboxEntry{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("outbox entry not found"))
+	}
+
+	if !slices.Contains(from, e.State) {
+		return models.OutboxEntry{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("outbox entry is not in one of the states %v", from))
+	}
+
+	update(&e)
+	e.UpdatedAt = time.Now()
+
+	r.outbox[oid] = e
+
+	return cloneOutboxEntry(e), nil
+}
+
+func cloneOutboxEntry(e models.OutboxEntry) models.OutboxEntry {
+	e.DeliveredTo = slices.Clone(e.DeliveredTo)
+
+	return e
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (r *MemoryRepository) findSubscription(userId string, target models.SubscriptionTarget) (models.Subscription, bool) {
+	for _, s := range r.subscriptions {
+		if s.UserID == userId && s.SubscriptionTarget == target {
+			return s, true
+		}
+	}
+
+	return models.Subscription{}, false
+}
+
+func (r *MemoryRepository) SetSubscription(ctx context.Context, userId string, target models.SubscriptionTarget, state models.SubscriptionState) (models.Subscription, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	sub, ok := r.findSubscription(userId, target)
+	if !ok {
+		sub = models.Subscription{
+			ID:                 primitive.NewObjectID(),
+			UserID:             userId,
+			SubscriptionTarget: target,
+		}
+	}
+
+	sub.State = state
+	sub.UpdatedAt = time.Now()
+
+	r.subscriptions[sub.ID] = sub
+
+	return sub, nil
+}
+
+func (r *MemoryRepository) DeleteSubscription(ctx context.Context, userId string, target models.SubscriptionTarget) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	sub, ok := r.findSubscription(userId, target)
+	if !ok {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("subscription not found"))
+	}
+
+	delete(r.subscriptions, sub.ID)
+
+	return nil
+}
+
+func (r *MemoryRepository) ListUserSubscriptions(ctx context.Context, userId string) ([]models.Subscription, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var result []models.Subscription
+	for _, s := range r.subscriptions {
+		if s.UserID == userId {
+			result = append(result, s)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b models.Subscription) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	return result, nil
+}
+
+func (r *MemoryRepository) FindSubscriptions(ctx context.Context, scope string, reference string, rootId primitive.ObjectID) ([]models.Subscription, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var result []models.Subscription
+	for _, s := range r.subscriptions {
+		if s.Scope != scope {
+			continue
+		}
+
+		switch {
+		case s.RootID == rootId,
+			s.Reference == "" && s.RootID.IsZero(),
+			reference != "" && s.Reference == reference && s.RootID.IsZero():
+
+			result = append(result, s)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,261 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (r *MemoryRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+
+	if _, ok := r.webhooks[webhook.ID]; ok {
+		return connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("webhook id already exists"))
+	}
+
+	r.webhooks[webhook.ID] = cloneWebhook(*webhook)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Webhook{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	webhook, ok := r.webhooks[oid]
+	if !ok {
+		return models.Webhook{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook not found"))
+	}
+
+	return cloneWebhook(webhook), nil
+}
+
+func (r *MemoryRepository) ListWebhooks(ctx context.Context, scopeId string) ([]models.Webhook, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var result []models.Webhook
+	for _, w := range r.webhooks {
+		if w.Scope == scopeId {
+			result = append(result, cloneWebhook(w))
+		}
+	}
+
+	slices.SortFunc(result, func(a, b models.Webhook) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+
+	return result, nil
+}
+
+func (r *MemoryRepository) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook not found"))
+	}
+
+	r.deleteWebhook(id)
+
+	return nil
+}
+
+// deleteWebhook deletes the webhook with id and it's delivery log. The caller
+// must hold the write lock.
+func (r *MemoryRepository) deleteWebhook(id primitive.ObjectID) {
+	delete(r.webhooks, id)
+
+	for deliveryId, d := range r.webhookDeliveries {
+		if d.WebhookID == id {
+			delete(r.webhookDeliveries, deliveryId)
+		}
+	}
+}
+
+// enqueueWebhooks stores a pending delivery of t for all webhooks of the
+// comment's scope. The caller must hold the write lock.
+func (r *MemoryRepository) enqueueWebhooks(t events.Type, comment models.Comment) error {
+	var webhooks []models.Webhook
+	for _, w := range r.webhooks {
+		if w.Scope == comment.Scope {
+			webhooks = append(webhooks, w)
+		}
+	}
+
+	deliveries, err := models.NewWebhookDeliveries(webhooks, string(t), comment)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		r.webhookDeliveries[d.ID] = d
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	now := time.Now()
+	r.pruneExpired(now)
+
+	var (
+		next  models.WebhookDelivery
+		found bool
+	)
+	for _, d := range r.webhookDeliveries {
+		if d.State != models.WebhookDeliveryStatePending || d.NextAttemptAt.After(now) {
+			continue
+		}
+
+		if !found || d.NextAttemptAt.Before(next.NextAttemptAt) {
+			next = d
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	next.NextAttemptAt = now.Add(lease)
+	next.UpdatedAt = now
+	next.Attempts++
+
+	r.webhookDeliveries[next.ID] = next
+
+	return &next, nil
+}
+
+func (r *MemoryRepository) CompleteWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if d, ok := r.webhookDeliveries[id]; ok {
+		d.State = models.WebhookDeliveryStateDelivered
+		d.LastStatusCode = statusCode
+		d.LastError = ""
+		d.UpdatedAt = time.Now()
+
+		r.webhookDeliveries[id] = d
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) FailWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int, reason string, nextAttempt time.Time) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if d, ok := r.webhookDeliveries[id]; ok {
+		d.LastStatusCode = statusCode
+		d.LastError = reason
+		d.UpdatedAt = time.Now()
+
+		if nextAttempt.IsZero() {
+			d.State = models.WebhookDeliveryStateFailed
+		} else {
+			d.NextAttemptAt = nextAttempt
+		}
+
+		r.webhookDeliveries[id] = d
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListWebhookDeliveries(ctx context.Context, webhookId primitive.ObjectID, state models.WebhookDeliveryState, limit int) ([]models.WebhookDelivery, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var result []models.WebhookDelivery
+	for _, d := range r.webhookDeliveries {
+		if d.WebhookID != webhookId || (state != "" && d.State != state) {
+			continue
+		}
+
+		result = append(result, d)
+	}
+
+	slices.SortFunc(result, func(a, b models.WebhookDelivery) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+
+		return bytes.Compare(b.ID[:], a.ID[:])
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func (r *MemoryRepository) GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.WebhookDelivery{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	d, ok := r.webhookDeliveries[oid]
+	if !ok {
+		return models.WebhookDelivery{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook delivery not found"))
+	}
+
+	return d, nil
+}
+
+func (r *MemoryRepository) RetryWebhookDelivery(ctx context.Context, id primitive.ObjectID) (models.WebhookDelivery, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	d, ok := r.webhookDeliveries[id]
+	if !ok || d.State != models.WebhookDeliveryStateFailed {
+		return models.WebhookDelivery{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("only failed webhook deliveries can be retried"))
+	}
+
+	now := time.Now()
+
+	d.State = models.WebhookDeliveryStatePending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	d.UpdatedAt = now
+
+	r.webhookDeliveries[id] = d
+
+	return d, nil
+}
+
+func cloneWebhook(w models.Webhook) models.Webhook {
+	w.Events = slices.Clone(w.Events)
+
+	return w
+}
@@ -0,0 +1,348 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigration is a versioned change to the MongoDB collections. Besides
+// managing indexes, up may be used to backfill or rewrite documents.
+//
+// Migrations must be idempotent: if multiple replicas start at the same time
+// a migration may be applied more than once before it is recorded.
+type mongoMigration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, r *MongoRepository) error
+}
+
+// appliedMigration is the document stored in MigrationCollection for each
+// applied migration.
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// mongoMigrations holds all migrations ordered by version. Never change or
+// remove an existing migration, add a new one instead.
+var mongoMigrations = []mongoMigration{
+	{
+		version: 1,
+		name:    "initial indexes",
+		up:      createInitialIndexes,
+	},
+	{
+		version: 2,
+		name:    "comment query indexes",
+		up:      createCommentIndexes,
+	},
+	{
+		version: 3,
+		name:    "normalize comment fields",
+		up:      normalizeCommentFields,
+	},
+}
+
+// Migrate applies all migrations that have not been recorded in the
+// migration collection yet.
+func (r *MongoRepository) Migrate(ctx context.Context) error {
+	cursor, err := r.migrations.Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to find applied migrations: %w", err)
+	}
+
+	var applied []appliedMigration
+	if err := cursor.All(ctx, &applied); err != nil {
+		return fmt.Errorf("failed to decode applied migrations: %w", err)
+	}
+
+	done := make(map[int]bool, len(applied))
+	for _, m := range applied {
+		done[m.Version] = true
+	}
+
+	for _, m := range mongoMigrations {
+		if done[m.version] {
+			continue
+		}
+
+		log.L(ctx).Infof("applying database migration %d (%s)", m.version, m.name)
+
+		if err := m.up(ctx, r); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+
+		_, err := r.migrations.InsertOne(ctx, appliedMigration{
+			Version:   m.version,
+			Name:      m.name,
+			AppliedAt: time.Now(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to record migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// dropIndex drops the index name from coll. It's not an error if the index
+// or the collection does not exist.
+func dropIndex(ctx context.Context, coll *mongo.Collection, name string) error {
+	_, err := coll.Indexes().DropOne(ctx, name)
+	if err == nil {
+		return nil
+	}
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound") {
+		return nil
+	}
+
+	return fmt.Errorf("failed to drop index %q: %w", name, err)
+}
+
+func createInitialIndexes(ctx context.Context, repo *MongoRepository) error {
+	_, err := repo.comments.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "content", Value: "text"},
+				},
+				// comments are written in different languages, so disable
+				// stemming and stop-words.
+				Options: options.Index().SetName("content_text").SetDefaultLanguage("none"),
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create comment indexes: %w", err)
+	}
+
+	_, err = repo.revisions.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "commentId", Value: 1},
+					{Key: "editedAt", Value: 1},
+				},
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create revision indexes: %w", err)
+	}
+
+	_, err = repo.outbox.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "state", Value: 1},
+					{Key: "nextAttemptAt", Value: 1},
+				},
+			},
+			{
+				// delivered entries are only kept for a week
+				Keys: bson.D{
+					{Key: "updatedAt", Value: 1},
+				},
+				Options: options.Index().
+					SetExpireAfterSeconds(int32(outboxRetention / time.Second)).
+					SetPartialFilterExpression(bson.M{"state": "delivered"}),
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create outbox indexes: %w", err)
+	}
+
+	_, err = repo.subscriptions.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "scopeId", Value: 1},
+					{Key: "ref", Value: 1},
+					{Key: "rootId", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "scopeId", Value: 1},
+					{Key: "rootId", Value: 1},
+				},
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create subscription indexes: %w", err)
+	}
+
+	_, err = repo.webhooks.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "scopeId", Value: 1},
+				},
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create webhook indexes: %w", err)
+	}
+
+	_, err = repo.webhookDeliveries.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "state", Value: 1},
+					{Key: "nextAttemptAt", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "webhookId", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+			{
+				// the delivery log is kept for 30 days
+				Keys: bson.D{
+					{Key: "createdAt", Value: 1},
+				},
+				Options: options.Index().SetExpireAfterSeconds(int32(webhookDeliveryRetention / time.Second)),
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery indexes: %w", err)
+	}
+
+	_, err = repo.scopes.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "name", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				// the scope ID is the key used by all lookups. CreateScope
+				// relies on this index to reject duplicate IDs.
+				Keys: bson.D{
+					{Key: "scopeId", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create scope indexes: %w", err)
+	}
+
+	return nil
+}
+
+// createCommentIndexes replaces the creator_id index created by earlier
+// versions, which never matched a field, and adds indexes for the fields
+// used to load comment trees.
+func createCommentIndexes(ctx context.Context, repo *MongoRepository) error {
+	if err := dropIndex(ctx, repo.comments, "creator_id_1"); err != nil {
+		return err
+	}
+
+	_, err := repo.comments.Indexes().
+		CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "creatorId", Value: 1},
+				},
+			},
+			{
+				// root comments of a scope and reference, ordered by
+				// creation time for ListCommentTrees.
+				Keys: bson.D{
+					{Key: "scopeId", Value: 1},
+					{Key: "ref", Value: 1},
+					{Key: "createdAt", Value: 1},
+					{Key: "_id", Value: 1},
+				},
+			},
+			{
+				// used by $graphLookup to walk down and up comment trees.
+				Keys: bson.D{
+					{Key: "parentId", Value: 1},
+				},
+			},
+		})
+
+	if err != nil {
+		return fmt.Errorf("failed to create comment indexes: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeCommentFields rewrites comments so they match the fields used by
+// the indexes of createCommentIndexes and by ListCommentTrees:
+//
+//   - root comments are found by a missing parentId, so a null or zero
+//     parentId is removed.
+//   - comments are filtered and paginated on ref and createdAt, so a missing
+//     ref is set to the empty string and a missing createdAt is taken from
+//     the creation time encoded in the comment ID.
+//
+// Comments written by this service already have all of these fields, the
+// migration only affects documents that were imported or written by other
+// tools.
+func normalizeCommentFields(ctx context.Context, repo *MongoRepository) error {
+	_, err := repo.comments.UpdateMany(ctx, bson.M{
+		"parentId": bson.M{
+			"$in": bson.A{nil, primitive.NilObjectID},
+		},
+	}, bson.M{
+		"$unset": bson.M{
+			"parentId": "",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove empty parent IDs: %w", err)
+	}
+
+	_, err = repo.comments.UpdateMany(ctx, bson.M{
+		"ref": bson.M{
+			"$exists": false,
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"ref": "",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set missing references: %w", err)
+	}
+
+	_, err = repo.comments.UpdateMany(ctx, bson.M{
+		"createdAt": nil,
+	}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"createdAt": bson.M{
+				"$toDate": "$_id",
+			},
+		}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set missing creation times: %w", err)
+	}
+
+	return nil
+}
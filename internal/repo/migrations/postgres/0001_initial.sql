@@ -0,0 +1,114 @@
+-- All timestamps are stored as microseconds since the unix epoch and all
+-- IDs as hex encoded ObjectIDs so both SQL backends share the same code.
+
+CREATE TABLE scopes (
+    internal_id       TEXT PRIMARY KEY,
+    scope_id          TEXT NOT NULL UNIQUE,
+    name              TEXT NOT NULL UNIQUE,
+    notification_type TEXT NOT NULL DEFAULT '',
+    view_url_template TEXT NOT NULL DEFAULT '',
+    owner_ids         TEXT NOT NULL DEFAULT '[]',
+    reader_roles      TEXT NOT NULL DEFAULT '[]',
+    writer_roles      TEXT NOT NULL DEFAULT '[]',
+    html_policy       TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE comments (
+    id             TEXT PRIMARY KEY,
+    scope_id       TEXT NOT NULL,
+    ref            TEXT NOT NULL DEFAULT '',
+    content        TEXT NOT NULL,
+    parent_id      TEXT,
+    created_at     BIGINT NOT NULL,
+    creator_id     TEXT NOT NULL,
+    updated_at     BIGINT,
+    revision_count INTEGER NOT NULL DEFAULT 0,
+    deleted_at     BIGINT,
+    deleted_by     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX comments_scope_ref_created_at ON comments (scope_id, ref, created_at, id);
+CREATE INDEX comments_parent_id ON comments (parent_id);
+CREATE INDEX comments_creator_id ON comments (creator_id);
+
+-- comments are written in different languages, so disable stemming and
+-- stop-words.
+CREATE INDEX comments_content_text ON comments USING GIN (to_tsvector('simple', content));
+
+CREATE TABLE comment_reactions (
+    comment_id TEXT NOT NULL,
+    emoji      TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+
+    PRIMARY KEY (comment_id, emoji, user_id)
+);
+
+CREATE TABLE revisions (
+    id         TEXT PRIMARY KEY,
+    comment_id TEXT NOT NULL,
+    content    TEXT NOT NULL,
+    edited_at  BIGINT NOT NULL,
+    editor_id  TEXT NOT NULL
+);
+
+CREATE INDEX revisions_comment_id_edited_at ON revisions (comment_id, edited_at);
+
+CREATE TABLE outbox (
+    id              TEXT PRIMARY KEY,
+    comment_id      TEXT NOT NULL,
+    state           TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at BIGINT NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    delivered_to    TEXT NOT NULL DEFAULT '[]',
+    created_at      BIGINT NOT NULL,
+    updated_at      BIGINT NOT NULL
+);
+
+CREATE INDEX outbox_state_next_attempt_at ON outbox (state, next_attempt_at);
+
+CREATE TABLE subscriptions (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    scope_id   TEXT NOT NULL,
+    ref        TEXT NOT NULL DEFAULT '',
+    root_id    TEXT NOT NULL,
+    state      TEXT NOT NULL,
+    updated_at BIGINT NOT NULL,
+
+    UNIQUE (user_id, scope_id, ref, root_id)
+);
+
+CREATE INDEX subscriptions_scope_id_root_id ON subscriptions (scope_id, root_id);
+
+CREATE TABLE webhooks (
+    id         TEXT PRIMARY KEY,
+    scope_id   TEXT NOT NULL,
+    url        TEXT NOT NULL,
+    secret     TEXT NOT NULL,
+    events     TEXT NOT NULL DEFAULT '[]',
+    created_at BIGINT NOT NULL,
+    creator_id TEXT NOT NULL
+);
+
+CREATE INDEX webhooks_scope_id ON webhooks (scope_id);
+
+CREATE TABLE webhook_deliveries (
+    id               TEXT PRIMARY KEY,
+    webhook_id       TEXT NOT NULL,
+    event            TEXT NOT NULL,
+    comment_id       TEXT NOT NULL,
+    state            TEXT NOT NULL,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    payload          TEXT NOT NULL,
+    next_attempt_at  BIGINT NOT NULL,
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_error       TEXT NOT NULL DEFAULT '',
+    created_at       BIGINT NOT NULL,
+    updated_at       BIGINT NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_state_next_attempt_at ON webhook_deliveries (state, next_attempt_at);
+CREATE INDEX webhook_deliveries_webhook_id_created_at ON webhook_deliveries (webhook_id, created_at);
+CREATE INDEX webhook_deliveries_created_at ON webhook_deliveries (created_at);
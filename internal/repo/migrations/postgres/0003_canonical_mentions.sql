@@ -0,0 +1,3 @@
+-- set for comments whose mentions have been rewritten to user IDs. Other
+-- comments may still mention users by name.
+ALTER TABLE comments ADD COLUMN canonical_mentions BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- user IDs of all users mentioned in the comment, resolved when the comment
+-- is created or edited.
+ALTER TABLE comments ADD COLUMN mentions TEXT NOT NULL DEFAULT '[]';
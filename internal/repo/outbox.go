@@ -0,0 +1,203 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (r *MongoRepository) createOutboxEntry(ctx context.Context, commentId primitive.ObjectID) (primitive.ObjectID, error) {
+	now := time.Now()
+
+	entry := models.OutboxEntry{
+		ID:            primitive.NewObjectID(),
+		CommentID:     commentId,
+		State:         models.OutboxStatePending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if _, err := r.outbox.InsertOne(ctx, entry); err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to save outbox entry: %w", err)
+	}
+
+	return entry.ID, nil
+}
+
+// ClaimOutboxEntry returns the next pending outbox entry that is due for
+// delivery. The entry is leased for the given duration so other dispatchers
+// will not pick it up. If the lease expires without the entry being completed
+// or failed, it becomes due again. ClaimOutboxEntry returns nil if there is no
+// due entry.
+func (r *MongoRepository) ClaimOutboxEntry(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error) {
+	now := time.Now()
+
+	res := r.outbox.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"state": models.OutboxStatePending,
+			"nextAttemptAt": bson.M{
+				"$lte": now,
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"nextAttemptAt": now.Add(lease),
+				"updatedAt":     now,
+			},
+			"$inc": bson.M{
+				"attempts": 1,
+			},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+			SetReturnDocument(options.After),
+	)
+
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to claim outbox entry: %w", err)
+	}
+
+	var entry models.OutboxEntry
+	if err := res.Decode(&entry); err != nil {
+		return nil, fmt.Errorf("failed to decode outbox entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// CompleteOutboxEntry marks the outbox entry as delivered.
+func (r *MongoRepository) CompleteOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string) error {
+	_, err := r.outbox.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"state":       models.OutboxStateDelivered,
+			"deliveredTo": deliveredTo,
+			"updatedAt":   time.Now(),
+		},
+		"$unset": bson.M{
+			"lastError": "",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// FailOutboxEntry records a failed delivery attempt. If nextAttempt is zero the
+// entry is marked as failed and will not be retried automatically.
+func (r *MongoRepository) FailOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string, reason string, nextAttempt time.Time) error {
+	set := bson.M{
+		"deliveredTo": deliveredTo,
+		"lastError":   reason,
+		"updatedAt":   time.Now(),
+	}
+
+	if nextAttempt.IsZero() {
+		set["state"] = models.OutboxStateFailed
+	} else {
+		set["nextAttemptAt"] = nextAttempt
+	}
+
+	if _, err := r.outbox.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to update outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListOutboxEntries returns all outbox entries with the given state, oldest
+// first.
+func (r *MongoRepository) ListOutboxEntries(ctx context.Context, state models.OutboxState) ([]models.OutboxEntry, error) {
+	res, err := r.outbox.Find(
+		ctx,
+		bson.M{"state": state},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find outbox entries: %w", err)
+	}
+
+	var result []models.OutboxEntry
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode outbox entries: %w", err)
+	}
+
+	return result, nil
+}
+
+// RetryOutboxEntry resets a failed or discarded outbox entry so it will be
+// delivered again as soon as possible.
+func (r *MongoRepository) RetryOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error) {
+	return r.transitionOutboxEntry(ctx, id, []models.OutboxState{models.OutboxStateFailed, models.OutboxStateDiscarded}, bson.M{
+		"state":         models.OutboxStatePending,
+		"attempts":      0,
+		"nextAttemptAt": time.Now(),
+	})
+}
+
+// DiscardOutboxEntry marks a pending or failed outbox entry as discarded.
+func (r *MongoRepository) DiscardOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error) {
+	return r.transitionOutboxEntry(ctx, id, []models.OutboxState{models.OutboxStatePending, models.OutboxStateFailed}, bson.M{
+		"state": models.OutboxStateDiscarded,
+	})
+}
+
+func (r *MongoRepository) transitionOutboxEntry(ctx context.Context, id string, from []models.OutboxState, set bson.M) (models.OutboxEntry, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.OutboxEntry{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	set["updatedAt"] = time.Now()
+
+	res := r.outbox.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id": oid,
+			"state": bson.M{
+				"$in": from,
+			},
+		},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+
+	if err := res.Err(); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return models.OutboxEntry{}, fmt.Errorf("failed to update outbox entry: %w", err)
+		}
+
+		count, err := r.outbox.CountDocuments(ctx, bson.M{"_id": oid})
+		if err != nil {
+			return models.OutboxEntry{}, fmt.Errorf("failed to find outbox entry: %w", err)
+		}
+
+		if count == 0 {
+			return models.OutboxEntry{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("outbox entry not found"))
+		}
+
+		return models.OutboxEntry{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("outbox entry is not in one of the states %v", from))
+	}
+
+	var entry models.OutboxEntry
+	if err := res.Decode(&entry); err != nil {
+		return models.OutboxEntry{}, fmt.Errorf("failed to decode outbox entry: %w", err)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListOptions configures pagination and ordering of root comments.
+type ListOptions struct {
+	// PageSize limits the number of returned root comments. A zero value
+	// returns all comments.
+	PageSize int
+
+	// PageToken is the NextPageToken returned by a previous call.
+	PageToken string
+
+	// Descending sorts root comments from newest to oldest.
+	Descending bool
+}
+
+// pageToken is the keyset cursor encoded into page tokens. It points to the
+// last root comment of the previous page.
+type pageToken struct {
+	CreatedAt  time.Time          `json:"c"`
+	ID         primitive.ObjectID `json:"i"`
+	Descending bool               `json:"d,omitempty"`
+}
+
+func (pt pageToken) encode() string {
+	blob, _ := json.Marshal(pt)
+
+	return base64.RawURLEncoding.EncodeToString(blob)
+}
+
+func decodePageToken(token string) (*pageToken, error) {
+	blob, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page token: %w", err))
+	}
+
+	var pt pageToken
+	if err := json.Unmarshal(blob, &pt); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page token: %w", err))
+	}
+
+	return &pt, nil
+}
+
+// filter returns a mongo filter that matches all documents after the cursor.
+func (pt pageToken) filter() bson.M {
+	op := "$gt"
+	if pt.Descending {
+		op = "$lt"
+	}
+
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"createdAt": bson.M{op: pt.CreatedAt}},
+			bson.M{"createdAt": pt.CreatedAt, "_id": bson.M{op: pt.ID}},
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddReaction adds an emoji reaction of userId to the comment with id. Adding
+// the same reaction twice is a no-op. Reactions cannot be added to deleted
+// comments.
+func (r *MongoRepository) AddReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	filter := bson.M{
+		"_id": oid,
+		"deletedAt": bson.M{
+			"$exists": false,
+		},
+		"reactions": bson.M{
+			"$not": bson.M{
+				"$elemMatch": bson.M{
+					"emoji":  emoji,
+					"userId": userId,
+				},
+			},
+		},
+	}
+
+	update := bson.M{
+		"$push": bson.M{
+			"reactions": models.Reaction{
+				Emoji:     emoji,
+				UserID:    userId,
+				CreatedAt: time.Now(),
+			},
+		},
+	}
+
+	comment, err := r.updateReactions(ctx, filter, update)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return comment, err
+	}
+
+	// either the comment does not exist, has been deleted or the user
+	// already reacted with emoji.
+	comment, err = r.GetComment(ctx, id)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	if comment.Deleted() {
+		return models.Comment{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("cannot react to a deleted comment"))
+	}
+
+	return comment, nil
+}
+
+// RemoveReaction removes the emoji reaction of userId from the comment with
+// id. Removing a reaction that does not exist is a no-op.
+func (r *MongoRepository) RemoveReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	update := bson.M{
+		"$pull": bson.M{
+			"reactions": bson.M{
+				"emoji":  emoji,
+				"userId": userId,
+			},
+		},
+	}
+
+	comment, err := r.updateReactions(ctx, bson.M{"_id": oid}, update)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Comment{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	return comment, err
+}
+
+func (r *MongoRepository) updateReactions(ctx context.Context, filter bson.M, update bson.M) (models.Comment, error) {
+	res := r.comments.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Comment{}, err
+		}
+
+		return models.Comment{}, fmt.Errorf("failed to update reactions: %w", err)
+	}
+
+	var comment models.Comment
+	if err := res.Decode(&comment); err != nil {
+		return models.Comment{}, fmt.Errorf("failed to decode comment: %w", err)
+	}
+
+	return comment, nil
+}
@@ -3,6 +3,7 @@ package repo
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,18 +12,51 @@ import (
 )
 
 const (
-	ScopeCollection   = "scopes"
-	CommentCollection = "comments"
+	ScopeCollection        = "scopes"
+	CommentCollection      = "comments"
+	RevisionCollection     = "revisions"
+	OutboxCollection       = "outbox"
+	SubscriptionCollection = "subscriptions"
+
+	WebhookCollection         = "webhooks"
+	WebhookDeliveryCollection = "webhookDeliveries"
+
+	// MigrationCollection records the applied schema migrations.
+	MigrationCollection = "migrations"
+)
+
+const (
+	// outboxRetention is how long delivered outbox entries are kept.
+	outboxRetention = 7 * 24 * time.Hour
+
+	// webhookDeliveryRetention is how long the webhook delivery log is kept.
+	webhookDeliveryRetention = 30 * 24 * time.Hour
 )
 
-type Repository struct {
-	cli      *mongo.Client
-	db       string
-	scopes   *mongo.Collection
-	comments *mongo.Collection
+// MongoRepository implements Repository on top of MongoDB.
+type MongoRepository struct {
+	cli       *mongo.Client
+	db        string
+	scopes    *mongo.Collection
+	comments  *mongo.Collection
+	revisions *mongo.Collection
+	outbox    *mongo.Collection
+
+	subscriptions *mongo.Collection
+
+	webhooks          *mongo.Collection
+	webhookDeliveries *mongo.Collection
+
+	migrations *mongo.Collection
+
+	// transactions is set if the server supports multi-document
+	// transactions, that is, if it's a replica set member or a mongos.
+	transactions bool
 }
 
-func NewRepository(ctx context.Context, databaseURL string) (*Repository, error) {
+// NewMongoRepository connects to the MongoDB at databaseURL. Indexes are
+// managed by Migrate.
+func NewMongoRepository(ctx context.Context, databaseURL string) (*MongoRepository, error) {
 	// parse the connection string and make sure we have a database specified.
 	connStr, err := connstring.ParseAndValidate(databaseURL)
 	if err != nil {
@@ -46,53 +80,53 @@ func NewRepository(ctx context.Context, databaseURL string) (*Repository, error)
 		return nil, fmt.Errorf("failed to ping mongodb: %w", err)
 	}
 
-	r := &Repository{
-		cli:      cli,
-		db:       connStr.Database,
-		scopes:   db.Collection(ScopeCollection),
-		comments: db.Collection(CommentCollection),
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
 	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, fmt.Errorf("failed to query mongodb topology: %w", err)
+	}
+
+	r := &MongoRepository{
+		cli:       cli,
+		db:        connStr.Database,
+		scopes:    db.Collection(ScopeCollection),
+		comments:  db.Collection(CommentCollection),
+		revisions: db.Collection(RevisionCollection),
+		outbox:    db.Collection(OutboxCollection),
+
+		subscriptions: db.Collection(SubscriptionCollection),
+
+		webhooks:          db.Collection(WebhookCollection),
+		webhookDeliveries: db.Collection(WebhookDeliveryCollection),
+
+		migrations: db.Collection(MigrationCollection),
 
-	if err := r.prepare(ctx); err != nil {
-		return r, fmt.Errorf("failed to prepare collections: %w", err)
+		transactions: hello.SetName != "" || hello.Msg == "isdbgrid",
 	}
 
 	return r, nil
 }
 
-func (repo *Repository) prepare(ctx context.Context) error {
-	_, err := repo.comments.Indexes().
-		CreateMany(ctx, []mongo.IndexModel{
-			{
-				Keys: bson.D{
-					{Key: "creator_id", Value: 1},
-				},
-			},
-		})
-
-	if err != nil {
-		return fmt.Errorf("failed to create comment indexes: %w", err)
+// withTransaction executes fn in a transaction if the server supports
+// transactions. fn must use the passed context for all operations and may be
+// called more than once if the transaction is retried. On standalone servers
+// fn is executed without a transaction and must cope with partial writes.
+func (r *MongoRepository) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !r.transactions {
+		return fn(ctx)
 	}
 
-	_, err = repo.scopes.Indexes().
-		CreateMany(ctx, []mongo.IndexModel{
-			{
-				Keys: bson.D{
-					{Key: "name", Value: 1},
-				},
-				Options: options.Index().SetUnique(true),
-			},
-			{
-				Keys: bson.D{
-					{Key: "scopeId", Value: 1},
-				},
-				Options: options.Index().SetUnique(true),
-			},
-		})
-
+	session, err := r.cli.StartSession()
 	if err != nil {
-		return fmt.Errorf("failed to create scope indexes: %w", err)
+		return fmt.Errorf("failed to start session: %w", err)
 	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
 
-	return nil
+	return err
 }
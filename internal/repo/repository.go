@@ -0,0 +1,160 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Repository stores scopes, comments and everything related to them.
+// Implementations must return connect errors with a proper code (NotFound,
+// AlreadyExists, ...) so they can be passed on to API clients as is.
+//
+// Creating, editing and deleting comments enqueues webhook deliveries for
+// the webhooks of the comment's scope together with the change, so events
+// are not lost if the process crashes right after writing the comment.
+type Repository interface {
+	// Scopes
+
+	CreateScope(ctx context.Context, model *models.Scope) (id string, err error)
+	UpdateScope(ctx context.Context, id string, model *models.Scope) error
+	GetScopeByID(ctx context.Context, id string) (models.Scope, error)
+	ListScopes(ctx context.Context) ([]models.Scope, error)
+	// DeleteScope deletes the scope with id. If recurseComment is set, all
+	// comments of the scope and all data related to them are deleted as
+	// well.
+	DeleteScope(ctx context.Context, id string, recurseComment bool) error
+
+	// Comments
+
+	CreateComment(ctx context.Context, model models.Comment) (string, error)
+	// ImportComments stores comments as they are, without creating outbox
+	// entries. Existing comments with the same ID are replaced if overwrite
+	// is set and skipped otherwise. If an ID is already used by a comment
+	// of another scope, nothing is imported and an AlreadyExists error is
+	// returned. It returns the number of comments written.
+	ImportComments(ctx context.Context, comments []models.Comment, overwrite bool) (int, error)
+	GetComment(ctx context.Context, id string) (models.Comment, error)
+	// GetParentComments returns the comment with id and all of its parent
+	// comments in an undefined order.
+	GetParentComments(ctx context.Context, id string) ([]models.Comment, error)
+	GetCommentTreeFromCommentID(ctx context.Context, id string) (*models.CommentTree, error)
+	GetCommentTreeByScope(ctx context.Context, scopeId string, reference string) ([]*models.CommentTree, error)
+	ListCommentTrees(ctx context.Context, scopeId string, reference string, opts ListOptions) (trees []*models.CommentTree, nextPageToken string, err error)
+	// UpdateCommentContent replaces the content and mentions of a comment
+	// and stores the previous content as a revision. content must have
+	// canonical mentions (see models.Comment.CanonicalMentions).
+	UpdateCommentContent(ctx context.Context, id string, content string, mentions []string, editorId string) (models.Comment, error)
+	ListCommentRevisions(ctx context.Context, id string) ([]models.CommentRevision, error)
+	SoftDeleteComment(ctx context.Context, id string, userId string) (models.Comment, error)
+	PurgeCommentTree(ctx context.Context, id string, userId string) (int64, error)
+	SearchComments(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+
+	// Reactions
+
+	AddReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error)
+	RemoveReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error)
+
+	// Notification outbox
+
+	ClaimOutboxEntry(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error)
+	CompleteOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string) error
+	FailOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string, reason string, nextAttempt time.Time) error
+	ListOutboxEntries(ctx context.Context, state models.OutboxState) ([]models.OutboxEntry, error)
+	RetryOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error)
+	DiscardOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error)
+
+	// Subscriptions
+
+	SetSubscription(ctx context.Context, userId string, target models.SubscriptionTarget, state models.SubscriptionState) (models.Subscription, error)
+	DeleteSubscription(ctx context.Context, userId string, target models.SubscriptionTarget) error
+	ListUserSubscriptions(ctx context.Context, userId string) ([]models.Subscription, error)
+	FindSubscriptions(ctx context.Context, scope string, reference string, rootId primitive.ObjectID) ([]models.Subscription, error)
+
+	// Webhooks
+
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, id string) (models.Webhook, error)
+	ListWebhooks(ctx context.Context, scopeId string) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id primitive.ObjectID) error
+	ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int) error
+	FailWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int, reason string, nextAttempt time.Time) error
+	ListWebhookDeliveries(ctx context.Context, webhookId primitive.ObjectID, state models.WebhookDeliveryState, limit int) ([]models.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, id primitive.ObjectID) (models.WebhookDelivery, error)
+}
+
+// CommentWatcher is implemented by repositories that can report changes to
+// comments made by other processes.
+type CommentWatcher interface {
+	WatchComments(ctx context.Context, resumeAfter bson.Raw, publish func(events.Event)) (bson.Raw, error)
+}
+
+// Migrator is implemented by repositories that manage a versioned schema.
+type Migrator interface {
+	// Migrate applies all pending schema migrations. Applied migrations
+	// are recorded in the database, so it's safe to call Migrate on each
+	// start.
+	Migrate(ctx context.Context) error
+}
+
+// Migrate applies all pending schema migrations if r is a Migrator.
+func Migrate(ctx context.Context, r Repository) error {
+	m, ok := r.(Migrator)
+	if !ok {
+		return nil
+	}
+
+	return m.Migrate(ctx)
+}
+
+var (
+	_ Repository     = (*MongoRepository)(nil)
+	_ CommentWatcher = (*MongoRepository)(nil)
+	_ Repository     = (*MemoryRepository)(nil)
+	_ Repository     = (*SQLRepository)(nil)
+	_ Migrator       = (*MongoRepository)(nil)
+	_ Migrator       = (*SQLRepository)(nil)
+)
+
+// New returns the Repository for databaseURL. The backend is selected by the
+// URL scheme:
+//
+//	mongodb://, mongodb+srv://   - MongoDB
+//	postgres://, postgresql://   - PostgreSQL
+//	sqlite:///path/to/db         - SQLite
+//	memory://                    - in-memory, all data is lost on restart
+func New(ctx context.Context, databaseURL string) (Repository, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "mongodb", "mongodb+srv":
+		return NewMongoRepository(ctx, databaseURL)
+
+	case "postgres", "postgresql", "sqlite":
+		return NewSQLRepository(ctx, databaseURL)
+
+	case "memory":
+		return NewMemoryRepository(), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported database URL scheme %q", u.Scheme)
+	}
+}
+
+// errCommentInOtherScope is returned by ImportComments if a comment ID is
+// already used in another scope.
+func errCommentInOtherScope(id primitive.ObjectID) error {
+	return connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("comment %s already exists in another scope", id.Hex()))
+}
@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpdateCommentContent replaces the content and the mentioned user IDs of
+// the comment with id. The previous content is stored in the revision
+// collection.
+func (r *MongoRepository) UpdateCommentContent(ctx context.Context, id string, content string, mentions []string, editorId string) (models.Comment, error) {
+	var result models.Comment
+
+	err := r.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		result, err = r.updateCommentContent(ctx, id, content, mentions, editorId)
+		if err != nil {
+			return err
+		}
+
+		return r.enqueueWebhooks(ctx, events.Edited, result)
+	})
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	return result, nil
+}
+
+func (r *MongoRepository) updateCommentContent(ctx context.Context, id string, content string, mentions []string, editorId string) (models.Comment, error) {
+	comment, err := r.GetComment(ctx, id)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	now := time.Now()
+
+	revision := models.CommentRevision{
+		ID:        primitive.NewObjectID(),
+		CommentID: comment.ID,
+		Content:   comment.Content,
+		EditedAt:  now,
+		EditorID:  editorId,
+	}
+
+	// store the previous version first so we never lose history
+	if _, err := r.revisions.InsertOne(ctx, revision); err != nil {
+		return models.Comment{}, fmt.Errorf("failed to save comment revision: %w", err)
+	}
+
+	// only update the comment if nobody else edited it in the meantime
+	filter := bson.M{
+		"_id":     comment.ID,
+		"content": comment.Content,
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"content":           content,
+			"mentions":          mentions,
+			"canonicalMentions": true,
+			"updatedAt":         now,
+		},
+		"$inc": bson.M{
+			"revisionCount": 1,
+		},
+	}
+
+	res, err := r.comments.UpdateOne(ctx, filter, update)
+	if err == nil && res.MatchedCount == 0 {
+		err = connect.NewError(connect.CodeAborted, fmt.Errorf("comment has been modified concurrently"))
+	}
+
+	if err != nil {
+		// the transaction, if any, takes care of the revision
+		if r.transactions {
+			return models.Comment{}, err
+		}
+
+		if _, delErr := r.revisions.DeleteOne(ctx, bson.M{"_id": revision.ID}); delErr != nil {
+			return models.Comment{}, fmt.Errorf("failed to update comment: %w (and failed to remove revision: %s)", err, delErr)
+		}
+
+		return models.Comment{}, err
+	}
+
+	comment.Content = content
+	comment.Mentions = mentions
+	comment.CanonicalMentions = true
+	comment.UpdatedAt = now
+	comment.RevisionCount++
+
+	return comment, nil
+}
+
+// ListCommentRevisions returns all previous versions of the comment with id
+// sorted from oldest to newest.
+func (r *MongoRepository) ListCommentRevisions(ctx context.Context, id string) ([]models.CommentRevision, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	res, err := r.revisions.Find(
+		ctx,
+		bson.M{"commentId": oid},
+		options.Find().SetSort(bson.D{{Key: "editedAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find revisions: %w", err)
+	}
+
+	var result []models.CommentRevision
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode revisions: %w", err)
+	}
+
+	return result, nil
+}
+
+func (r *MongoRepository) deleteRevisionsByScope(ctx context.Context, scopeId string) error {
+	ids, err := r.comments.Distinct(ctx, "_id", bson.M{"scopeId": scopeId})
+	if err != nil {
+		return fmt.Errorf("failed to find comments: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := r.revisions.DeleteMany(ctx, bson.M{"commentId": bson.M{"$in": ids}}); err != nil {
+		return fmt.Errorf("failed to delete revisions: %w", err)
+	}
+
+	return nil
+}
@@ -12,7 +12,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func (r *Repository) CreateScope(ctx context.Context, model *models.Scope) (id string, err error) {
+func (r *MongoRepository) CreateScope(ctx context.Context, model *models.Scope) (id string, err error) {
 	if model.InternalID.IsZero() {
 		model.InternalID = primitive.NewObjectID()
 	}
@@ -28,7 +28,7 @@ func (r *Repository) CreateScope(ctx context.Context, model *models.Scope) (id s
 	return model.InternalID.Hex(), nil
 }
 
-func (r *Repository) UpdateScope(ctx context.Context, id string, model *models.Scope) error {
+func (r *MongoRepository) UpdateScope(ctx context.Context, id string, model *models.Scope) error {
 	res, err := r.scopes.ReplaceOne(ctx, bson.M{"scopeId": id}, model)
 	if err != nil {
 		return err
@@ -41,7 +41,7 @@ func (r *Repository) UpdateScope(ctx context.Context, id string, model *models.S
 	return nil
 }
 
-func (r *Repository) GetScopeByID(ctx context.Context, id string) (models.Scope, error) {
+func (r *MongoRepository) GetScopeByID(ctx context.Context, id string) (models.Scope, error) {
 	res := r.scopes.FindOne(ctx, bson.M{"scopeId": id})
 	if err := res.Err(); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -59,7 +59,7 @@ func (r *Repository) GetScopeByID(ctx context.Context, id string) (models.Scope,
 	return scope, nil
 }
 
-func (r *Repository) DeleteScope(ctx context.Context, id string, recurseComment bool) error {
+func (r *MongoRepository) DeleteScope(ctx context.Context, id string, recurseComment bool) error {
 	res, err := r.scopes.DeleteOne(ctx, bson.M{"scopeId": id})
 	if err != nil {
 		return fmt.Errorf("failed to delete scope: %w", err)
@@ -70,6 +70,18 @@ func (r *Repository) DeleteScope(ctx context.Context, id string, recurseComment
 	}
 
 	if recurseComment {
+		if err := r.deleteRevisionsByScope(ctx, id); err != nil {
+			return err
+		}
+
+		if err := r.deleteSubscriptionsByScope(ctx, id); err != nil {
+			return err
+		}
+
+		if err := r.deleteWebhooksByScope(ctx, id); err != nil {
+			return err
+		}
+
 		_, err := r.comments.DeleteMany(ctx, bson.M{
 			"scopeId": id,
 		})
@@ -81,7 +93,7 @@ func (r *Repository) DeleteScope(ctx context.Context, id string, recurseComment
 	return nil
 }
 
-func (r *Repository) ListScopes(ctx context.Context) ([]models.Scope, error) {
+func (r *MongoRepository) ListScopes(ctx context.Context) ([]models.Scope, error) {
 	res, err := r.scopes.Find(ctx, bson.M{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to find scopes: %w", err)
@@ -0,0 +1,231 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SearchQuery describes a full-text search for comments.
+type SearchQuery struct {
+	// Text is the search string passed to the mongo $text operator.
+	Text string
+
+	Scope string
+	// Scopes restricts the search to a set of scopes if not nil.
+	Scopes        []string
+	Reference     string
+	CreatorID     string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	Offset int
+	Limit  int
+}
+
+// SearchResult is a comment that matched a SearchQuery.
+type SearchResult struct {
+	Comment models.Comment
+	Score   float64
+
+	// RootID is the ID of the root comment of the thread.
+	RootID primitive.ObjectID
+}
+
+type searchResult struct {
+	models.Comment `bson:",inline"`
+	Score          float64          `bson:"score"`
+	Ancestors      []models.Comment `bson:"ancestors"`
+}
+
+// SearchComments performs a full-text search on the content of all comments
+// that are not deleted. Results are sorted by relevance.
+func (r *MongoRepository) SearchComments(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	filter := bson.M{
+		"$text": bson.M{
+			"$search": q.Text,
+		},
+		"deletedAt": bson.M{
+			"$exists": false,
+		},
+	}
+
+	switch {
+	case q.Scope != "":
+		filter["scopeId"] = q.Scope
+	case q.Scopes != nil:
+		filter["scopeId"] = bson.M{
+			"$in": q.Scopes,
+		}
+	}
+
+	if q.Reference != "" {
+		filter["ref"] = q.Reference
+	}
+
+	if q.CreatorID != "" {
+		filter["creatorId"] = q.CreatorID
+	}
+
+	createdAt := bson.M{}
+	if !q.CreatedAfter.IsZero() {
+		createdAt["$gte"] = q.CreatedAfter
+	}
+	if !q.CreatedBefore.IsZero() {
+		createdAt["$lt"] = q.CreatedBefore
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	pipeline := mongo.Pipeline{
+		{{
+			Key:   "$match",
+			Value: filter,
+		}},
+		{{
+			Key: "$addFields",
+			Value: bson.M{
+				"score": bson.M{
+					"$meta": "textScore",
+				},
+			},
+		}},
+		{{
+			Key: "$sort",
+			Value: bson.D{
+				{Key: "score", Value: -1},
+				{Key: "createdAt", Value: -1},
+				{Key: "_id", Value: -1},
+			},
+		}},
+	}
+
+	if q.Offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: q.Offset}})
+	}
+
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: q.Limit}})
+	}
+
+	// find all parent comments so we can determine the root of the thread
+	pipeline = append(pipeline, bson.D{{
+		Key: "$graphLookup",
+		Value: bson.M{
+			"from":             CommentCollection,
+			"startWith":        "$parentId",
+			"connectFromField": "parentId",
+			"connectToField":   "_id",
+			"as":               "ancestors",
+		},
+	}})
+
+	res, err := r.comments.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search comments: %w", err)
+	}
+
+	var result []searchResult
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+
+	hits := make([]SearchResult, len(result))
+	for idx, sr := range result {
+		hits[idx] = SearchResult{
+			Comment: sr.Comment,
+			Score:   sr.Score,
+			RootID:  sr.Comment.ID,
+		}
+
+		for _, a := range sr.Ancestors {
+			if a.ParentID.IsZero() {
+				hits[idx].RootID = a.ID
+				break
+			}
+		}
+	}
+
+	return hits, nil
+}
+
+// textQuery is a parsed search string for backends without the mongo $text
+// operator. It understands words, "quoted phrases" and -negated words.
+type textQuery struct {
+	words   []string
+	phrases []string
+	negated []string
+}
+
+func parseTextQuery(s string) textQuery {
+	var q textQuery
+
+	// extract "quoted phrases" first
+	parts := strings.Split(strings.ToLower(s), `"`)
+	for idx, part := range parts {
+		if idx%2 == 1 {
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				q.phrases = append(q.phrases, phrase)
+			}
+
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			if negated, ok := strings.CutPrefix(word, "-"); ok {
+				q.negated = append(q.negated, textWords(negated)...)
+			} else {
+				q.words = append(q.words, textWords(word)...)
+			}
+		}
+	}
+
+	return q
+}
+
+func (q textQuery) match(content string) (float64, bool) {
+	content = strings.ToLower(content)
+
+	words := make(map[string]int)
+	for _, w := range textWords(content) {
+		words[w]++
+	}
+
+	for _, w := range q.negated {
+		if words[w] > 0 {
+			return 0, false
+		}
+	}
+
+	for _, phrase := range q.phrases {
+		if !strings.Contains(content, phrase) {
+			return 0, false
+		}
+	}
+
+	var score float64
+	for _, w := range q.words {
+		score += float64(words[w])
+	}
+
+	// if phrases are given, the other words only affect the score
+	if score == 0 && len(q.phrases) == 0 {
+		return 0, false
+	}
+
+	return max(score, 1), true
+}
+
+func textWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
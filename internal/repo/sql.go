@@ -0,0 +1,651 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations
+var sqlMigrations embed.FS
+
+// sqlDialect holds everything that differs between the supported SQL
+// databases. Queries are written with ? placeholders and rebound for
+// databases that use numbered placeholders.
+type sqlDialect struct {
+	name   string
+	driver string
+
+	// numberedPlaceholders is set if the database expects $1, $2, ...
+	// instead of ?.
+	numberedPlaceholders bool
+
+	// skipLocked is appended to sub-selects that claim rows so concurrent
+	// dispatchers do not block each other.
+	skipLocked string
+
+	// noLimit is used as the LIMIT if only an OFFSET is required.
+	noLimit string
+
+	// lockMigrations is executed in the migration transaction to prevent
+	// concurrent migrations.
+	lockMigrations string
+}
+
+var (
+	postgresDialect = sqlDialect{
+		name:                 "postgres",
+		driver:               "pgx",
+		numberedPlaceholders: true,
+		skipLocked:           " FOR UPDATE SKIP LOCKED",
+		noLimit:              "ALL",
+		lockMigrations:       "SELECT pg_advisory_xact_lock(7267531)",
+	}
+
+	// SQLite serializes all writes so there's no need for row locking.
+	sqliteDialect = sqlDialect{
+		name:    "sqlite",
+		driver:  "sqlite",
+		noLimit: "-1",
+	}
+)
+
+func (d sqlDialect) rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+
+			continue
+		}
+
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+func (d sqlDialect) isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+
+	return false
+}
+
+// textSearch returns the FROM clause, the score expression and the WHERE
+// condition for a full-text search on comments. Comment columns must be
+// prefixed with "c.". The returned arguments must be passed in the order
+// score, condition.
+func (d sqlDialect) textSearch(q textQuery) (from string, score string, cond string, args []any, ok bool) {
+	switch d.name {
+	case sqliteDialect.name:
+		expr, ok := ftsQuery(q)
+		if !ok {
+			return "", "", "", nil, false
+		}
+
+		return "comments_fts JOIN comments c ON c.rowid = comments_fts.rowid",
+			"-bm25(comments_fts)",
+			"comments_fts MATCH ?",
+			[]any{expr},
+			true
+
+	default:
+		expr, ok := tsQuery(q)
+		if !ok {
+			return "", "", "", nil, false
+		}
+
+		return "comments c",
+			"ts_rank(to_tsvector('simple', c.content), to_tsquery('simple', ?))",
+			"to_tsvector('simple', c.content) @@ to_tsquery('simple', ?)",
+			[]any{expr, expr},
+			true
+	}
+}
+
+// tsQuery converts q into a postgres tsquery. textWords only returns letters
+// and digits so words can be quoted as is.
+func tsQuery(q textQuery) (string, bool) {
+	quote := func(words []string) []string {
+		result := make([]string, len(words))
+		for idx, w := range words {
+			result[idx] = "'" + w + "'"
+		}
+
+		return result
+	}
+
+	var parts []string
+	if len(q.phrases) > 0 {
+		// like with mongo, words only affect the score if phrases are
+		// given.
+		for _, phrase := range q.phrases {
+			if words := textWords(phrase); len(words) > 0 {
+				parts = append(parts, "("+strings.Join(quote(words), " <-> ")+")")
+			}
+		}
+	} else if len(q.words) > 0 {
+		parts = append(parts, "("+strings.Join(quote(q.words), " | ")+")")
+	}
+
+	if len(parts) == 0 {
+		return "", false
+	}
+
+	for _, w := range quote(q.negated) {
+		parts = append(parts, "!"+w)
+	}
+
+	return strings.Join(parts, " & "), true
+}
+
+// ftsQuery converts q into a SQLite FTS5 query.
+func ftsQuery(q textQuery) (string, bool) {
+	quote := func(words []string) []string {
+		result := make([]string, len(words))
+		for idx, w := range words {
+			result[idx] = `"` + w + `"`
+		}
+
+		return result
+	}
+
+	var parts []string
+	if len(q.phrases) > 0 {
+		for _, phrase := range q.phrases {
+			if words := textWords(phrase); len(words) > 0 {
+				parts = append(parts, `"`+strings.Join(words, " ")+`"`)
+			}
+		}
+	} else if len(q.words) > 0 {
+		parts = append(parts, "("+strings.Join(quote(q.words), " OR ")+")")
+	}
+
+	if len(parts) == 0 {
+		return "", false
+	}
+
+	expr := strings.Join(parts, " AND ")
+	for _, w := range quote(q.negated) {
+		expr = "(" + expr + ") NOT " + w
+	}
+
+	return expr, true
+}
+
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+// SQLRepository implements Repository on top of PostgreSQL or SQLite.
+//
+// All timestamps are stored as microseconds since the unix epoch and IDs as
+// hex encoded ObjectIDs. Lists of strings are stored as JSON arrays.
+type SQLRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// NewSQLRepository opens the database at databaseURL. The schema is managed
+// by Migrate. Supported are postgres:// (and postgresql://) URLs and
+// sqlite:// URLs where the path is the database file, like
+// sqlite:///var/lib/comments/comments.db.
+func NewSQLRepository(ctx context.Context, databaseURL string) (*SQLRepository, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	var (
+		dialect sqlDialect
+		dsn     string
+	)
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		dialect = postgresDialect
+		dsn = databaseURL
+
+	case "sqlite":
+		dialect = sqliteDialect
+
+		file := u.Host + u.Path
+		if file == "" {
+			return nil, fmt.Errorf("missing database file in %q", databaseURL)
+		}
+
+		query := u.Query()
+		query.Add("_pragma", "busy_timeout(5000)")
+		query.Add("_pragma", "journal_mode(WAL)")
+
+		dsn = file + "?" + query.Encode()
+
+	default:
+		return nil, fmt.Errorf("unsupported database URL scheme %q", u.Scheme)
+	}
+
+	db, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", dialect.name, err)
+	}
+
+	// SQLite only supports one writer at a time, using a single connection
+	// avoids "database is locked" errors.
+	if dialect.name == sqliteDialect.name {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping %s database: %w", dialect.name, err)
+	}
+
+	r := &SQLRepository{
+		db:      db,
+		dialect: dialect,
+	}
+
+	return r, nil
+}
+
+// Migrate applies all migrations from migrations/<dialect> that have not
+// been applied yet. Migrations are applied in the order of their numeric
+// file name prefix and recorded in the schema_migrations table.
+func (r *SQLRepository) Migrate(ctx context.Context) error {
+	dir := path.Join("migrations", r.dialect.name)
+
+	entries, err := fs.ReadDir(sqlMigrations, dir)
+	if err != nil {
+		return err
+	}
+
+	type migration struct {
+		version int
+		name    string
+	}
+
+	var migrations []migration
+	for _, e := range entries {
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+
+		migrations = append(migrations, migration{version: version, name: e.Name()})
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int {
+		return a.version - b.version
+	})
+
+	_, err = r.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	for _, m := range migrations {
+		content, err := fs.ReadFile(sqlMigrations, path.Join(dir, m.name))
+		if err != nil {
+			return err
+		}
+
+		err = r.withTx(ctx, func(tx *sql.Tx) error {
+			if r.dialect.lockMigrations != "" {
+				if _, err := tx.ExecContext(ctx, r.dialect.lockMigrations); err != nil {
+					return fmt.Errorf("failed to lock migrations: %w", err)
+				}
+			}
+
+			var applied int
+			if err := r.queryRow(ctx, tx, "SELECT COUNT(*) FROM schema_migrations WHERE version = ?", m.version).Scan(&applied); err != nil {
+				return err
+			}
+
+			if applied > 0 {
+				return nil
+			}
+
+			if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+				return err
+			}
+
+			_, err := r.exec(ctx, tx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.version, m.name, time.Now().UnixMicro())
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) exec(ctx context.Context, q sqlQuerier, query string, args ...any) (sql.Result, error) {
+	return q.ExecContext(ctx, r.dialect.rebind(query), args...)
+}
+
+func (r *SQLRepository) query(ctx context.Context, q sqlQuerier, query string, args ...any) (*sql.Rows, error) {
+	return q.QueryContext(ctx, r.dialect.rebind(query), args...)
+}
+
+func (r *SQLRepository) queryRow(ctx context.Context, q sqlQuerier, query string, args ...any) *sql.Row {
+	return q.QueryRowContext(ctx, r.dialect.rebind(query), args...)
+}
+
+// withTx executes fn in a transaction. The transaction is committed if fn
+// returns nil and rolled back otherwise.
+func (r *SQLRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// placeholders returns n comma separated placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// prefixColumns prefixes each column in the comma separated list columns.
+func prefixColumns(prefix string, columns string) string {
+	list := strings.Split(columns, ", ")
+	for idx, c := range list {
+		list[idx] = prefix + c
+	}
+
+	return strings.Join(list, ", ")
+}
+
+func sqlTime(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: t.UnixMicro(), Valid: true}
+}
+
+func fromSQLTime(t sql.NullInt64) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+
+	return time.UnixMicro(t.Int64).UTC()
+}
+
+func sqlObjectID(id primitive.ObjectID) sql.NullString {
+	if id.IsZero() {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: id.Hex(), Valid: true}
+}
+
+func fromSQLObjectID(id sql.NullString) (primitive.ObjectID, error) {
+	if !id.Valid || id.String == "" {
+		return primitive.NilObjectID, nil
+	}
+
+	return primitive.ObjectIDFromHex(id.String)
+}
+
+func sqlStrings(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+
+	blob, _ := json.Marshal(list)
+
+	return string(blob)
+}
+
+func fromSQLStrings(s string) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal([]byte(s), &list); err != nil {
+		return nil, fmt.Errorf("invalid string list: %w", err)
+	}
+
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	return list, nil
+}
+
+// Scopes
+
+const scopeColumns = "internal_id, scope_id, name, notification_type, view_url_template, owner_ids, reader_roles, writer_roles, html_policy"
+
+func scopeValues(s models.Scope) []any {
+	return []any{
+		s.InternalID.Hex(),
+		s.ID,
+		s.Name,
+		string(s.NotificationType),
+		s.CommentViewURLTemplate,
+		sqlStrings(s.OwnerIDs),
+		sqlStrings(s.ReaderRoles),
+		sqlStrings(s.WriterRoles),
+		string(s.HTMLPolicy),
+	}
+}
+
+func scanScope(row sqlScanner) (models.Scope, error) {
+	var (
+		s                                  models.Scope
+		internalId                         string
+		ownerIds, readerRoles, writerRoles string
+	)
+
+	err := row.Scan(
+		&internalId,
+		&s.ID,
+		&s.Name,
+		&s.NotificationType,
+		&s.CommentViewURLTemplate,
+		&ownerIds,
+		&readerRoles,
+		&writerRoles,
+		&s.HTMLPolicy,
+	)
+	if err != nil {
+		return models.Scope{}, err
+	}
+
+	if s.InternalID, err = primitive.ObjectIDFromHex(internalId); err != nil {
+		return models.Scope{}, fmt.Errorf("invalid scope id: %w", err)
+	}
+
+	if s.OwnerIDs, err = fromSQLStrings(ownerIds); err != nil {
+		return models.Scope{}, err
+	}
+
+	if s.ReaderRoles, err = fromSQLStrings(readerRoles); err != nil {
+		return models.Scope{}, err
+	}
+
+	if s.WriterRoles, err = fromSQLStrings(writerRoles); err != nil {
+		return models.Scope{}, err
+	}
+
+	return s, nil
+}
+
+func (r *SQLRepository) CreateScope(ctx context.Context, model *models.Scope) (id string, err error) {
+	if model.InternalID.IsZero() {
+		model.InternalID = primitive.NewObjectID()
+	}
+
+	_, err = r.exec(ctx, r.db, "INSERT INTO scopes ("+scopeColumns+") VALUES ("+placeholders(9)+")", scopeValues(*model)...)
+	if err != nil {
+		if r.dialect.isUniqueViolation(err) {
+			return "", connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("scope id already exists"))
+		}
+
+		return "", fmt.Errorf("failed to save scope: %w", err)
+	}
+
+	return model.InternalID.Hex(), nil
+}
+
+func (r *SQLRepository) UpdateScope(ctx context.Context, id string, model *models.Scope) error {
+	// the internal ID is never changed
+	values := scopeValues(*model)[1:]
+
+	res, err := r.exec(ctx, r.db, `UPDATE scopes SET
+		scope_id = ?, name = ?, notification_type = ?, view_url_template = ?,
+		owner_ids = ?, reader_roles = ?, writer_roles = ?, html_policy = ?
+		WHERE scope_id = ?`, append(values, id)...)
+	if err != nil {
+		if r.dialect.isUniqueViolation(err) {
+			return connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("scope id already exists"))
+		}
+
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("scope id not found"))
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) GetScopeByID(ctx context.Context, id string) (models.Scope, error) {
+	scope, err := scanScope(r.queryRow(ctx, r.db, "SELECT "+scopeColumns+" FROM scopes WHERE scope_id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Scope{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("failed to find scope"))
+		}
+
+		return models.Scope{}, fmt.Errorf("failed to find scope: %w", err)
+	}
+
+	return scope, nil
+}
+
+func (r *SQLRepository) DeleteScope(ctx context.Context, id string, recurseComment bool) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := r.exec(ctx, tx, "DELETE FROM scopes WHERE scope_id = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete scope: %w", err)
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("scope not found"))
+		}
+
+		if !recurseComment {
+			return nil
+		}
+
+		statements := []string{
+			"DELETE FROM revisions WHERE comment_id IN (SELECT id FROM comments WHERE scope_id = ?)",
+			"DELETE FROM comment_reactions WHERE comment_id IN (SELECT id FROM comments WHERE scope_id = ?)",
+			"DELETE FROM subscriptions WHERE scope_id = ?",
+			"DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE scope_id = ?)",
+			"DELETE FROM webhooks WHERE scope_id = ?",
+			"DELETE FROM comments WHERE scope_id = ?",
+		}
+
+		for _, stmt := range statements {
+			if _, err := r.exec(ctx, tx, stmt, id); err != nil {
+				return fmt.Errorf("failed to delete scope data: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLRepository) ListScopes(ctx context.Context) ([]models.Scope, error) {
+	rows, err := r.query(ctx, r.db, "SELECT "+scopeColumns+" FROM scopes ORDER BY internal_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find scopes: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.Scope
+	for rows.Next() {
+		scope, err := scanScope(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode scopes: %w", err)
+		}
+
+		result = append(result, scope)
+	}
+
+	return result, rows.Err()
+}
+
+// pruneExpired removes delivered outbox entries and webhook deliveries that
+// are past their retention period, like the TTL indexes of the mongo
+// collections do.
+func (r *SQLRepository) pruneExpired(ctx context.Context, now time.Time) error {
+	if _, err := r.exec(ctx, r.db, "DELETE FROM outbox WHERE state = ? AND updated_at < ?", string(models.OutboxStateDelivered), now.Add(-outboxRetention).UnixMicro()); err != nil {
+		return fmt.Errorf("failed to prune outbox: %w", err)
+	}
+
+	if _, err := r.exec(ctx, r.db, "DELETE FROM webhook_deliveries WHERE created_at < ?", now.Add(-webhookDeliveryRetention).UnixMicro()); err != nil {
+		return fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+
+	return nil
+}
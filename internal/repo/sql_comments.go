@@ -0,0 +1,851 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const commentColumns = "id, scope_id, ref, content, parent_id, created_at, creator_id, updated_at, revision_count, deleted_at, deleted_by, mentions, canonical_mentions"
+
+// sqlBatchSize limits the number of comment IDs per query when loading
+// answers or reactions.
+const sqlBatchSize = 500
+
+func commentValues(c models.Comment) []any {
+	return []any{
+		c.ID.Hex(),
+		c.Scope,
+		c.Reference,
+		c.Content,
+		sqlObjectID(c.ParentID),
+		sqlTime(c.CreatedAt),
+		c.CreatorID,
+		sqlTime(c.UpdatedAt),
+		c.RevisionCount,
+		sqlTime(c.DeletedAt),
+		c.DeletedBy,
+		sqlStrings(c.Mentions),
+		c.CanonicalMentions,
+	}
+}
+
+func scanComment(row sqlScanner, extra ...any) (models.Comment, error) {
+	var (
+		c                               models.Comment
+		id, mentions                    string
+		parentId                        sql.NullString
+		createdAt, updatedAt, deletedAt sql.NullInt64
+	)
+
+	dest := []any{
+		&id,
+		&c.Scope,
+		&c.Reference,
+		&c.Content,
+		&parentId,
+		&createdAt,
+		&c.CreatorID,
+		&updatedAt,
+		&c.RevisionCount,
+		&deletedAt,
+		&c.DeletedBy,
+		&mentions,
+		&c.CanonicalMentions,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return models.Comment{}, err
+	}
+
+	var err error
+	if c.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return models.Comment{}, fmt.Errorf("invalid comment id: %w", err)
+	}
+
+	if c.ParentID, err = fromSQLObjectID(parentId); err != nil {
+		return models.Comment{}, fmt.Errorf("invalid parent id: %w", err)
+	}
+
+	if c.Mentions, err = fromSQLStrings(mentions); err != nil {
+		return models.Comment{}, err
+	}
+
+	c.CreatedAt = fromSQLTime(createdAt)
+	c.UpdatedAt = fromSQLTime(updatedAt)
+	c.DeletedAt = fromSQLTime(deletedAt)
+
+	return c, nil
+}
+
+// queryComments executes query and returns all comments including their
+// reactions.
+func (r *SQLRepository) queryComments(ctx context.Context, q sqlQuerier, query string, args ...any) ([]models.Comment, error) {
+	rows, err := r.query(ctx, q, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find comments: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode comment: %w", err)
+		}
+
+		result = append(result, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find comments: %w", err)
+	}
+
+	if err := r.loadReactions(ctx, q, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// loadReactions loads the reactions of all comments in the order they have
+// been added.
+func (r *SQLRepository) loadReactions(ctx context.Context, q sqlQuerier, comments []models.Comment) error {
+	byId := make(map[string]*models.Comment, len(comments))
+	for idx := range comments {
+		byId[comments[idx].ID.Hex()] = &comments[idx]
+	}
+
+	for start := 0; start < len(comments); start += sqlBatchSize {
+		batch := comments[start:min(start+sqlBatchSize, len(comments))]
+
+		args := make([]any, len(batch))
+		for idx, c := range batch {
+			args[idx] = c.ID.Hex()
+		}
+
+		rows, err := r.query(ctx, q, "SELECT comment_id, emoji, user_id, created_at FROM comment_reactions WHERE comment_id IN ("+placeholders(len(args))+") ORDER BY created_at", args...)
+		if err != nil {
+			return fmt.Errorf("failed to find reactions: %w", err)
+		}
+
+		for rows.Next() {
+			var (
+				commentId string
+				reaction  models.Reaction
+				createdAt sql.NullInt64
+			)
+
+			if err := rows.Scan(&commentId, &reaction.Emoji, &reaction.UserID, &createdAt); err != nil {
+				rows.Close()
+
+				return fmt.Errorf("failed to decode reaction: %w", err)
+			}
+
+			reaction.CreatedAt = fromSQLTime(createdAt)
+
+			if c, ok := byId[commentId]; ok {
+				c.Reactions = append(c.Reactions, reaction)
+			}
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to find reactions: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) getComment(ctx context.Context, q sqlQuerier, id string) (models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Comment{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	result, err := r.queryComments(ctx, q, "SELECT "+commentColumns+" FROM comments WHERE id = ?", oid.Hex())
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	if len(result) == 0 {
+		return models.Comment{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	return result[0], nil
+}
+
+func (r *SQLRepository) CreateComment(ctx context.Context, model models.Comment) (string, error) {
+	// verify that the scope actually exists
+	if _, err := r.GetScopeByID(ctx, model.Scope); err != nil {
+		return "", err
+	}
+
+	if model.ID.IsZero() {
+		model.ID = primitive.NewObjectID()
+	}
+
+	// the outbox entry, the webhook deliveries and the comment are written
+	// in the same transaction so notifications and events are never lost.
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := r.exec(ctx, tx, "INSERT INTO comments ("+commentColumns+") VALUES ("+placeholders(13)+")", commentValues(model)...); err != nil {
+			if r.dialect.isUniqueViolation(err) {
+				return connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("comment id already exists"))
+			}
+
+			return fmt.Errorf("failed to save comment: %w", err)
+		}
+
+		for _, reaction := range model.Reactions {
+			if err := r.insertReaction(ctx, tx, model.ID, reaction); err != nil {
+				return err
+			}
+		}
+
+		if err := r.createOutboxEntry(ctx, tx, model.ID); err != nil {
+			return err
+		}
+
+		return r.enqueueWebhooks(ctx, tx, events.Created, model)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return model.ID.Hex(), nil
+}
+
+func (r *SQLRepository) ImportComments(ctx context.Context, comments []models.Comment, overwrite bool) (int, error) {
+	written := 0
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		for _, c := range comments {
+			var scope string
+			err := r.queryRow(ctx, tx, "SELECT scope_id FROM comments WHERE id = ?", c.ID.Hex()).Scan(&scope)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+			case err != nil:
+				return fmt.Errorf("failed to check comment %s: %w", c.ID.Hex(), err)
+			case scope != c.Scope:
+				return errCommentInOtherScope(c.ID)
+			}
+
+			if overwrite {
+				if _, err := r.exec(ctx, tx, "DELETE FROM comment_reactions WHERE comment_id = ?", c.ID.Hex()); err != nil {
+					return fmt.Errorf("failed to delete reactions: %w", err)
+				}
+
+				if _, err := r.exec(ctx, tx, "DELETE FROM comments WHERE id = ?", c.ID.Hex()); err != nil {
+					return fmt.Errorf("failed to delete comment: %w", err)
+				}
+			}
+
+			res, err := r.exec(ctx, tx, "INSERT INTO comments ("+commentColumns+") VALUES ("+placeholders(13)+") ON CONFLICT (id) DO NOTHING", commentValues(c)...)
+			if err != nil {
+				return fmt.Errorf("failed to save comment %s: %w", c.ID.Hex(), err)
+			}
+
+			if n, err := res.RowsAffected(); err == nil && n == 0 {
+				continue
+			}
+
+			for _, reaction := range c.Reactions {
+				if err := r.insertReaction(ctx, tx, c.ID, reaction); err != nil {
+					return err
+				}
+			}
+
+			written++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return written, nil
+}
+
+func (r *SQLRepository) GetComment(ctx context.Context, id string) (models.Comment, error) {
+	return r.getComment(ctx, r.db, id)
+}
+
+// ancestorsQuery selects the comment with the given ID and all of it's
+// parents.
+var ancestorsQuery = `WITH RECURSIVE ancestors AS (
+	SELECT ` + commentColumns + ` FROM comments WHERE id = ?
+	UNION ALL
+	SELECT ` + prefixColumns("c.", commentColumns) + `
+	FROM comments c JOIN ancestors a ON c.id = a.parent_id
+) SELECT ` + commentColumns + ` FROM ancestors`
+
+func (r *SQLRepository) GetParentComments(ctx context.Context, id string) ([]models.Comment, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	result, err := r.queryComments(ctx, r.db, ancestorsQuery, oid.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("comment not found"))
+	}
+
+	return result, nil
+}
+
+// loadCommentTrees returns the comment trees of roots, in the same order.
+// All answers are loaded with a single recursive query.
+func (r *SQLRepository) loadCommentTrees(ctx context.Context, q sqlQuerier, roots []models.Comment) ([]*models.CommentTree, error) {
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	results := make(map[string]*treeResult, len(roots))
+	for _, root := range roots {
+		results[root.ID.Hex()] = &treeResult{Comment: root}
+	}
+
+	var (
+		answers []models.Comment
+		rootIds []string
+	)
+
+	for start := 0; start < len(roots); start += sqlBatchSize {
+		batch := roots[start:min(start+sqlBatchSize, len(roots))]
+
+		args := make([]any, len(batch))
+		for idx, root := range batch {
+			args[idx] = root.ID.Hex()
+		}
+
+		query := `WITH RECURSIVE tree AS (
+			SELECT ` + commentColumns + `, parent_id AS root_id FROM comments WHERE parent_id IN (` + placeholders(len(args)) + `)
+			UNION ALL
+			SELECT ` + prefixColumns("c.", commentColumns) + `, t.root_id
+			FROM comments c JOIN tree t ON c.parent_id = t.id
+		) SELECT ` + commentColumns + `, root_id FROM tree`
+
+		rows, err := r.query(ctx, q, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find answers: %w", err)
+		}
+
+		for rows.Next() {
+			var rootId string
+
+			c, err := scanComment(rows, &rootId)
+			if err != nil {
+				rows.Close()
+
+				return nil, fmt.Errorf("failed to decode comment: %w", err)
+			}
+
+			answers = append(answers, c)
+			rootIds = append(rootIds, rootId)
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to find answers: %w", err)
+		}
+	}
+
+	if err := r.loadReactions(ctx, q, answers); err != nil {
+		return nil, err
+	}
+
+	for idx, c := range answers {
+		if tr, ok := results[rootIds[idx]]; ok {
+			tr.Tree = append(tr.Tree, c)
+		}
+	}
+
+	trees := make([]*models.CommentTree, len(roots))
+	for idx, root := range roots {
+		tree, err := results[root.ID.Hex()].buildCommentTree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build comment tree for %q: %w", root.ID.Hex(), err)
+		}
+
+		trees[idx] = tree
+	}
+
+	return trees, nil
+}
+
+func (r *SQLRepository) getCommentTree(ctx context.Context, q sqlQuerier, id string) (*models.CommentTree, error) {
+	comment, err := r.getComment(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	trees, err := r.loadCommentTrees(ctx, q, []models.Comment{comment})
+	if err != nil {
+		return nil, err
+	}
+
+	return trees[0], nil
+}
+
+func (r *SQLRepository) GetCommentTreeFromCommentID(ctx context.Context, id string) (*models.CommentTree, error) {
+	return r.getCommentTree(ctx, r.db, id)
+}
+
+func (r *SQLRepository) GetCommentTreeByScope(ctx context.Context, scopeId string, reference string) ([]*models.CommentTree, error) {
+	trees, _, err := r.ListCommentTrees(ctx, scopeId, reference, ListOptions{})
+
+	return trees, err
+}
+
+// ListCommentTrees works like MongoRepository.ListCommentTrees.
+func (r *SQLRepository) ListCommentTrees(ctx context.Context, scopeId string, reference string, opts ListOptions) (trees []*models.CommentTree, nextPageToken string, err error) {
+	query := "SELECT " + commentColumns + " FROM comments WHERE scope_id = ? AND parent_id IS NULL"
+	args := []any{scopeId}
+
+	if reference != "" {
+		query += " AND ref = ?"
+		args = append(args, reference)
+	}
+
+	op, direction := ">", "ASC"
+	if opts.Descending {
+		op, direction = "<", "DESC"
+	}
+
+	if opts.PageToken != "" {
+		token, err := decodePageToken(opts.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if token.Descending != opts.Descending {
+			return nil, "", connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("page token does not match the requested sort order"))
+		}
+
+		createdAt := token.CreatedAt.UnixMicro()
+
+		query += " AND (created_at " + op + " ? OR (created_at = ? AND id " + op + " ?))"
+		args = append(args, createdAt, createdAt, token.ID.Hex())
+	}
+
+	query += " ORDER BY created_at " + direction + ", id " + direction
+
+	if opts.PageSize > 0 {
+		// fetch one more row so we know if there's a next page
+		query += " LIMIT ?"
+		args = append(args, opts.PageSize+1)
+	}
+
+	roots, err := r.queryComments(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if opts.PageSize > 0 && len(roots) > opts.PageSize {
+		roots = roots[:opts.PageSize]
+
+		last := roots[len(roots)-1]
+		nextPageToken = pageToken{
+			CreatedAt:  last.CreatedAt,
+			ID:         last.ID,
+			Descending: opts.Descending,
+		}.encode()
+	}
+
+	trees, err = r.loadCommentTrees(ctx, r.db, roots)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return trees, nextPageToken, nil
+}
+
+func (r *SQLRepository) UpdateCommentContent(ctx context.Context, id string, content string, mentions []string, editorId string) (models.Comment, error) {
+	var comment models.Comment
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+
+		comment, err = r.getComment(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		// store the previous version first so we never lose history
+		_, err = r.exec(ctx, tx, "INSERT INTO revisions (id, comment_id, content, edited_at, editor_id) VALUES (?, ?, ?, ?, ?)",
+			primitive.NewObjectID().Hex(),
+			comment.ID.Hex(),
+			comment.Content,
+			sqlTime(now),
+			editorId,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save comment revision: %w", err)
+		}
+
+		// only update the comment if nobody else edited it in the meantime
+		res, err := r.exec(ctx, tx, "UPDATE comments SET content = ?, mentions = ?, canonical_mentions = TRUE, updated_at = ?, revision_count = revision_count + 1 WHERE id = ? AND content = ?",
+			content,
+			sqlStrings(mentions),
+			sqlTime(now),
+			comment.ID.Hex(),
+			comment.Content,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update comment: %w", err)
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return connect.NewError(connect.CodeAborted, fmt.Errorf("comment has been modified concurrently"))
+		}
+
+		comment.Content = content
+		comment.Mentions = mentions
+		comment.CanonicalMentions = true
+		comment.UpdatedAt = now
+		comment.RevisionCount++
+
+		return r.enqueueWebhooks(ctx, tx, events.Edited, comment)
+	})
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	return comment, nil
+}
+
+func (r *SQLRepository) ListCommentRevisions(ctx context.Context, id string) ([]models.CommentRevision, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	rows, err := r.query(ctx, r.db, "SELECT id, comment_id, content, edited_at, editor_id FROM revisions WHERE comment_id = ? ORDER BY edited_at", oid.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.CommentRevision
+	for rows.Next() {
+		var (
+			rev              models.CommentRevision
+			revId, commentId string
+			editedAt         sql.NullInt64
+		)
+
+		if err := rows.Scan(&revId, &commentId, &rev.Content, &editedAt, &rev.EditorID); err != nil {
+			return nil, fmt.Errorf("failed to decode revisions: %w", err)
+		}
+
+		if rev.ID, err = primitive.ObjectIDFromHex(revId); err != nil {
+			return nil, fmt.Errorf("invalid revision id: %w", err)
+		}
+
+		rev.CommentID = oid
+		rev.EditedAt = fromSQLTime(editedAt)
+
+		result = append(result, rev)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *SQLRepository) SoftDeleteComment(ctx context.Context, id string, userId string) (models.Comment, error) {
+	var comment models.Comment
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+
+		comment, err = r.getComment(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if comment.Deleted() {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("comment has already been deleted"))
+		}
+
+		now := time.Now()
+
+		res, err := r.exec(ctx, tx, "UPDATE comments SET content = ?, deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL",
+			models.TombstoneContent,
+			sqlTime(now),
+			userId,
+			comment.ID.Hex(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("comment has already been deleted"))
+		}
+
+		comment.Content = models.TombstoneContent
+		comment.DeletedAt = now
+		comment.DeletedBy = userId
+
+		return r.enqueueWebhooks(ctx, tx, events.Deleted, comment)
+	})
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	return comment, nil
+}
+
+func (r *SQLRepository) PurgeCommentTree(ctx context.Context, id string, userId string) (int64, error) {
+	var deleted int64
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		tree, err := r.getCommentTree(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		var ids []any
+
+		var collect func(t *models.CommentTree)
+		collect = func(t *models.CommentTree) {
+			ids = append(ids, t.Comment.ID.Hex())
+
+			for _, answer := range t.Answers {
+				collect(answer)
+			}
+		}
+		collect(tree)
+
+		in := "(" + placeholders(len(ids)) + ")"
+
+		res, err := r.exec(ctx, tx, "DELETE FROM comments WHERE id IN "+in, ids...)
+		if err != nil {
+			return fmt.Errorf("failed to delete comments: %w", err)
+		}
+
+		deleted, _ = res.RowsAffected()
+
+		statements := []string{
+			"DELETE FROM revisions WHERE comment_id IN " + in,
+			"DELETE FROM comment_reactions WHERE comment_id IN " + in,
+			"DELETE FROM subscriptions WHERE root_id IN " + in,
+		}
+
+		for _, stmt := range statements {
+			if _, err := r.exec(ctx, tx, stmt, ids...); err != nil {
+				return fmt.Errorf("failed to delete comment data: %w", err)
+			}
+		}
+
+		comment := tree.Comment
+		comment.Content = models.TombstoneContent
+		comment.DeletedAt = time.Now()
+		comment.DeletedBy = userId
+
+		return r.enqueueWebhooks(ctx, tx, events.Deleted, comment)
+	})
+
+	return deleted, err
+}
+
+// SearchComments uses the full-text search of the database. The query syntax
+// is the same as for the mongo backend, see textQuery.
+func (r *SQLRepository) SearchComments(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	from, score, cond, args, ok := r.dialect.textSearch(parseTextQuery(q.Text))
+	if !ok {
+		return nil, nil
+	}
+
+	query := "SELECT " + prefixColumns("c.", commentColumns) + ", " + score + " AS score FROM " + from + " WHERE " + cond + " AND c.deleted_at IS NULL"
+
+	switch {
+	case q.Scope != "":
+		query += " AND c.scope_id = ?"
+		args = append(args, q.Scope)
+	case q.Scopes != nil:
+		if len(q.Scopes) == 0 {
+			return nil, nil
+		}
+
+		query += " AND c.scope_id IN (" + placeholders(len(q.Scopes)) + ")"
+		for _, s := range q.Scopes {
+			args = append(args, s)
+		}
+	}
+
+	if q.Reference != "" {
+		query += " AND c.ref = ?"
+		args = append(args, q.Reference)
+	}
+
+	if q.CreatorID != "" {
+		query += " AND c.creator_id = ?"
+		args = append(args, q.CreatorID)
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		query += " AND c.created_at >= ?"
+		args = append(args, q.CreatedAfter.UnixMicro())
+	}
+
+	if !q.CreatedBefore.IsZero() {
+		query += " AND c.created_at < ?"
+		args = append(args, q.CreatedBefore.UnixMicro())
+	}
+
+	query += " ORDER BY score DESC, c.created_at DESC, c.id DESC"
+
+	switch {
+	case q.Limit > 0:
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	case q.Offset > 0:
+		query += " LIMIT " + r.dialect.noLimit
+	}
+
+	if q.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, q.Offset)
+	}
+
+	rows, err := r.query(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search comments: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		hits     []SearchResult
+		comments []models.Comment
+	)
+	for rows.Next() {
+		var hit SearchResult
+
+		hit.Comment, err = scanComment(rows, &hit.Score)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode search results: %w", err)
+		}
+
+		hit.RootID = hit.Comment.ID
+
+		hits = append(hits, hit)
+		comments = append(comments, hit.Comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search comments: %w", err)
+	}
+
+	rows.Close()
+
+	if err := r.loadReactions(ctx, r.db, comments); err != nil {
+		return nil, err
+	}
+
+	for idx := range hits {
+		hits[idx].Comment = comments[idx]
+
+		if hits[idx].Comment.ParentID.IsZero() {
+			continue
+		}
+
+		// find the root of the thread
+		ancestors, err := r.queryComments(ctx, r.db, ancestorsQuery, hits[idx].Comment.ID.Hex())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range ancestors {
+			if a.ParentID.IsZero() {
+				hits[idx].RootID = a.ID
+				break
+			}
+		}
+	}
+
+	return hits, nil
+}
+
+func (r *SQLRepository) insertReaction(ctx context.Context, q sqlQuerier, commentId primitive.ObjectID, reaction models.Reaction) error {
+	_, err := r.exec(ctx, q, "INSERT INTO comment_reactions (comment_id, emoji, user_id, created_at) VALUES (?, ?, ?, ?) ON CONFLICT (comment_id, emoji, user_id) DO NOTHING",
+		commentId.Hex(),
+		reaction.Emoji,
+		reaction.UserID,
+		sqlTime(reaction.CreatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save reaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) AddReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error) {
+	var comment models.Comment
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+
+		comment, err = r.getComment(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if comment.Deleted() {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("cannot react to a deleted comment"))
+		}
+
+		err = r.insertReaction(ctx, tx, comment.ID, models.Reaction{
+			Emoji:     emoji,
+			UserID:    userId,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		comment, err = r.getComment(ctx, tx, id)
+
+		return err
+	})
+
+	return comment, err
+}
+
+func (r *SQLRepository) RemoveReaction(ctx context.Context, id string, emoji string, userId string) (models.Comment, error) {
+	var comment models.Comment
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return connect.NewError(connect.CodeInvalidArgument, err)
+		}
+
+		if _, err := r.exec(ctx, tx, "DELETE FROM comment_reactions WHERE comment_id = ? AND emoji = ? AND user_id = ?", oid.Hex(), emoji, userId); err != nil {
+			return fmt.Errorf("failed to update reactions: %w", err)
+		}
+
+		comment, err = r.getComment(ctx, tx, id)
+
+		return err
+	})
+
+	return comment, err
+}
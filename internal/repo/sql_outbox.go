@@ -0,0 +1,208 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const outboxColumns = "id, comment_id, state, attempts, next_attempt_at, last_error, delivered_to, created_at, updated_at"
+
+func scanOutboxEntry(row sqlScanner) (models.OutboxEntry, error) {
+	var (
+		e                                  models.OutboxEntry
+		id, commentId, deliveredTo         string
+		nextAttemptAt, createdAt, updateAt sql.NullInt64
+	)
+
+	err := row.Scan(&id, &commentId, &e.State, &e.Attempts, &nextAttemptAt, &e.LastError, &deliveredTo, &createdAt, &updateAt)
+	if err != nil {
+		return models.OutboxEntry{}, err
+	}
+
+	if e.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return models.OutboxEntry{}, fmt.Errorf("invalid outbox entry id: %w", err)
+	}
+
+	if e.CommentID, err = primitive.ObjectIDFromHex(commentId); err != nil {
+		return models.OutboxEntry{}, fmt.Errorf("invalid comment id: %w", err)
+	}
+
+	if e.DeliveredTo, err = fromSQLStrings(deliveredTo); err != nil {
+		return models.OutboxEntry{}, err
+	}
+
+	e.NextAttemptAt = fromSQLTime(nextAttemptAt)
+	e.CreatedAt = fromSQLTime(createdAt)
+	e.UpdatedAt = fromSQLTime(updateAt)
+
+	return e, nil
+}
+
+func (r *SQLRepository) createOutboxEntry(ctx context.Context, q sqlQuerier, commentId primitive.ObjectID) error {
+	now := sqlTime(time.Now())
+
+	_, err := r.exec(ctx, q, "INSERT INTO outbox ("+outboxColumns+") VALUES ("+placeholders(9)+")",
+		primitive.NewObjectID().Hex(),
+		commentId.Hex(),
+		string(models.OutboxStatePending),
+		0,
+		now,
+		"",
+		sqlStrings(nil),
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) ClaimOutboxEntry(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error) {
+	now := time.Now()
+
+	if err := r.pruneExpired(ctx, now); err != nil {
+		return nil, err
+	}
+
+	entry, err := scanOutboxEntry(r.queryRow(ctx, r.db, `UPDATE outbox SET
+		next_attempt_at = ?, updated_at = ?, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM outbox WHERE state = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at LIMIT 1`+r.dialect.skipLocked+`
+		) RETURNING `+outboxColumns,
+		now.Add(lease).UnixMicro(),
+		now.UnixMicro(),
+		string(models.OutboxStatePending),
+		now.UnixMicro(),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to claim outbox entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func (r *SQLRepository) CompleteOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string) error {
+	_, err := r.exec(ctx, r.db, "UPDATE outbox SET state = ?, delivered_to = ?, last_error = '', updated_at = ? WHERE id = ?",
+		string(models.OutboxStateDelivered),
+		sqlStrings(deliveredTo),
+		time.Now().UnixMicro(),
+		id.Hex(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) FailOutboxEntry(ctx context.Context, id primitive.ObjectID, deliveredTo []string, reason string, nextAttempt time.Time) error {
+	var err error
+
+	if nextAttempt.IsZero() {
+		_, err = r.exec(ctx, r.db, "UPDATE outbox SET state = ?, delivered_to = ?, last_error = ?, updated_at = ? WHERE id = ?",
+			string(models.OutboxStateFailed),
+			sqlStrings(deliveredTo),
+			reason,
+			time.Now().UnixMicro(),
+			id.Hex(),
+		)
+	} else {
+		_, err = r.exec(ctx, r.db, "UPDATE outbox SET next_attempt_at = ?, delivered_to = ?, last_error = ?, updated_at = ? WHERE id = ?",
+			nextAttempt.UnixMicro(),
+			sqlStrings(deliveredTo),
+			reason,
+			time.Now().UnixMicro(),
+			id.Hex(),
+		)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to update outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) ListOutboxEntries(ctx context.Context, state models.OutboxState) ([]models.OutboxEntry, error) {
+	rows, err := r.query(ctx, r.db, "SELECT "+outboxColumns+" FROM outbox WHERE state = ? ORDER BY created_at, id", string(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find outbox entries: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.OutboxEntry
+	for rows.Next() {
+		e, err := scanOutboxEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode outbox entries: %w", err)
+		}
+
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *SQLRepository) RetryOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error) {
+	return r.transitionOutboxEntry(ctx, id, []models.OutboxState{models.OutboxStateFailed, models.OutboxStateDiscarded},
+		"state = ?, attempts = 0, next_attempt_at = ?",
+		string(models.OutboxStatePending),
+		time.Now().UnixMicro(),
+	)
+}
+
+func (r *SQLRepository) DiscardOutboxEntry(ctx context.Context, id string) (models.OutboxEntry, error) {
+	return r.transitionOutboxEntry(ctx, id, []models.OutboxState{models.OutboxStatePending, models.OutboxStateFailed},
+		"state = ?",
+		string(models.OutboxStateDiscarded),
+	)
+}
+
+func (r *SQLRepository) transitionOutboxEntry(ctx context.Context, id string, from []models.OutboxState, set string, setArgs ...any) (models.OutboxEntry, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.OutboxEntry{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	args := append(setArgs, time.Now().UnixMicro(), oid.Hex())
+	for _, state := range from {
+		args = append(args, string(state))
+	}
+
+	entry, err := scanOutboxEntry(r.queryRow(ctx, r.db,
+		"UPDATE outbox SET "+set+", updated_at = ? WHERE id = ? AND state IN ("+placeholders(len(from))+") RETURNING "+outboxColumns,
+		args...,
+	))
+	if err == nil {
+		return entry, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.OutboxEntry{}, fmt.Errorf("failed to update outbox entry: %w", err)
+	}
+
+	var count int
+	if err := r.queryRow(ctx, r.db, "SELECT COUNT(*) FROM outbox WHERE id = ?", oid.Hex()).Scan(&count); err != nil {
+		return models.OutboxEntry{}, fmt.Errorf("failed to find outbox entry: %w", err)
+	}
+
+	if count == 0 {
+		return models.OutboxEntry{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("outbox entry not found"))
+	}
+
+	return models.OutboxEntry{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("outbox entry is not in one of the states %v", from))
+}
@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const subscriptionColumns = "id, user_id, scope_id, ref, root_id, state, updated_at"
+
+func scanSubscription(row sqlScanner) (models.Subscription, error) {
+	var (
+		s          models.Subscription
+		id, rootId string
+		updatedAt  sql.NullInt64
+	)
+
+	if err := row.Scan(&id, &s.UserID, &s.Scope, &s.Reference, &rootId, &s.State, &updatedAt); err != nil {
+		return models.Subscription{}, err
+	}
+
+	var err error
+	if s.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return models.Subscription{}, fmt.Errorf("invalid subscription id: %w", err)
+	}
+
+	if s.RootID, err = primitive.ObjectIDFromHex(rootId); err != nil {
+		return models.Subscription{}, fmt.Errorf("invalid root id: %w", err)
+	}
+
+	s.UpdatedAt = fromSQLTime(updatedAt)
+
+	return s, nil
+}
+
+func (r *SQLRepository) querySubscriptions(ctx context.Context, query string, args ...any) ([]models.Subscription, error) {
+	rows, err := r.query(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.Subscription
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode subscriptions: %w", err)
+		}
+
+		result = append(result, s)
+	}
+
+	return result, rows.Err()
+}
+
+// SetSubscription stores the root ID of scope subscriptions as the hex
+// encoded NilObjectID so the unique constraint applies to them as well.
+func (r *SQLRepository) SetSubscription(ctx context.Context, userId string, target models.SubscriptionTarget, state models.SubscriptionState) (models.Subscription, error) {
+	sub, err := scanSubscription(r.queryRow(ctx, r.db, `INSERT INTO subscriptions (`+subscriptionColumns+`) VALUES (`+placeholders(7)+`)
+		ON CONFLICT (user_id, scope_id, ref, root_id) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at
+		RETURNING `+subscriptionColumns,
+		primitive.NewObjectID().Hex(),
+		userId,
+		target.Scope,
+		target.Reference,
+		target.RootID.Hex(),
+		string(state),
+		time.Now().UnixMicro(),
+	))
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("failed to save subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+func (r *SQLRepository) DeleteSubscription(ctx context.Context, userId string, target models.SubscriptionTarget) error {
+	res, err := r.exec(ctx, r.db, "DELETE FROM subscriptions WHERE user_id = ? AND scope_id = ? AND ref = ? AND root_id = ?",
+		userId,
+		target.Scope,
+		target.Reference,
+		target.RootID.Hex(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("subscription not found"))
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) ListUserSubscriptions(ctx context.Context, userId string) ([]models.Subscription, error) {
+	return r.querySubscriptions(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE user_id = ? ORDER BY updated_at DESC", userId)
+}
+
+func (r *SQLRepository) FindSubscriptions(ctx context.Context, scope string, reference string, rootId primitive.ObjectID) ([]models.Subscription, error) {
+	nilId := primitive.NilObjectID.Hex()
+
+	query := "SELECT " + subscriptionColumns + " FROM subscriptions WHERE scope_id = ? AND ((ref = '' AND root_id = ?) OR root_id = ?"
+	args := []any{scope, nilId, rootId.Hex()}
+
+	if reference != "" {
+		query += " OR (ref = ? AND root_id = ?)"
+		args = append(args, reference, nilId)
+	}
+
+	return r.querySubscriptions(ctx, query+")", args...)
+}
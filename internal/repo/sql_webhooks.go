@@ -0,0 +1,353 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	webhookColumns         = "id, scope_id, url, secret, events, created_at, creator_id"
+	webhookDeliveryColumns = "id, webhook_id, event, comment_id, state, attempts, payload, next_attempt_at, last_status_code, last_error, created_at, updated_at"
+)
+
+func scanWebhook(row sqlScanner) (models.Webhook, error) {
+	var (
+		w          models.Webhook
+		id, events string
+		createdAt  sql.NullInt64
+	)
+
+	if err := row.Scan(&id, &w.Scope, &w.URL, &w.Secret, &events, &createdAt, &w.CreatorID); err != nil {
+		return models.Webhook{}, err
+	}
+
+	var err error
+	if w.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return models.Webhook{}, fmt.Errorf("invalid webhook id: %w", err)
+	}
+
+	if w.Events, err = fromSQLStrings(events); err != nil {
+		return models.Webhook{}, err
+	}
+
+	w.CreatedAt = fromSQLTime(createdAt)
+
+	return w, nil
+}
+
+func scanWebhookDelivery(row sqlScanner) (models.WebhookDelivery, error) {
+	var (
+		d                                   models.WebhookDelivery
+		id, webhookId, commentId            string
+		nextAttemptAt, createdAt, updatedAt sql.NullInt64
+	)
+
+	err := row.Scan(
+		&id,
+		&webhookId,
+		&d.Event,
+		&commentId,
+		&d.State,
+		&d.Attempts,
+		&d.Payload,
+		&nextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	if d.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("invalid webhook delivery id: %w", err)
+	}
+
+	if d.WebhookID, err = primitive.ObjectIDFromHex(webhookId); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("invalid webhook id: %w", err)
+	}
+
+	if d.CommentID, err = primitive.ObjectIDFromHex(commentId); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("invalid comment id: %w", err)
+	}
+
+	d.NextAttemptAt = fromSQLTime(nextAttemptAt)
+	d.CreatedAt = fromSQLTime(createdAt)
+	d.UpdatedAt = fromSQLTime(updatedAt)
+
+	return d, nil
+}
+
+func (r *SQLRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+
+	_, err := r.exec(ctx, r.db, "INSERT INTO webhooks ("+webhookColumns+") VALUES ("+placeholders(7)+")",
+		webhook.ID.Hex(),
+		webhook.Scope,
+		webhook.URL,
+		webhook.Secret,
+		sqlStrings(webhook.Events),
+		sqlTime(webhook.CreatedAt),
+		webhook.CreatorID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Webhook{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	webhook, err := scanWebhook(r.queryRow(ctx, r.db, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", oid.Hex()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook not found"))
+		}
+
+		return models.Webhook{}, fmt.Errorf("failed to find webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (r *SQLRepository) ListWebhooks(ctx context.Context, scopeId string) ([]models.Webhook, error) {
+	return r.listWebhooks(ctx, r.db, scopeId)
+}
+
+func (r *SQLRepository) listWebhooks(ctx context.Context, q sqlQuerier, scopeId string) ([]models.Webhook, error) {
+	rows, err := r.query(ctx, q, "SELECT "+webhookColumns+" FROM webhooks WHERE scope_id = ? ORDER BY created_at, id", scopeId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode webhooks: %w", err)
+		}
+
+		result = append(result, w)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *SQLRepository) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := r.exec(ctx, tx, "DELETE FROM webhooks WHERE id = ?", id.Hex())
+		if err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook not found"))
+		}
+
+		if _, err := r.exec(ctx, tx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id.Hex()); err != nil {
+			return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// enqueueWebhooks stores a pending delivery of t for all webhooks of the
+// comment's scope in tx.
+func (r *SQLRepository) enqueueWebhooks(ctx context.Context, tx *sql.Tx, t events.Type, comment models.Comment) error {
+	webhooks, err := r.listWebhooks(ctx, tx, comment.Scope)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := models.NewWebhookDeliveries(webhooks, string(t), comment)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		_, err := r.exec(ctx, tx, "INSERT INTO webhook_deliveries ("+webhookDeliveryColumns+") VALUES ("+placeholders(12)+")",
+			d.ID.Hex(),
+			d.WebhookID.Hex(),
+			d.Event,
+			d.CommentID.Hex(),
+			string(d.State),
+			d.Attempts,
+			d.Payload,
+			sqlTime(d.NextAttemptAt),
+			d.LastStatusCode,
+			d.LastError,
+			sqlTime(d.CreatedAt),
+			sqlTime(d.UpdatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save webhook deliveries: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	now := time.Now()
+
+	if err := r.pruneExpired(ctx, now); err != nil {
+		return nil, err
+	}
+
+	delivery, err := scanWebhookDelivery(r.queryRow(ctx, r.db, `UPDATE webhook_deliveries SET
+		next_attempt_at = ?, updated_at = ?, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM webhook_deliveries WHERE state = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at LIMIT 1`+r.dialect.skipLocked+`
+		) RETURNING `+webhookDeliveryColumns,
+		now.Add(lease).UnixMicro(),
+		now.UnixMicro(),
+		string(models.WebhookDeliveryStatePending),
+		now.UnixMicro(),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+
+	return &delivery, nil
+}
+
+func (r *SQLRepository) CompleteWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int) error {
+	_, err := r.exec(ctx, r.db, "UPDATE webhook_deliveries SET state = ?, last_status_code = ?, last_error = '', updated_at = ? WHERE id = ?",
+		string(models.WebhookDeliveryStateDelivered),
+		statusCode,
+		time.Now().UnixMicro(),
+		id.Hex(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) FailWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int, reason string, nextAttempt time.Time) error {
+	var err error
+
+	if nextAttempt.IsZero() {
+		_, err = r.exec(ctx, r.db, "UPDATE webhook_deliveries SET state = ?, last_status_code = ?, last_error = ?, updated_at = ? WHERE id = ?",
+			string(models.WebhookDeliveryStateFailed),
+			statusCode,
+			reason,
+			time.Now().UnixMicro(),
+			id.Hex(),
+		)
+	} else {
+		_, err = r.exec(ctx, r.db, "UPDATE webhook_deliveries SET next_attempt_at = ?, last_status_code = ?, last_error = ?, updated_at = ? WHERE id = ?",
+			nextAttempt.UnixMicro(),
+			statusCode,
+			reason,
+			time.Now().UnixMicro(),
+			id.Hex(),
+		)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLRepository) ListWebhookDeliveries(ctx context.Context, webhookId primitive.ObjectID, state models.WebhookDeliveryState, limit int) ([]models.WebhookDelivery, error) {
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE webhook_id = ?"
+	args := []any{webhookId.Hex()}
+
+	if state != "" {
+		query += " AND state = ?"
+		args = append(args, string(state))
+	}
+
+	query += " ORDER BY created_at DESC, id DESC"
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := r.query(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+		}
+
+		result = append(result, d)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *SQLRepository) GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.WebhookDelivery{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	delivery, err := scanWebhookDelivery(r.queryRow(ctx, r.db, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = ?", oid.Hex()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebhookDelivery{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook delivery not found"))
+		}
+
+		return models.WebhookDelivery{}, fmt.Errorf("failed to find webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+func (r *SQLRepository) RetryWebhookDelivery(ctx context.Context, id primitive.ObjectID) (models.WebhookDelivery, error) {
+	now := time.Now().UnixMicro()
+
+	delivery, err := scanWebhookDelivery(r.queryRow(ctx, r.db, `UPDATE webhook_deliveries SET
+		state = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND state = ? RETURNING `+webhookDeliveryColumns,
+		string(models.WebhookDeliveryStatePending),
+		now,
+		now,
+		id.Hex(),
+		string(models.WebhookDeliveryStateFailed),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebhookDelivery{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("only failed webhook deliveries can be retried"))
+		}
+
+		return models.WebhookDelivery{}, fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
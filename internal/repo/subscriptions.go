@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func subscriptionFilter(userId string, target models.SubscriptionTarget) bson.M {
+	return bson.M{
+		"userId":  userId,
+		"scopeId": target.Scope,
+		"ref":     target.Reference,
+		"rootId":  target.RootID,
+	}
+}
+
+// SetSubscription creates or updates the subscription of userId for target.
+func (r *MongoRepository) SetSubscription(ctx context.Context, userId string, target models.SubscriptionTarget, state models.SubscriptionState) (models.Subscription, error) {
+	sub := models.Subscription{
+		UserID:             userId,
+		SubscriptionTarget: target,
+		State:              state,
+		UpdatedAt:          time.Now(),
+	}
+
+	res := r.subscriptions.FindOneAndUpdate(
+		ctx,
+		subscriptionFilter(userId, target),
+		bson.M{
+			"$set": bson.M{
+				"state":     sub.State,
+				"updatedAt": sub.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{
+				"_id": primitive.NewObjectID(),
+			},
+		},
+		options.FindOneAndUpdate().
+			SetUpsert(true).
+			SetReturnDocument(options.After),
+	)
+
+	if err := res.Err(); err != nil {
+		return models.Subscription{}, fmt.Errorf("failed to save subscription: %w", err)
+	}
+
+	if err := res.Decode(&sub); err != nil {
+		return models.Subscription{}, fmt.Errorf("failed to decode subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// DeleteSubscription removes the subscription of userId for target.
+func (r *MongoRepository) DeleteSubscription(ctx context.Context, userId string, target models.SubscriptionTarget) error {
+	res, err := r.subscriptions.DeleteOne(ctx, subscriptionFilter(userId, target))
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("subscription not found"))
+	}
+
+	return nil
+}
+
+// ListUserSubscriptions returns all subscriptions of userId.
+func (r *MongoRepository) ListUserSubscriptions(ctx context.Context, userId string) ([]models.Subscription, error) {
+	res, err := r.subscriptions.Find(ctx, bson.M{"userId": userId}, options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscriptions: %w", err)
+	}
+
+	var result []models.Subscription
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode subscriptions: %w", err)
+	}
+
+	return result, nil
+}
+
+// FindSubscriptions returns all subscriptions of all users that apply to a
+// comment in the thread rootId with the given scope and reference. This
+// includes subscriptions for the whole scope, the scope and reference, and
+// the thread itself.
+func (r *MongoRepository) FindSubscriptions(ctx context.Context, scope string, reference string, rootId primitive.ObjectID) ([]models.Subscription, error) {
+	targets := bson.A{
+		bson.M{"ref": "", "rootId": primitive.NilObjectID},
+		bson.M{"rootId": rootId},
+	}
+
+	if reference != "" {
+		targets = append(targets, bson.M{"ref": reference, "rootId": primitive.NilObjectID})
+	}
+
+	res, err := r.subscriptions.Find(ctx, bson.M{
+		"scopeId": scope,
+		"$or":     targets,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscriptions: %w", err)
+	}
+
+	var result []models.Subscription
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode subscriptions: %w", err)
+	}
+
+	return result, nil
+}
+
+func (r *MongoRepository) deleteSubscriptionsByScope(ctx context.Context, scopeId string) error {
+	if _, err := r.subscriptions.DeleteMany(ctx, bson.M{"scopeId": scopeId}); err != nil {
+		return fmt.Errorf("failed to delete subscriptions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (r *MongoRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+
+	if _, err := r.webhooks.InsertOne(ctx, webhook); err != nil {
+		return fmt.Errorf("failed to save webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (r *MongoRepository) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Webhook{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	res := r.webhooks.FindOne(ctx, bson.M{"_id": oid})
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Webhook{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook not found"))
+		}
+
+		return models.Webhook{}, fmt.Errorf("failed to find webhook: %w", err)
+	}
+
+	var webhook models.Webhook
+	if err := res.Decode(&webhook); err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to decode webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (r *MongoRepository) ListWebhooks(ctx context.Context, scopeId string) ([]models.Webhook, error) {
+	res, err := r.webhooks.Find(
+		ctx,
+		bson.M{"scopeId": scopeId},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhooks: %w", err)
+	}
+
+	var result []models.Webhook
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+
+	return result, nil
+}
+
+// DeleteWebhook deletes the webhook with id and it's delivery log.
+func (r *MongoRepository) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.webhooks.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook not found"))
+	}
+
+	if _, err := r.webhookDeliveries.DeleteMany(ctx, bson.M{"webhookId": id}); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+func (r *MongoRepository) deleteWebhooksByScope(ctx context.Context, scopeId string) error {
+	webhooks, err := r.ListWebhooks(ctx, scopeId)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range webhooks {
+		if err := r.DeleteWebhook(ctx, w.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enqueueWebhooks stores a pending delivery of t for all webhooks of the
+// comment's scope. It must be called in the same transaction as the change
+// to the comment. Without transaction support the change has already been
+// written when enqueueWebhooks is called so errors are only logged.
+func (r *MongoRepository) enqueueWebhooks(ctx context.Context, t events.Type, comment models.Comment) error {
+	err := r.createWebhookDeliveries(ctx, t, comment)
+	if err != nil && !r.transactions {
+		log.L(ctx).Errorf("failed to enqueue webhook deliveries for comment %q: %s", comment.ID.Hex(), err)
+
+		return nil
+	}
+
+	return err
+}
+
+func (r *MongoRepository) createWebhookDeliveries(ctx context.Context, t events.Type, comment models.Comment) error {
+	webhooks, err := r.ListWebhooks(ctx, comment.Scope)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := models.NewWebhookDeliveries(webhooks, string(t), comment)
+	if err != nil {
+		return err
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	docs := make([]any, len(deliveries))
+	for idx, d := range deliveries {
+		docs[idx] = d
+	}
+
+	if _, err := r.webhookDeliveries.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to save webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimWebhookDelivery returns the next pending webhook delivery that is due.
+// See ClaimOutboxEntry for details on leasing. It returns nil if there is no
+// due delivery.
+func (r *MongoRepository) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	now := time.Now()
+
+	res := r.webhookDeliveries.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"state": models.WebhookDeliveryStatePending,
+			"nextAttemptAt": bson.M{
+				"$lte": now,
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"nextAttemptAt": now.Add(lease),
+				"updatedAt":     now,
+			},
+			"$inc": bson.M{
+				"attempts": 1,
+			},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+			SetReturnDocument(options.After),
+	)
+
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+
+	var delivery models.WebhookDelivery
+	if err := res.Decode(&delivery); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook delivery: %w", err)
+	}
+
+	return &delivery, nil
+}
+
+// CompleteWebhookDelivery marks the delivery as delivered.
+func (r *MongoRepository) CompleteWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int) error {
+	_, err := r.webhookDeliveries.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"state":          models.WebhookDeliveryStateDelivered,
+			"lastStatusCode": statusCode,
+			"updatedAt":      time.Now(),
+		},
+		"$unset": bson.M{
+			"lastError": "",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// FailWebhookDelivery records a failed delivery attempt. If nextAttempt is
+// zero the delivery is marked as failed.
+func (r *MongoRepository) FailWebhookDelivery(ctx context.Context, id primitive.ObjectID, statusCode int, reason string, nextAttempt time.Time) error {
+	set := bson.M{
+		"lastStatusCode": statusCode,
+		"lastError":      reason,
+		"updatedAt":      time.Now(),
+	}
+
+	if nextAttempt.IsZero() {
+		set["state"] = models.WebhookDeliveryStateFailed
+	} else {
+		set["nextAttemptAt"] = nextAttempt
+	}
+
+	if _, err := r.webhookDeliveries.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries returns the most recent deliveries of a webhook,
+// newest first. If state is empty, deliveries in all states are returned.
+func (r *MongoRepository) ListWebhookDeliveries(ctx context.Context, webhookId primitive.ObjectID, state models.WebhookDeliveryState, limit int) ([]models.WebhookDelivery, error) {
+	filter := bson.M{
+		"webhookId": webhookId,
+	}
+
+	if state != "" {
+		filter["state"] = state
+	}
+
+	res, err := r.webhookDeliveries.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+			SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook deliveries: %w", err)
+	}
+
+	var result []models.WebhookDelivery
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetWebhookDelivery returns the webhook delivery with id.
+func (r *MongoRepository) GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.WebhookDelivery{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	res := r.webhookDeliveries.FindOne(ctx, bson.M{"_id": oid})
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.WebhookDelivery{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("webhook delivery not found"))
+		}
+
+		return models.WebhookDelivery{}, fmt.Errorf("failed to find webhook delivery: %w", err)
+	}
+
+	var delivery models.WebhookDelivery
+	if err := res.Decode(&delivery); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to decode webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// RetryWebhookDelivery resets a failed delivery so it will be delivered again
+// as soon as possible.
+func (r *MongoRepository) RetryWebhookDelivery(ctx context.Context, id primitive.ObjectID) (models.WebhookDelivery, error) {
+	now := time.Now()
+
+	res := r.webhookDeliveries.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id":   id,
+			"state": models.WebhookDeliveryStateFailed,
+		},
+		bson.M{
+			"$set": bson.M{
+				"state":         models.WebhookDeliveryStatePending,
+				"attempts":      0,
+				"nextAttemptAt": now,
+				"updatedAt":     now,
+			},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.WebhookDelivery{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("only failed webhook deliveries can be retried"))
+		}
+
+		return models.WebhookDelivery{}, fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	var delivery models.WebhookDelivery
+	if err := res.Decode(&delivery); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to decode webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
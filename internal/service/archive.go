@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/internal/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scope Archives
+
+// exportPageSize is the number of comment threads loaded at once when
+// exporting a scope.
+const exportPageSize = 100
+
+// Values for api.ImportScopeRequest.OnConflict.
+const (
+	importConflictSkip      = "skip"
+	importConflictOverwrite = "overwrite"
+)
+
+func (svc *Service) ExportScope(ctx context.Context, req *connect.Request[api.ExportScopeRequest], stream *connect.ServerStream[api.ArchiveRecord]) error {
+	scope, err := svc.Repository.GetScopeByID(ctx, req.Msg.Scope)
+	if err != nil {
+		return err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return err
+	}
+
+	archivedScope := scope.ToArchive()
+	if err := stream.Send(&api.ArchiveRecord{Scope: &archivedScope}); err != nil {
+		return err
+	}
+
+	opts := repo.ListOptions{
+		PageSize: exportPageSize,
+	}
+
+	for {
+		trees, nextPageToken, err := svc.Repository.ListCommentTrees(ctx, scope.ID, "", opts)
+		if err != nil {
+			return err
+		}
+
+		for _, tree := range trees {
+			if err := sendCommentTree(stream, tree); err != nil {
+				return err
+			}
+		}
+
+		if nextPageToken == "" {
+			return nil
+		}
+
+		opts.PageToken = nextPageToken
+	}
+}
+
+// sendCommentTree sends the comment of tree followed by all answers,
+// recursively.
+func sendCommentTree(stream *connect.ServerStream[api.ArchiveRecord], tree *models.CommentTree) error {
+	comment := tree.Comment.ToArchive()
+	if err := stream.Send(&api.ArchiveRecord{Comment: &comment}); err != nil {
+		return err
+	}
+
+	for _, answer := range tree.Answers {
+		if err := sendCommentTree(stream, answer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportScope reads a scope archive and writes the scope and all comments.
+// The whole archive is validated before anything is written. Imported
+// comments do not trigger notifications, webhooks or comment events.
+func (svc *Service) ImportScope(ctx context.Context, stream *connect.ClientStream[api.ImportScopeRequest]) (*connect.Response[api.ImportScopeResponse], error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var (
+		opts          *api.ImportScopeRequest
+		archivedScope *api.ArchivedScope
+		archived      []api.ArchivedComment
+	)
+
+	for stream.Receive() {
+		msg := stream.Msg()
+		if opts == nil {
+			opts = msg
+		}
+
+		switch {
+		case msg.Record.Scope != nil:
+			if archivedScope != nil {
+				return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("archive contains more than one scope"))
+			}
+
+			archivedScope = msg.Record.Scope
+
+		case msg.Record.Comment != nil:
+			if archivedScope == nil {
+				return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("archive must start with the scope definition"))
+			}
+
+			archived = append(archived, *msg.Record.Comment)
+
+		default:
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("empty archive record"))
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	if archivedScope == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("archive does not contain a scope definition"))
+	}
+
+	switch opts.OnConflict {
+	case "", importConflictSkip, importConflictOverwrite:
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid onConflict value %q", opts.OnConflict))
+	}
+
+	scope := models.ScopeFromArchive(*archivedScope)
+	if opts.Scope != "" {
+		scope.ID = opts.Scope
+	}
+
+	if err := validateArchivedScope(scope); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	comments := make([]models.Comment, len(archived))
+	for idx, c := range archived {
+		comment, err := models.CommentFromArchive(scope.ID, c)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+
+		comments[idx] = comment
+	}
+
+	comments, err := sortCommentTrees(comments)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if !opts.KeepIDs {
+		remapCommentIDs(comments)
+	}
+
+	// check for conflicts before writing anything
+	existingScope, err := svc.Repository.GetScopeByID(ctx, scope.ID)
+	scopeExists := err == nil
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	if opts.OnConflict == "" && scopeExists {
+		return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("scope %q already exists", scope.ID))
+	}
+
+	// comments of other scopes are never skipped or replaced, otherwise an
+	// import could take over their threads.
+	if opts.KeepIDs {
+		for _, c := range comments {
+			existing, err := svc.Repository.GetComment(ctx, c.ID.Hex())
+			if isNotFound(err) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if existing.Scope != scope.ID {
+				return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("comment %s already exists in scope %q", c.ID.Hex(), existing.Scope))
+			}
+
+			if opts.OnConflict == "" {
+				return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("comment %s already exists", c.ID.Hex()))
+			}
+		}
+	}
+
+	switch {
+	case !scopeExists:
+		if _, err := svc.Repository.CreateScope(ctx, &scope); err != nil {
+			return nil, err
+		}
+
+	case opts.OnConflict == importConflictOverwrite:
+		scope.InternalID = existingScope.InternalID
+
+		if err := svc.Repository.UpdateScope(ctx, scope.ID, &scope); err != nil {
+			return nil, err
+		}
+	}
+
+	imported, err := svc.Repository.ImportComments(ctx, comments, opts.OnConflict == importConflictOverwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	log.L(ctx).Infof("imported %d of %d comments into scope %q", imported, len(comments), scope.ID)
+
+	return connect.NewResponse(&api.ImportScopeResponse{
+		Scope:    scope.ID,
+		Imported: imported,
+		Skipped:  len(comments) - imported,
+	}), nil
+}
+
+func validateArchivedScope(scope models.Scope) error {
+	if scope.ID == "" {
+		return fmt.Errorf("scope id is required")
+	}
+
+	switch scope.NotificationType {
+	case models.NotificationTypeUnspecified, models.NotificationTypeSMS, models.NotificationTypeEMail:
+	default:
+		return fmt.Errorf("invalid notification type %q", scope.NotificationType)
+	}
+
+	switch scope.HTMLPolicy {
+	case models.HTMLPolicyOmit, models.HTMLPolicyAllow, models.HTMLPolicyForbid:
+	default:
+		return fmt.Errorf("invalid HTML policy %q", scope.HTMLPolicy)
+	}
+
+	return scope.ValidateViewURLTemplate()
+}
+
+// sortCommentTrees verifies that comments form intact trees, that is, every
+// parent is part of comments and there are no cycles. It returns comments
+// ordered so parents always come before their answers.
+func sortCommentTrees(comments []models.Comment) ([]models.Comment, error) {
+	byId := make(map[primitive.ObjectID]models.Comment, len(comments))
+	for _, c := range comments {
+		if _, ok := byId[c.ID]; ok {
+			return nil, fmt.Errorf("duplicate comment id %s", c.ID.Hex())
+		}
+
+		if c.CreatorID == "" || c.CreatedAt.IsZero() {
+			return nil, fmt.Errorf("comment %s: creatorId and createdAt are required", c.ID.Hex())
+		}
+
+		byId[c.ID] = c
+	}
+
+	var (
+		roots   []primitive.ObjectID
+		answers = make(map[primitive.ObjectID][]primitive.ObjectID)
+	)
+
+	for _, c := range comments {
+		if c.ParentID.IsZero() {
+			roots = append(roots, c.ID)
+			continue
+		}
+
+		if _, ok := byId[c.ParentID]; !ok {
+			return nil, fmt.Errorf("comment %s: parent %s is not part of the archive", c.ID.Hex(), c.ParentID.Hex())
+		}
+
+		answers[c.ParentID] = append(answers[c.ParentID], c.ID)
+	}
+
+	result := make([]models.Comment, 0, len(comments))
+	queue := roots
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		result = append(result, byId[id])
+		queue = append(queue, answers[id]...)
+	}
+
+	// every comment has exactly one parent so comments that cannot be
+	// reached from a root comment are part of a cycle.
+	if len(result) != len(comments) {
+		return nil, fmt.Errorf("archive contains %d comments that are not connected to a root comment", len(comments)-len(result))
+	}
+
+	return result, nil
+}
+
+// remapCommentIDs assigns new IDs to all comments and updates the parent
+// IDs accordingly. comments must be ordered as returned by
+// sortCommentTrees.
+func remapCommentIDs(comments []models.Comment) {
+	ids := make(map[primitive.ObjectID]primitive.ObjectID, len(comments))
+
+	for idx := range comments {
+		id := primitive.NewObjectID()
+		ids[comments[idx].ID] = id
+
+		comments[idx].ID = id
+		if !comments[idx].ParentID.IsZero() {
+			comments[idx].ParentID = ids[comments[idx].ParentID]
+		}
+	}
+}
+
+func isNotFound(err error) bool {
+	var cerr *connect.Error
+
+	return errors.As(err, &cerr) && cerr.Code() == connect.CodeNotFound
+}
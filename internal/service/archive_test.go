@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/config"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+// newArchiveClient serves the extension service of svc and returns a client
+// that is authenticated as an administrator. ExportScope and ImportScope
+// are streaming calls so they cannot be called on svc directly.
+func newArchiveClient(t *testing.T, svc *Service) api.ExtensionServiceClient {
+	t.Helper()
+
+	_, handler := api.NewExtensionServiceHandler(svc)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := api.WithRemoteUser(r.Context(), &auth.RemoteUser{ID: "admin-id", Admin: true})
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(srv.Close)
+
+	return api.NewExtensionServiceClient(srv.Client(), srv.URL)
+}
+
+func exportScope(t *testing.T, client api.ExtensionServiceClient, scope string) []api.ArchiveRecord {
+	t.Helper()
+
+	stream, err := client.ExportScope(context.Background(), connect.NewRequest(&api.ExportScopeRequest{Scope: scope}))
+	if err != nil {
+		t.Fatalf("failed to export scope: %s", err)
+	}
+	defer stream.Close()
+
+	var records []api.ArchiveRecord
+	for stream.Receive() {
+		records = append(records, *stream.Msg())
+	}
+
+	if err := stream.Err(); err != nil {
+		t.Fatalf("failed to export scope: %s", err)
+	}
+
+	return records
+}
+
+func importScope(client api.ExtensionServiceClient, opts api.ImportScopeRequest, records []api.ArchiveRecord) (*api.ImportScopeResponse, error) {
+	stream := client.ImportScope(context.Background())
+
+	for _, record := range records {
+		msg := opts
+		msg.Record = record
+
+		if err := stream.Send(&msg); err != nil {
+			break
+		}
+	}
+
+	res, err := stream.CloseAndReceive()
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Msg, nil
+}
+
+// threadContents returns the content of all comments in scope, each prefixed
+// with the content of its parents.
+func threadContents(t *testing.T, svc *Service, scope string) []string {
+	t.Helper()
+
+	trees, err := svc.Repository.GetCommentTreeByScope(context.Background(), scope, "")
+	if err != nil {
+		t.Fatalf("failed to load comments of %s: %s", scope, err)
+	}
+
+	var (
+		result []string
+		walk   func(prefix string, tree *models.CommentTree)
+	)
+
+	walk = func(prefix string, tree *models.CommentTree) {
+		if tree.Comment.Scope != scope {
+			t.Errorf("comment %s belongs to scope %q, expected %q", tree.Comment.ID.Hex(), tree.Comment.Scope, scope)
+		}
+
+		path := prefix + "/" + tree.Comment.Content
+		result = append(result, path)
+
+		for _, answer := range tree.Answers {
+			walk(path, answer)
+		}
+	}
+
+	for _, tree := range trees {
+		walk("", tree)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
+func createArchiveFixture(t *testing.T, svc *Service) {
+	t.Helper()
+
+	createTestScope(t, svc, models.Scope{ID: "patients", Name: "Patients", OwnerIDs: []string{"alice-id"}})
+
+	ctx := asUser("alice-id")
+
+	root := createTestComment(t, ctx, svc, "patients", "", "the cat needs a vaccination")
+	answer := createTestComment(t, asUser("bob-id"), svc, "", root, "scheduled for monday")
+	createTestComment(t, ctx, svc, "", answer, "thanks")
+	createTestComment(t, ctx, svc, "patients", "", "second thread")
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := newTestService(t, config.Config{})
+	createArchiveFixture(t, source)
+
+	want := threadContents(t, source, "patients")
+
+	records := exportScope(t, newArchiveClient(t, source), "patients")
+	if len(records) != 5 || records[0].Scope == nil || records[0].Scope.ID != "patients" {
+		t.Fatalf("unexpected archive: %+v", records)
+	}
+
+	t.Run("new IDs", func(t *testing.T) {
+		target := newTestService(t, config.Config{})
+		client := newArchiveClient(t, target)
+
+		res, err := importScope(client, api.ImportScopeRequest{Scope: "copy"}, records)
+		if err != nil {
+			t.Fatalf("failed to import scope: %s", err)
+		}
+
+		if res.Scope != "copy" || res.Imported != 4 || res.Skipped != 0 {
+			t.Errorf("unexpected import result: %+v", res)
+		}
+
+		scope, err := target.Repository.GetScopeByID(context.Background(), "copy")
+		if err != nil {
+			t.Fatalf("failed to get imported scope: %s", err)
+		}
+
+		if scope.Name != "Patients" || !slices.Equal(scope.OwnerIDs, []string{"alice-id"}) {
+			t.Errorf("unexpected imported scope: %+v", scope)
+		}
+
+		if got := threadContents(t, target, "copy"); !slices.Equal(want, got) {
+			t.Errorf("expected comments %v, got %v", want, got)
+		}
+
+		for _, record := range records[1:] {
+			_, err := target.Repository.GetComment(context.Background(), record.Comment.ID)
+			requireCode(t, err, connect.CodeNotFound)
+		}
+
+		// importing again fails because the scope exists
+		_, err = importScope(client, api.ImportScopeRequest{Scope: "copy"}, records)
+		requireCode(t, err, connect.CodeAlreadyExists)
+	})
+
+	t.Run("keep IDs", func(t *testing.T) {
+		target := newTestService(t, config.Config{})
+		client := newArchiveClient(t, target)
+
+		res, err := importScope(client, api.ImportScopeRequest{KeepIDs: true}, records)
+		if err != nil {
+			t.Fatalf("failed to import scope: %s", err)
+		}
+
+		if res.Scope != "patients" || res.Imported != 4 {
+			t.Errorf("unexpected import result: %+v", res)
+		}
+
+		for _, record := range records[1:] {
+			c, err := target.Repository.GetComment(context.Background(), record.Comment.ID)
+			if err != nil {
+				t.Fatalf("failed to get comment %s: %s", record.Comment.ID, err)
+			}
+
+			if c.Content != record.Comment.Content || c.CreatorID != record.Comment.CreatorID || !c.CreatedAt.Equal(record.Comment.CreatedAt) {
+				t.Errorf("unexpected comment %s: %+v", record.Comment.ID, c)
+			}
+		}
+
+		if got := exportScope(t, client, "patients"); !slices.EqualFunc(records, got, func(a, b api.ArchiveRecord) bool {
+			if a.Scope != nil || b.Scope != nil {
+				return a.Scope != nil && b.Scope != nil && a.Scope.ID == b.Scope.ID
+			}
+
+			return a.Comment.ID == b.Comment.ID && a.Comment.ParentID == b.Comment.ParentID && a.Comment.Content == b.Comment.Content
+		}) {
+			t.Errorf("expected the export of the imported scope to match the original archive")
+		}
+
+		res, err = importScope(client, api.ImportScopeRequest{KeepIDs: true, OnConflict: importConflictSkip}, records)
+		if err != nil {
+			t.Fatalf("failed to import scope: %s", err)
+		}
+
+		if res.Imported != 0 || res.Skipped != 4 {
+			t.Errorf("expected all comments to be skipped, got %+v", res)
+		}
+
+		res, err = importScope(client, api.ImportScopeRequest{KeepIDs: true, OnConflict: importConflictOverwrite}, records)
+		if err != nil {
+			t.Fatalf("failed to import scope: %s", err)
+		}
+
+		if res.Imported != 4 || res.Skipped != 0 {
+			t.Errorf("expected all comments to be overwritten, got %+v", res)
+		}
+
+		if got := threadContents(t, target, "patients"); !slices.Equal(want, got) {
+			t.Errorf("expected comments %v, got %v", want, got)
+		}
+	})
+}
+
+func TestImportCommentsOfOtherScope(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createArchiveFixture(t, svc)
+
+	want := threadContents(t, svc, "patients")
+
+	client := newArchiveClient(t, svc)
+	records := exportScope(t, client, "patients")
+
+	// an archive that tries to reuse the comment IDs in another scope,
+	// either to replace them or to add answers to their threads.
+	hijacked := slices.Clone(records)
+	hijacked[0].Scope = &api.ArchivedScope{ID: "other", Name: "Other"}
+	hijacked[1].Comment = new(api.ArchivedComment)
+	*hijacked[1].Comment = *records[1].Comment
+	hijacked[1].Comment.Content = "taken over"
+
+	for _, onConflict := range []string{"", importConflictSkip, importConflictOverwrite} {
+		_, err := importScope(client, api.ImportScopeRequest{KeepIDs: true, OnConflict: onConflict}, hijacked)
+		requireCode(t, err, connect.CodeAlreadyExists)
+	}
+
+	if got := threadContents(t, svc, "patients"); !slices.Equal(want, got) {
+		t.Errorf("expected comments %v, got %v", want, got)
+	}
+
+	if _, err := svc.Repository.GetScopeByID(context.Background(), "other"); !isNotFound(err) {
+		t.Errorf("expected the scope not to be created, got %v", err)
+	}
+
+	// the repository enforces the same rule
+	comments, err := svc.Repository.GetCommentTreeByScope(context.Background(), "patients", "")
+	if err != nil {
+		t.Fatalf("failed to load comments: %s", err)
+	}
+
+	foreign := comments[0].Comment
+	foreign.Scope = "other"
+	foreign.Content = "taken over"
+
+	for _, overwrite := range []bool{false, true} {
+		_, err := svc.Repository.ImportComments(context.Background(), []models.Comment{foreign}, overwrite)
+		requireCode(t, err, connect.CodeAlreadyExists)
+	}
+
+	if got := threadContents(t, svc, "patients"); !slices.Equal(want, got) {
+		t.Errorf("expected comments %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+// Authorization
+//
+// Scope owners and administrators are always allowed to manage a scope and
+// to read or write its comments. Other users need one of the reader or
+// writer roles of the scope, if any are configured. Writers are implicitly
+// allowed to read comments.
+
+// AdminRole is the name of the IDM role that grants administrative access.
+// It matches the admin_roles of the CommentService definition.
+const AdminRole = "idm_superuser"
+
+// remoteUserFromProfile converts a user profile to a *auth.RemoteUser so it
+// can be used for authorization checks of users other than the caller.
+func remoteUserFromProfile(p *idmv1.Profile) *auth.RemoteUser {
+	usr := &auth.RemoteUser{
+		ID:            p.GetUser().GetId(),
+		Username:      p.GetUser().GetUsername(),
+		DisplayName:   p.GetUser().GetDisplayName(),
+		ResolvedRoles: p.GetRoles(),
+	}
+
+	for _, role := range p.GetRoles() {
+		usr.RoleIDs = append(usr.RoleIDs, role.GetId())
+	}
+
+	usr.Admin = hasAnyRole(usr, []string{AdminRole})
+
+	return usr
+}
+
+// hasAnyRole returns true if usr has one of roles assigned. roles may contain
+// role IDs or names.
+func hasAnyRole(usr *auth.RemoteUser, roles []string) bool {
+	for _, id := range usr.RoleIDs {
+		if slices.Contains(roles, id) {
+			return true
+		}
+	}
+
+	for _, role := range usr.ResolvedRoles {
+		if slices.Contains(roles, role.GetName()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isScopeManager(usr *auth.RemoteUser, scope models.Scope) bool {
+	if usr == nil {
+		return false
+	}
+
+	return usr.Admin || slices.Contains(scope.OwnerIDs, usr.ID)
+}
+
+func canWriteScope(usr *auth.RemoteUser, scope models.Scope) bool {
+	if usr == nil {
+		return false
+	}
+
+	if isScopeManager(usr, scope) || len(scope.WriterRoles) == 0 {
+		return true
+	}
+
+	return hasAnyRole(usr, scope.WriterRoles)
+}
+
+func canReadScope(usr *auth.RemoteUser, scope models.Scope) bool {
+	if usr == nil {
+		return false
+	}
+
+	if isScopeManager(usr, scope) || len(scope.ReaderRoles) == 0 {
+		return true
+	}
+
+	return hasAnyRole(usr, scope.ReaderRoles) || hasAnyRole(usr, scope.WriterRoles)
+}
+
+// requireScopeManager returns a PermissionDenied error if the remote user is
+// neither an owner of the scope nor an administrator.
+func requireScopeManager(ctx context.Context, scope models.Scope) error {
+	if !isScopeManager(remoteUser(ctx), scope) {
+		return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("only scope owners are allowed to manage scope %q", scope.ID))
+	}
+
+	return nil
+}
+
+// requireScopeAccess loads the scope with the given ID and returns a
+// PermissionDenied error if the remote user is not allowed to read (or write,
+// if write is true) comments of the scope.
+func (svc *Service) requireScopeAccess(ctx context.Context, scopeId string, write bool) (models.Scope, error) {
+	scope, err := svc.Repository.GetScopeByID(ctx, scopeId)
+	if err != nil {
+		return models.Scope{}, err
+	}
+
+	usr := remoteUser(ctx)
+
+	if write && !canWriteScope(usr, scope) {
+		return scope, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to write comments in scope %q", scope.ID))
+	}
+
+	if !write && !canReadScope(usr, scope) {
+		return scope, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to read comments in scope %q", scope.ID))
+	}
+
+	return scope, nil
+}
+
+// readableScopes returns the IDs of all scopes the remote user is allowed to
+// read.
+func (svc *Service) readableScopes(ctx context.Context) ([]string, error) {
+	scopes, err := svc.Repository.ListScopes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usr := remoteUser(ctx)
+
+	result := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if canReadScope(usr, s) {
+			result = append(result, s.ID)
+		}
+	}
+
+	return result, nil
+}
+
+// Scope Access
+
+func (svc *Service) GetScopeAccess(ctx context.Context, req *connect.Request[api.GetScopeAccessRequest]) (*connect.Response[api.GetScopeAccessResponse], error) {
+	scope, err := svc.Repository.GetScopeByID(ctx, req.Msg.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.GetScopeAccessResponse{
+		Access: scope.AccessToAPI(),
+	}), nil
+}
+
+func (svc *Service) UpdateScopeAccess(ctx context.Context, req *connect.Request[api.UpdateScopeAccessRequest]) (*connect.Response[api.UpdateScopeAccessResponse], error) {
+	scope, err := svc.Repository.GetScopeByID(ctx, req.Msg.Access.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	scope.ReaderRoles = uniqueRoles(req.Msg.Access.ReaderRoles)
+	scope.WriterRoles = uniqueRoles(req.Msg.Access.WriterRoles)
+
+	if err := svc.Repository.UpdateScope(ctx, scope.ID, &scope); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.UpdateScopeAccessResponse{
+		Access: scope.AccessToAPI(),
+	}), nil
+}
+
+// uniqueRoles removes empty and duplicate entries from roles while keeping
+// the order.
+func uniqueRoles(roles []string) []string {
+	var result []string
+
+	for _, r := range roles {
+		r = strings.TrimSpace(r)
+		if r == "" || slices.Contains(result, r) {
+			continue
+		}
+
+		result = append(result, r)
+	}
+
+	return result
+}
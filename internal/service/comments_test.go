@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	commentv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/comment/v1"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/config"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+func TestCreateAndGetComment(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+
+	ctx := asUser("alice-id")
+
+	rootId := createTestComment(t, ctx, svc, "patients", "", "first")
+	answerId := createTestComment(t, asUser("bob-id"), svc, "", rootId, "an answer")
+
+	res, err := svc.GetComment(ctx, connect.NewRequest(&commentv1.GetCommentRequest{
+		Id:      rootId,
+		Recurse: true,
+	}))
+	if err != nil {
+		t.Fatalf("failed to get comment: %s", err)
+	}
+
+	if got := res.Msg.Result.Comment; got.Content != "first" || got.CreatorId != "alice-id" {
+		t.Errorf("unexpected root comment: %v", got)
+	}
+
+	if len(res.Msg.Result.Answers) != 1 || res.Msg.Result.Answers[0].Comment.Id != answerId {
+		t.Fatalf("expected answer %s, got %v", answerId, res.Msg.Result.Answers)
+	}
+}
+
+func TestCreateCommentErrors(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+	createTestScope(t, svc, models.Scope{ID: "restricted", WriterRoles: []string{"vets"}})
+
+	root := func(scope string) *commentv1.CreateCommentRequest {
+		return &commentv1.CreateCommentRequest{
+			Content: "content",
+			Kind: &commentv1.CreateCommentRequest_Root{
+				Root: &commentv1.RootComment{Scope: scope},
+			},
+		}
+	}
+
+	_, err := svc.CreateComment(asUser("alice-id"), connect.NewRequest(root("unknown")))
+	requireCode(t, err, connect.CodeNotFound)
+
+	_, err = svc.CreateComment(asUser("alice-id"), connect.NewRequest(root("restricted")))
+	requireCode(t, err, connect.CodePermissionDenied)
+
+	_, err = svc.CreateComment(asUser("alice-id"), connect.NewRequest(&commentv1.CreateCommentRequest{
+		Content: "content",
+		Kind:    &commentv1.CreateCommentRequest_ParentId{ParentId: "000000000000000000000000"},
+	}))
+	requireCode(t, err, connect.CodeNotFound)
+}
+
+func TestUpdateComment(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+
+	ctx := asUser("alice-id")
+	id := createTestComment(t, ctx, svc, "patients", "", "first version")
+
+	_, err := svc.UpdateComment(asUser("bob-id"), connect.NewRequest(&api.UpdateCommentRequest{
+		ID:      id,
+		Content: "hijacked",
+	}))
+	requireCode(t, err, connect.CodePermissionDenied)
+
+	_, err = svc.UpdateComment(ctx, connect.NewRequest(&api.UpdateCommentRequest{
+		ID:      id,
+		Content: "  ",
+	}))
+	requireCode(t, err, connect.CodeInvalidArgument)
+
+	for _, content := range []string{"second version", "second version", "third version"} {
+		if _, err := svc.UpdateComment(ctx, connect.NewRequest(&api.UpdateCommentRequest{ID: id, Content: content})); err != nil {
+			t.Fatalf("failed to update comment: %s", err)
+		}
+	}
+
+	res, err := svc.ListCommentRevisions(ctx, connect.NewRequest(&api.ListCommentRevisionsRequest{ID: id}))
+	if err != nil {
+		t.Fatalf("failed to list revisions: %s", err)
+	}
+
+	if got := res.Msg.Comment; got.Content != "third version" || !got.Edited || got.RevisionCount != 2 {
+		t.Errorf("unexpected comment after editing: %+v", got)
+	}
+
+	// updating with the same content must not create a revision
+	var contents []string
+	for _, r := range res.Msg.Revisions {
+		contents = append(contents, r.Content)
+	}
+
+	if want := "first version,second version"; strings.Join(contents, ",") != want {
+		t.Errorf("expected revisions %q, got %q", want, contents)
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients", OwnerIDs: []string{"bob-id"}})
+
+	ctx := asUser("alice-id")
+
+	rootId := createTestComment(t, ctx, svc, "patients", "", "secret")
+	answerId := createTestComment(t, ctx, svc, "", rootId, "answer")
+
+	if _, err := svc.UpdateComment(ctx, connect.NewRequest(&api.UpdateCommentRequest{ID: rootId, Content: "more secret"})); err != nil {
+		t.Fatalf("failed to update comment: %s", err)
+	}
+
+	_, err := svc.DeleteComment(asUser("carol-id"), connect.NewRequest(&api.DeleteCommentRequest{ID: rootId}))
+	requireCode(t, err, connect.CodePermissionDenied)
+
+	// scope owners may delete all comments
+	res, err := svc.DeleteComment(asUser("bob-id"), connect.NewRequest(&api.DeleteCommentRequest{ID: rootId}))
+	if err != nil {
+		t.Fatalf("failed to delete comment: %s", err)
+	}
+
+	if got := res.Msg.Comment; !got.Deleted || got.DeletedBy != "bob-id" || got.Content != models.TombstoneContent {
+		t.Errorf("unexpected deleted comment: %+v", got)
+	}
+
+	_, err = svc.DeleteComment(ctx, connect.NewRequest(&api.DeleteCommentRequest{ID: rootId}))
+	requireCode(t, err, connect.CodeFailedPrecondition)
+
+	_, err = svc.UpdateComment(ctx, connect.NewRequest(&api.UpdateCommentRequest{ID: rootId, Content: "revived"}))
+	requireCode(t, err, connect.CodeFailedPrecondition)
+
+	// the answer stays attached to the tombstone
+	tree, err := svc.GetCommentDetails(ctx, connect.NewRequest(&api.GetCommentDetailsRequest{ID: rootId, Recurse: true}))
+	if err != nil {
+		t.Fatalf("failed to get comment: %s", err)
+	}
+
+	if len(tree.Msg.Result.Answers) != 1 || tree.Msg.Result.Answers[0].Comment.ID != answerId {
+		t.Errorf("expected answer %s to be kept, got %+v", answerId, tree.Msg.Result.Answers)
+	}
+
+	// revisions of deleted comments are only visible to administrators
+	revisions, err := svc.ListCommentRevisions(ctx, connect.NewRequest(&api.ListCommentRevisionsRequest{ID: rootId}))
+	if err != nil {
+		t.Fatalf("failed to list revisions: %s", err)
+	}
+
+	if len(revisions.Msg.Revisions) != 0 {
+		t.Errorf("expected no revisions for a deleted comment, got %+v", revisions.Msg.Revisions)
+	}
+
+	revisions, err = svc.ListCommentRevisions(asAdmin(), connect.NewRequest(&api.ListCommentRevisionsRequest{ID: rootId}))
+	if err != nil {
+		t.Fatalf("failed to list revisions: %s", err)
+	}
+
+	if len(revisions.Msg.Revisions) != 1 {
+		t.Errorf("expected administrators to see the revision, got %+v", revisions.Msg.Revisions)
+	}
+}
+
+func TestPurgeComment(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+
+	ctx := asUser("alice-id")
+
+	rootId := createTestComment(t, ctx, svc, "patients", "", "root")
+	answerId := createTestComment(t, ctx, svc, "", rootId, "answer")
+	createTestComment(t, ctx, svc, "", answerId, "answer to answer")
+
+	_, err := svc.DeleteComment(ctx, connect.NewRequest(&api.DeleteCommentRequest{ID: rootId, Purge: true}))
+	requireCode(t, err, connect.CodePermissionDenied)
+
+	res, err := svc.DeleteComment(asAdmin(), connect.NewRequest(&api.DeleteCommentRequest{ID: answerId, Purge: true}))
+	if err != nil {
+		t.Fatalf("failed to purge comment: %s", err)
+	}
+
+	if res.Msg.PurgedCount != 2 {
+		t.Errorf("expected 2 purged comments, got %d", res.Msg.PurgedCount)
+	}
+
+	_, err = svc.GetComment(ctx, connect.NewRequest(&commentv1.GetCommentRequest{Id: answerId}))
+	requireCode(t, err, connect.CodeNotFound)
+
+	if _, err := svc.GetComment(ctx, connect.NewRequest(&commentv1.GetCommentRequest{Id: rootId})); err != nil {
+		t.Errorf("expected the root comment to be kept: %s", err)
+	}
+}
+
+func TestListCommentThreads(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+
+	ctx := asUser("alice-id")
+
+	var ids []string
+	for _, content := range []string{"one", "two", "three"} {
+		ids = append(ids, createTestComment(t, ctx, svc, "patients", "", content))
+	}
+
+	createTestComment(t, ctx, svc, "", ids[0], "answer")
+
+	list := func(order string, pageToken string) *api.ListCommentThreadsResponse {
+		t.Helper()
+
+		res, err := svc.ListCommentThreads(ctx, connect.NewRequest(&api.ListCommentThreadsRequest{
+			Scope:     "patients",
+			Recurse:   true,
+			PageSize:  2,
+			PageToken: pageToken,
+			Order:     order,
+		}))
+		if err != nil {
+			t.Fatalf("failed to list threads: %s", err)
+		}
+
+		return res.Msg
+	}
+
+	var got []string
+
+	first := list("", "")
+	for _, thread := range first.Threads {
+		got = append(got, thread.Comment.ID)
+	}
+
+	if first.NextPageToken == "" {
+		t.Fatalf("expected a next page token")
+	}
+
+	second := list("", first.NextPageToken)
+	for _, thread := range second.Threads {
+		got = append(got, thread.Comment.ID)
+	}
+
+	if second.NextPageToken != "" {
+		t.Errorf("expected no next page token on the last page, got %q", second.NextPageToken)
+	}
+
+	if strings.Join(got, ",") != strings.Join(ids, ",") {
+		t.Errorf("expected threads %v, got %v", ids, got)
+	}
+
+	if len(first.Threads[0].Answers) != 1 {
+		t.Errorf("expected the answer to be included, got %+v", first.Threads[0].Answers)
+	}
+
+	if desc := list("desc", ""); desc.Threads[0].Comment.ID != ids[2] {
+		t.Errorf("expected %s first in descending order, got %s", ids[2], desc.Threads[0].Comment.ID)
+	}
+
+	_, err := svc.ListCommentThreads(ctx, connect.NewRequest(&api.ListCommentThreadsRequest{Scope: "patients", Order: "random"}))
+	requireCode(t, err, connect.CodeInvalidArgument)
+
+	_, err = svc.ListCommentThreads(ctx, connect.NewRequest(&api.ListCommentThreadsRequest{Scope: "patients", PageToken: "invalid"}))
+	requireCode(t, err, connect.CodeInvalidArgument)
+}
+
+func TestSearchComments(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+	createTestScope(t, svc, models.Scope{ID: "restricted", ReaderRoles: []string{"vets"}})
+
+	ctx := asUser("alice-id")
+
+	rootId := createTestComment(t, ctx, svc, "patients", "", "the cat needs a vaccination")
+	answerId := createTestComment(t, ctx, svc, "", rootId, "vaccination scheduled for monday")
+	createTestComment(t, ctx, svc, "patients", "", "the dog is fine")
+	createTestComment(t, asAdmin(), svc, "restricted", "", "restricted vaccination")
+
+	search := func(ctx context.Context, query string) []api.SearchResult {
+		t.Helper()
+
+		res, err := svc.SearchComments(ctx, connect.NewRequest(&api.SearchCommentsRequest{Query: query}))
+		if err != nil {
+			t.Fatalf("failed to search comments: %s", err)
+		}
+
+		return res.Msg.Results
+	}
+
+	results := search(ctx, "vaccination")
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results from readable scopes, got %+v", results)
+	}
+
+	for _, r := range results {
+		if r.RootID != rootId {
+			t.Errorf("expected root %s for result %s, got %s", rootId, r.Comment.ID, r.RootID)
+		}
+
+		if !strings.Contains(r.Snippet, "<mark>vaccination</mark>") {
+			t.Errorf("expected a highlighted snippet, got %q", r.Snippet)
+		}
+	}
+
+	if results := search(ctx, "vaccination -monday"); len(results) != 1 || results[0].Comment.ID == answerId {
+		t.Errorf("expected negated terms to exclude the answer, got %+v", results)
+	}
+
+	if results := search(ctx, `"dog is fine"`); len(results) != 1 {
+		t.Errorf("expected the phrase to match one comment, got %+v", results)
+	}
+
+	if results := search(asAdmin(), "vaccination"); len(results) != 3 {
+		t.Errorf("expected administrators to search all scopes, got %+v", results)
+	}
+
+	_, err := svc.SearchComments(ctx, connect.NewRequest(&api.SearchCommentsRequest{Query: " "}))
+	requireCode(t, err, connect.CodeInvalidArgument)
+}
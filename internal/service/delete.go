@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+// Comment Deletion
+
+func (svc *Service) DeleteComment(ctx context.Context, req *connect.Request[api.DeleteCommentRequest]) (*connect.Response[api.DeleteCommentResponse], error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return nil, fmt.Errorf("no remote user specified")
+	}
+
+	if req.Msg.Purge {
+		// purging removes all answers as well so only administrators
+		// are allowed to do that.
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+
+		comment, err := svc.Repository.GetComment(ctx, req.Msg.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		count, err := svc.Repository.PurgeCommentTree(ctx, req.Msg.ID, usr.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		comment.Content = models.TombstoneContent
+		comment.DeletedAt = time.Now()
+		comment.DeletedBy = usr.ID
+
+		svc.commentChanged(events.Deleted, comment)
+
+		return connect.NewResponse(&api.DeleteCommentResponse{
+			PurgedCount: count,
+		}), nil
+	}
+
+	comment, err := svc.Repository.GetComment(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err := svc.Repository.GetScopeByID(ctx, comment.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// scope owners and administrators may moderate all comments while
+	// the creator needs to be allowed to write comments in the scope.
+	switch {
+	case isScopeManager(usr, scope):
+	case comment.CreatorID != usr.ID:
+		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("only the creator of a comment is allowed to delete it"))
+	case !canWriteScope(usr, scope):
+		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to write comments in scope %q", scope.ID))
+	}
+
+	comment, err = svc.Repository.SoftDeleteComment(ctx, req.Msg.ID, usr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.commentChanged(events.Deleted, comment)
+
+	apiComment := comment.ToAPI()
+
+	return connect.NewResponse(&api.DeleteCommentResponse{
+		Comment: &apiComment,
+	}), nil
+}
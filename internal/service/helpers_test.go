@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	commentv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/comment/v1"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/config"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/internal/profiles"
+	"github.com/tierklinik-dobersberg/comment-service/internal/repo"
+)
+
+// testUsers are the users known to the fake IDM of newTestService.
+var testUsers = []*idmv1.Profile{
+	{User: &idmv1.User{Id: "alice-id", Username: "alice", DisplayName: "Alice"}},
+	{User: &idmv1.User{Id: "bob-id", Username: "bob", DisplayName: "Bob"}},
+}
+
+// testRoles are the roles known to the fake IDM of newTestService.
+var testRoles = []*idmv1.Role{
+	{Id: "vets-id", Name: "vets"},
+}
+
+type fakeUsers struct {
+	idmv1connect.UserServiceClient
+
+	profiles []*idmv1.Profile
+}
+
+func (f *fakeUsers) ListUsers(ctx context.Context, req *connect.Request[idmv1.ListUsersRequest]) (*connect.Response[idmv1.ListUsersResponse], error) {
+	return connect.NewResponse(&idmv1.ListUsersResponse{
+		Users: f.profiles,
+	}), nil
+}
+
+func (f *fakeUsers) GetUser(ctx context.Context, req *connect.Request[idmv1.GetUserRequest]) (*connect.Response[idmv1.GetUserResponse], error) {
+	for _, p := range f.profiles {
+		if p.GetUser().GetId() == req.Msg.GetId() {
+			return connect.NewResponse(&idmv1.GetUserResponse{
+				Profile: p,
+			}), nil
+		}
+	}
+
+	return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
+}
+
+type fakeRoles struct {
+	idmv1connect.RoleServiceClient
+
+	roles []*idmv1.Role
+}
+
+func (f *fakeRoles) ListRoles(ctx context.Context, req *connect.Request[idmv1.ListRolesRequest]) (*connect.Response[idmv1.ListRolesResponse], error) {
+	return connect.NewResponse(&idmv1.ListRolesResponse{
+		Roles: f.roles,
+	}), nil
+}
+
+// newTestService returns a service backed by an in-memory repository and a
+// fake IDM that knows testUsers and testRoles.
+func newTestService(t *testing.T, cfg config.Config) *Service {
+	t.Helper()
+
+	return New(&config.Providers{
+		Config:     cfg,
+		Repository: repo.NewMemoryRepository(),
+		Events:     events.NewBus(),
+		Profiles:   profiles.NewCache(&fakeUsers{profiles: testUsers}, &fakeRoles{roles: testRoles}, time.Minute),
+	})
+}
+
+// asUser returns a context authenticated as the user with id.
+func asUser(id string) context.Context {
+	return api.WithRemoteUser(context.Background(), &auth.RemoteUser{ID: id})
+}
+
+// asAdmin returns a context authenticated as an administrator.
+func asAdmin() context.Context {
+	return api.WithRemoteUser(context.Background(), &auth.RemoteUser{ID: "admin-id", Admin: true})
+}
+
+func createTestScope(t *testing.T, svc *Service, scope models.Scope) {
+	t.Helper()
+
+	if scope.Name == "" {
+		scope.Name = scope.ID
+	}
+
+	if _, err := svc.Repository.CreateScope(context.Background(), &scope); err != nil {
+		t.Fatalf("failed to create scope: %s", err)
+	}
+}
+
+// createTestComment creates a root comment in scope, or an answer if parent
+// is set, and returns its ID.
+func createTestComment(t *testing.T, ctx context.Context, svc *Service, scope string, parent string, content string) string {
+	t.Helper()
+
+	req := &commentv1.CreateCommentRequest{
+		Content: content,
+	}
+
+	if parent != "" {
+		req.Kind = &commentv1.CreateCommentRequest_ParentId{ParentId: parent}
+	} else {
+		req.Kind = &commentv1.CreateCommentRequest_Root{Root: &commentv1.RootComment{Scope: scope}}
+	}
+
+	res, err := svc.CreateComment(ctx, connect.NewRequest(req))
+	if err != nil {
+		t.Fatalf("failed to create comment: %s", err)
+	}
+
+	return res.Msg.Comment.Id
+}
+
+// requireCode fails the test if err is not a connect error with code.
+func requireCode(t *testing.T, err error, code connect.Code) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected a %s error, got nil", code)
+	}
+
+	if got := connect.CodeOf(err); got != code {
+		t.Fatalf("expected a %s error, got %s: %s", code, got, err)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/repo"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+func (svc *Service) ListCommentThreads(ctx context.Context, req *connect.Request[api.ListCommentThreadsRequest]) (*connect.Response[api.ListCommentThreadsResponse], error) {
+	if req.Msg.Scope == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("scope is required"))
+	}
+
+	scope, err := svc.requireScopeAccess(ctx, req.Msg.Scope, false)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := repo.ListOptions{
+		PageSize:  req.Msg.PageSize,
+		PageToken: req.Msg.PageToken,
+	}
+
+	switch {
+	case opts.PageSize < 0:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page size"))
+	case opts.PageSize == 0:
+		opts.PageSize = defaultPageSize
+	case opts.PageSize > maxPageSize:
+		opts.PageSize = maxPageSize
+	}
+
+	switch req.Msg.Order {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid order %q, expected asc or desc", req.Msg.Order))
+	}
+
+	trees, nextPageToken, err := svc.Repository.ListCommentTrees(ctx, req.Msg.Scope, req.Msg.Reference, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.ListCommentThreadsResponse{
+		Threads:       make([]api.CommentTree, len(trees)),
+		NextPageToken: nextPageToken,
+	}
+
+	if req.Msg.RenderHTML {
+		if err := svc.renderCommentTrees(ctx, scope, trees...); err != nil {
+			return nil, err
+		}
+	}
+
+	for idx, tree := range trees {
+		res.Threads[idx] = tree.ToAPI(req.Msg.Recurse)
+
+		if usr := remoteUser(ctx); usr != nil {
+			markTreeReacted(&res.Threads[idx], usr.ID)
+		}
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+// GetCommentDetails is like GetComment of the CommentService but returns
+// the extended comment representation, including reactions and the
+// profiles of mentioned users.
+func (svc *Service) GetCommentDetails(ctx context.Context, req *connect.Request[api.GetCommentDetailsRequest]) (*connect.Response[api.GetCommentDetailsResponse], error) {
+	tree, err := svc.Repository.GetCommentTreeFromCommentID(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err := svc.requireScopeAccess(ctx, tree.Comment.Scope, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.RenderHTML {
+		if err := svc.renderCommentTrees(ctx, scope, tree); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &api.GetCommentDetailsResponse{
+		Result: tree.ToAPI(req.Msg.Recurse),
+	}
+
+	svc.setMentionedUsers(ctx, &res.Result)
+
+	if usr := remoteUser(ctx); usr != nil {
+		markTreeReacted(&res.Result, usr.ID)
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+// setMentionedUsers sets the MentionedUsers of all comments in tree. The
+// profiles of all comments are loaded at once.
+func (svc *Service) setMentionedUsers(ctx context.Context, tree *api.CommentTree) {
+	var (
+		comments []*api.Comment
+		ids      []string
+		collect  func(tree *api.CommentTree)
+	)
+
+	collect = func(tree *api.CommentTree) {
+		comments = append(comments, &tree.Comment)
+		ids = append(ids, tree.Comment.Mentions...)
+
+		for idx := range tree.Answers {
+			collect(&tree.Answers[idx])
+		}
+	}
+
+	collect(tree)
+
+	profiles, err := svc.Profiles.ResolveIDs(ctx, ids)
+	if err != nil {
+		log.L(ctx).Errorf("failed to load profiles of mentioned users: %s", err)
+	}
+
+	for _, c := range comments {
+		for _, id := range c.Mentions {
+			user := profiles[id].GetUser()
+
+			c.MentionedUsers = append(c.MentionedUsers, api.MentionedUser{
+				ID:          id,
+				Username:    user.GetUsername(),
+				DisplayName: user.GetDisplayName(),
+			})
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	commentv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/comment/v1"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/config"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/internal/profiles"
+	"github.com/tierklinik-dobersberg/comment-service/pkg/goldmark-extensions/mentions"
+)
+
+func TestStoredMentions(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+
+	ctx := asUser("alice-id")
+
+	rootId := createTestComment(t, ctx, svc, "patients", "", "hello @bob and @Alice")
+
+	stored, err := svc.Repository.GetComment(context.Background(), rootId)
+	if err != nil {
+		t.Fatalf("failed to get comment: %s", err)
+	}
+
+	if stored.Content != "hello @bob-id and @alice-id" || !slices.Equal(stored.Mentions, []string{"bob-id", "alice-id"}) {
+		t.Errorf("expected mentions to be stored by ID, got %q %v", stored.Content, stored.Mentions)
+	}
+
+	// mentions are quoted if the following text would continue the ID
+	for _, tc := range []struct{ content, want string }{
+		{`@"Bob"s turn`, `@"bob-id"s turn`},
+		{`@"Bob"-ish`, `@"bob-id"-ish`},
+		{`@"Bob", hi`, "@bob-id, hi"},
+	} {
+		id := createTestComment(t, ctx, svc, "patients", "", tc.content)
+
+		c, err := svc.Repository.GetComment(context.Background(), id)
+		if err != nil {
+			t.Fatalf("failed to get comment: %s", err)
+		}
+
+		if c.Content != tc.want || !slices.Equal(c.Mentions, []string{"bob-id"}) {
+			t.Errorf("%q: expected %q, got %q %v", tc.content, tc.want, c.Content, c.Mentions)
+		}
+
+		if nodes := mentions.Collect(context.Background(), []byte(c.Content), nil); len(nodes) != 1 || string(nodes[0].Tag) != "bob-id" {
+			t.Errorf("%q: stored content is parsed as %v", tc.content, nodes)
+		}
+	}
+
+	// a comment that mentions a user that no longer exists
+	_, err = svc.Repository.CreateComment(context.Background(), models.Comment{
+		Scope:     "patients",
+		ParentID:  stored.ID,
+		Content:   "ping @gone-id",
+		Mentions:  []string{"gone-id"},
+		CreatorID: "bob-id",
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create comment: %s", err)
+	}
+
+	res, err := svc.GetCommentDetails(ctx, connect.NewRequest(&api.GetCommentDetailsRequest{
+		ID:         rootId,
+		Recurse:    true,
+		RenderHTML: true,
+	}))
+	if err != nil {
+		t.Fatalf("failed to get comment details: %s", err)
+	}
+
+	want := []api.MentionedUser{
+		{ID: "bob-id", Username: "bob", DisplayName: "Bob"},
+		{ID: "alice-id", Username: "alice", DisplayName: "Alice"},
+	}
+
+	if got := res.Msg.Result.Comment.MentionedUsers; !slices.Equal(want, got) {
+		t.Errorf("expected mentioned users %v, got %v", want, got)
+	}
+
+	if len(res.Msg.Result.Answers) != 1 {
+		t.Fatalf("expected one answer, got %d", len(res.Msg.Result.Answers))
+	}
+
+	want = []api.MentionedUser{{ID: "gone-id"}}
+	if got := res.Msg.Result.Answers[0].Comment.MentionedUsers; !slices.Equal(want, got) {
+		t.Errorf("expected mentioned users %v, got %v", want, got)
+	}
+}
+
+func TestUnresolvedMentions(t *testing.T) {
+	root := func(content string) *connect.Request[commentv1.CreateCommentRequest] {
+		return connect.NewRequest(&commentv1.CreateCommentRequest{
+			Content: content,
+			Kind: &commentv1.CreateCommentRequest_Root{
+				Root: &commentv1.RootComment{Scope: "patients"},
+			},
+		})
+	}
+
+	svc := newTestService(t, config.Config{UnresolvedMentions: string(mentions.UnresolvedReject)})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+
+	ctx := asUser("alice-id")
+
+	_, err := svc.CreateComment(ctx, root("hello @nobody and @bob"))
+	requireCode(t, err, connect.CodeInvalidArgument)
+
+	if !strings.Contains(err.Error(), "@nobody") || strings.Contains(err.Error(), "@bob") {
+		t.Errorf("expected only @nobody to be reported, got %q", err)
+	}
+
+	for _, content := range []string{"hello @bob", "hello @vets", "user@example.com", "`@nobody`"} {
+		if _, err := svc.CreateComment(ctx, root(content)); err != nil {
+			t.Errorf("%q: expected the comment to be accepted, got %s", content, err)
+		}
+	}
+
+	// other modes store unresolved mentions as they are
+	for _, mode := range []mentions.UnresolvedMode{mentions.UnresolvedText, mentions.UnresolvedSpan} {
+		svc := newTestService(t, config.Config{UnresolvedMentions: string(mode)})
+		createTestScope(t, svc, models.Scope{ID: "patients"})
+
+		res, err := svc.CreateComment(ctx, root("hello @nobody"))
+		if err != nil {
+			t.Fatalf("%s: failed to create comment: %s", mode, err)
+		}
+
+		stored, err := svc.Repository.GetComment(context.Background(), res.Msg.Comment.Id)
+		if err != nil {
+			t.Fatalf("failed to get comment: %s", err)
+		}
+
+		if stored.Content != "hello @nobody" || len(stored.Mentions) != 0 {
+			t.Errorf("%s: unexpected comment %q %v", mode, stored.Content, stored.Mentions)
+		}
+	}
+}
+
+// TestCanonicalMentions checks that mentions which did not match a user when
+// the comment was written are not bound to users created later on, while
+// older comments still resolve mentions by name.
+func TestCanonicalMentions(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients"})
+
+	ctx := asUser("alice-id")
+
+	rootId := createTestComment(t, ctx, svc, "patients", "", "hi @carol, @bob and @vets")
+
+	root, err := svc.Repository.GetComment(context.Background(), rootId)
+	if err != nil {
+		t.Fatalf("failed to get comment: %s", err)
+	}
+
+	if !root.CanonicalMentions {
+		t.Errorf("expected new comments to have canonical mentions")
+	}
+
+	// a comment written before mentions were stored by ID
+	_, err = svc.Repository.CreateComment(context.Background(), models.Comment{
+		Scope:     "patients",
+		ParentID:  root.ID,
+		Content:   "hello @carol",
+		CreatorID: "bob-id",
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create comment: %s", err)
+	}
+
+	// carol joins after the comments have been written
+	svc.Profiles = profiles.NewCache(&fakeUsers{
+		profiles: append(slices.Clone(testUsers), &idmv1.Profile{
+			User: &idmv1.User{Id: "carol-id", Username: "carol", DisplayName: "Carol"},
+		}),
+	}, &fakeRoles{roles: testRoles}, time.Minute)
+
+	res, err := svc.GetCommentDetails(ctx, connect.NewRequest(&api.GetCommentDetailsRequest{
+		ID:         rootId,
+		Recurse:    true,
+		RenderHTML: true,
+	}))
+	if err != nil {
+		t.Fatalf("failed to get comment details: %s", err)
+	}
+
+	content := res.Msg.Result.Comment.Content
+	if strings.Contains(content, "carol-id") || !strings.Contains(content, `data-user-id="bob-id"`) || !strings.Contains(content, `data-role="vets-id"`) {
+		t.Errorf("unexpected mentions in canonical comment: %s", content)
+	}
+
+	if len(res.Msg.Result.Answers) != 1 {
+		t.Fatalf("expected one answer, got %d", len(res.Msg.Result.Answers))
+	}
+
+	if content := res.Msg.Result.Answers[0].Comment.Content; !strings.Contains(content, `data-user-id="carol-id"`) {
+		t.Errorf("expected @carol to be resolved in older comments: %s", content)
+	}
+}
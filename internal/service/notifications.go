@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/hashicorp/go-multierror"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/internal/templates"
+	"github.com/tierklinik-dobersberg/comment-service/pkg/goldmark-extensions/mentions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// NotificationTypeExtraKey is the user-extra key that holds the preferred
+	// notification type ("sms" or "email") of a user. It is used for scopes
+	// that do not specify a notification type.
+	NotificationTypeExtraKey = "commentNotificationType"
+
+	// LanguageExtraKey is the user-extra key that holds the preferred
+	// language of a user (like "de" or "en-US").
+	LanguageExtraKey = "language"
+
+	// maxSMSLength is the maximum number of characters sent per SMS
+	// notification.
+	maxSMSLength = 300
+)
+
+// sendNotifications notifies all scope owners, participants of the thread and
+// mentioned users about comment. Users in alreadyNotified are skipped. It
+// returns the IDs of all users that have been notified successfully,
+// including alreadyNotified.
+func (svc *Service) sendNotifications(ctx context.Context, comment models.Comment, alreadyNotified []string) ([]string, error) {
+	commentIdStr := comment.ID.Hex()
+
+	delivered := slices.Clone(alreadyNotified)
+
+	// get the creator user profile so we can construct a pretty mail header
+	creator, err := svc.getUserProfile(ctx, comment.CreatorID)
+	if err != nil {
+		return delivered, fmt.Errorf("failed to load comment creator profile %q: %w", comment.CreatorID, err)
+	}
+
+	// build a user-"notification reason" map indexed by user id
+	userMap := make(map[string]templates.Reason)
+
+	// load the scope and add all owners to the userMap
+	scope, err := svc.Repository.GetScopeByID(ctx, comment.Scope)
+	if err != nil {
+		return delivered, fmt.Errorf("failed to load scope %q: %w", comment.Scope, err)
+	}
+
+	for _, ownerId := range scope.OwnerIDs {
+		userMap[ownerId] = templates.ReasonOwner
+	}
+
+	// find all parent comments so we know which users to notify
+	parentComments, err := svc.Repository.GetParentComments(ctx, commentIdStr)
+	if err != nil {
+		return delivered, fmt.Errorf("failed to get parent comments for id %q: %w", commentIdStr, err)
+	}
+
+	var (
+		rootId primitive.ObjectID
+		parent *models.Comment
+	)
+	for idx, pc := range parentComments {
+		// those users are notified because the created/answered at a parent comment
+		userMap[pc.CreatorID] = templates.ReasonParent
+
+		if pc.ParentID.IsZero() {
+			rootId = pc.ID
+		}
+
+		if pc.ID == comment.ParentID {
+			parent = &parentComments[idx]
+		}
+	}
+
+	// render the view-comment URL of the scope, if any.
+	viewURL, err := scope.RenderViewURL(models.NewViewURLContext(scope, comment, rootId))
+	if err != nil {
+		log.L(ctx).Errorf("failed to render view URL for scope %q: %s", scope.ID, err)
+	}
+
+	// parse the markdown content, extract/resolve @-user-mentions and convert it to some
+	// nice HTML
+	rootNode, htmlContent, userMentions, err := svc.parseAndRenderMarkDown(ctx, scope, comment)
+	if err != nil {
+		return delivered, fmt.Errorf("failed to parse and render comment content: %w", err)
+	}
+
+	// add all user-ids from @-mentions
+	for _, user := range userMentions {
+		userMap[user.User.Id] = templates.ReasonMention
+	}
+
+	// expand @-mentions of roles, owners and the thread
+	groupMembers, err := svc.mentionedGroupMembers(ctx, scope, rootId, mentions.Nodes(rootNode))
+	if err != nil {
+		return delivered, fmt.Errorf("failed to expand group mentions: %w", err)
+	}
+
+	for _, userId := range groupMembers {
+		userMap[userId] = templates.ReasonMention
+	}
+
+	// honour explicit subscriptions and muted threads/scopes
+	if err := svc.applySubscriptions(ctx, comment, rootId, userMap); err != nil {
+		return delivered, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+
+	tmplCtx := templates.Context{
+		ScopeName: scope.Name,
+		ViewURL:   viewURL,
+		Comment: templates.Comment{
+			CreatorName: userDisplayName(creator),
+			HTML:        template.HTML(htmlContent),
+			Text:        mentions.PlainText(rootNode, []byte(comment.Content)),
+		},
+	}
+
+	// include the answered comment so recipients have some context
+	if parent != nil && !parent.Deleted() {
+		tmplCtx.Parent = svc.templateComment(ctx, scope, *parent)
+	}
+
+	// Finally, send notifications to all users that somehow participated in the
+	// conversation. This is one after another, errors are collected so failed
+	// deliveries can be retried.
+	merr := new(multierror.Error)
+	for userId, reason := range userMap {
+		// do not send mails to the creator of the comment
+		if userId == comment.CreatorID {
+			continue
+		}
+
+		// skip users that have been notified in a previous attempt
+		if slices.Contains(alreadyNotified, userId) {
+			continue
+		}
+
+		recipient, err := svc.getUserProfile(ctx, userId)
+		if err != nil {
+			merr.Errors = append(merr.Errors, fmt.Errorf("failed to load recipient profile %q: %w", userId, err))
+
+			continue
+		}
+
+		// never leak comments to users that are not allowed to read them
+		if !canReadScope(remoteUserFromProfile(recipient), scope) {
+			log.L(ctx).Infof("not notifying user %q: missing read access for scope %q", userId, scope.ID)
+
+			continue
+		}
+
+		recipientCtx := tmplCtx
+		recipientCtx.RecipientName = userDisplayName(recipient)
+
+		msg, err := svc.Templates.Render(userExtraString(recipient, LanguageExtraKey), reason, recipientCtx)
+		if err != nil {
+			merr.Errors = append(merr.Errors, fmt.Errorf("failed to render %q notification for user %q: %w", reason, userId, err))
+
+			continue
+		}
+
+		req := &idmv1.SendNotificationRequest{
+			TargetUsers:  []string{userId},
+			SenderUserId: creator.GetUser().GetId(),
+		}
+
+		switch notificationTypeFor(scope, recipient) {
+		case models.NotificationTypeSMS:
+			req.Message = &idmv1.SendNotificationRequest_Sms{
+				Sms: &idmv1.SMS{
+					Body: smsBody(msg.Subject, tmplCtx.Text, viewURL),
+				},
+			}
+
+		default:
+			req.Message = &idmv1.SendNotificationRequest_Email{
+				Email: &idmv1.EMailMessage{
+					Subject: msg.Subject,
+					Body:    msg.HTML,
+					Attachments: []*idmv1.Attachment{
+						{
+							Name:           "message.txt",
+							MediaType:      "text/plain; charset=utf-8",
+							Content:        []byte(msg.Text),
+							AttachmentType: idmv1.AttachmentType_ALTERNATIVE_BODY,
+						},
+					},
+				},
+			}
+		}
+
+		_, err = svc.Notify.SendNotification(ctx, connect.NewRequest(req))
+		if err != nil {
+			merr.Errors = append(merr.Errors, fmt.Errorf("failed to send notification to user %q: %w", userId, err))
+
+			continue
+		}
+
+		delivered = append(delivered, userId)
+	}
+
+	return delivered, merr.ErrorOrNil()
+}
+
+// templateComment renders comment for use in notification templates.
+func (svc *Service) templateComment(ctx context.Context, scope models.Scope, comment models.Comment) *templates.Comment {
+	rootNode, htmlContent, _, err := svc.parseAndRenderMarkDown(ctx, scope, comment)
+	if err != nil {
+		log.L(ctx).Errorf("failed to render comment %q: %s", comment.ID.Hex(), err)
+
+		return nil
+	}
+
+	result := &templates.Comment{
+		CreatorName: comment.CreatorID,
+		HTML:        template.HTML(htmlContent),
+		Text:        mentions.PlainText(rootNode, []byte(comment.Content)),
+	}
+
+	if profile, err := svc.getUserProfile(ctx, comment.CreatorID); err == nil {
+		result.CreatorName = userDisplayName(profile)
+	} else {
+		log.L(ctx).Errorf("failed to load user profile %q: %s", comment.CreatorID, err)
+	}
+
+	return result
+}
+
+func (svc *Service) getUserProfile(ctx context.Context, userId string) (*idmv1.Profile, error) {
+	return svc.Profiles.Get(ctx, userId)
+}
+
+// userDisplayName returns the display name of the user and falls back to
+// the username.
+func userDisplayName(profile *idmv1.Profile) string {
+	if name := profile.GetUser().GetDisplayName(); name != "" {
+		return name
+	}
+
+	return profile.GetUser().GetUsername()
+}
+
+// userExtraString returns the string value of the user-extra key.
+func userExtraString(profile *idmv1.Profile, key string) string {
+	return profile.GetUser().GetExtra().GetFields()[key].GetStringValue()
+}
+
+// notificationTypeFor returns the notification type that should be used to
+// notify recipient about a new comment in scope. If the scope does not specify
+// a notification type, the user preference stored in the user-extra key
+// NotificationTypeExtraKey is used. E-Mail is used as the default.
+func notificationTypeFor(scope models.Scope, recipient *idmv1.Profile) models.NotificationType {
+	if scope.NotificationType != models.NotificationTypeUnspecified {
+		return scope.NotificationType
+	}
+
+	switch models.NotificationType(strings.ToLower(userExtraString(recipient, NotificationTypeExtraKey))) {
+	case models.NotificationTypeSMS:
+		return models.NotificationTypeSMS
+	default:
+		return models.NotificationTypeEMail
+	}
+}
+
+// smsBody returns the SMS text for a comment notification. The comment
+// content is truncated so the whole message, including the view URL, does
+// not exceed maxSMSLength characters.
+func smsBody(subject string, content string, viewURL string) string {
+	if viewURL == "" {
+		return truncateText(subject+":\n"+content, maxSMSLength)
+	}
+
+	suffix := "\n" + viewURL
+	budget := max(maxSMSLength-utf8.RuneCountInString(suffix), 1)
+
+	return truncateText(subject+":\n"+content, budget) + suffix
+}
+
+// mentionedGroupMembers returns the IDs of all users that are members of a
+// group mentioned in nodes. rootId is the root comment of the thread that
+// is used to expand mentionThread.
+func (svc *Service) mentionedGroupMembers(ctx context.Context, scope models.Scope, rootId primitive.ObjectID, nodes []*mentions.Node) ([]string, error) {
+	var (
+		result []string
+		seen   = make(map[string]bool)
+	)
+
+	for _, n := range nodes {
+		if n.Group == nil || seen[n.Group.ID] {
+			continue
+		}
+
+		seen[n.Group.ID] = true
+
+		switch n.Group.ID {
+		case mentionOwners:
+			result = append(result, scope.OwnerIDs...)
+
+		case mentionThread:
+			tree, err := svc.Repository.GetCommentTreeFromCommentID(ctx, rootId.Hex())
+			if err != nil {
+				return nil, fmt.Errorf("failed to load thread %q: %w", rootId.Hex(), err)
+			}
+
+			result = append(result, threadParticipants(tree)...)
+
+		default:
+			members, err := svc.Profiles.RoleMembers(ctx, n.Group.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load members of role %q: %w", n.Group.ID, err)
+			}
+
+			for _, member := range members {
+				result = append(result, member.GetUser().GetId())
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// threadParticipants returns the creator IDs of all comments in tree.
+func threadParticipants(tree *models.CommentTree) []string {
+	result := []string{tree.Comment.CreatorID}
+
+	for _, answer := range tree.Answers {
+		result = append(result, threadParticipants(answer)...)
+	}
+
+	return result
+}
+
+// truncateText truncates text to at most maxRunes runes. If text is
+// truncated, the last rune is replaced with an ellipsis.
+func truncateText(text string, maxRunes int) string {
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
+	}
+
+	runes := []rune(text)
+
+	return strings.TrimSpace(string(runes[:maxRunes-1])) + "…"
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+const (
+	// outboxPollInterval is the interval at which the dispatcher checks for
+	// due outbox entries if it's not woken up earlier.
+	outboxPollInterval = 10 * time.Second
+
+	// outboxLease is the time a claimed outbox entry is reserved for a
+	// dispatcher. It also limits the time spent for a single delivery.
+	outboxLease = time.Minute
+
+	// outboxMaxAttempts is the number of delivery attempts before an entry
+	// is marked as failed.
+	outboxMaxAttempts = 10
+
+	outboxMinBackoff = 30 * time.Second
+	outboxMaxBackoff = time.Hour
+)
+
+// RunOutboxDispatcher delivers pending notifications from the outbox until
+// ctx is cancelled. Failed deliveries are retried with an exponential backoff.
+// It's safe to run the dispatcher on multiple replicas.
+func (svc *Service) RunOutboxDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// process all due entries
+		for {
+			entry, err := svc.Repository.ClaimOutboxEntry(ctx, outboxLease)
+			if err != nil {
+				log.L(ctx).Errorf("failed to claim outbox entry: %s", err)
+				break
+			}
+
+			if entry == nil {
+				break
+			}
+
+			svc.dispatchOutboxEntry(ctx, *entry)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-svc.outboxWakeup:
+		}
+	}
+}
+
+// wakeupOutbox notifies the dispatcher that there is a new outbox entry.
+func (svc *Service) wakeupOutbox() {
+	select {
+	case svc.outboxWakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (svc *Service) dispatchOutboxEntry(ctx context.Context, entry models.OutboxEntry) {
+	l := log.L(ctx).WithField("outboxId", entry.ID.Hex()).WithField("commentId", entry.CommentID.Hex())
+
+	ctx, cancel := context.WithTimeout(ctx, outboxLease)
+	defer cancel()
+
+	comment, err := svc.Repository.GetComment(ctx, entry.CommentID.Hex())
+	if err != nil {
+		var cerr *connect.Error
+		if errors.As(err, &cerr) && cerr.Code() == connect.CodeNotFound {
+			// without transactions, the outbox entry is written before the
+			// comment so it might just not be visible yet.
+			if time.Since(entry.CreatedAt) < outboxLease {
+				next := time.Now().Add(outboxBackoff(entry.Attempts))
+
+				l.Infof("comment not found yet, retrying at %s", next.Format(time.RFC3339))
+
+				if err := svc.Repository.FailOutboxEntry(ctx, entry.ID, entry.DeliveredTo, err.Error(), next); err != nil {
+					l.Errorf("failed to update outbox entry: %s", err)
+				}
+
+				return
+			}
+
+			// the comment has never been written or has been purged in the
+			// meantime, there's nothing to deliver
+			l.Infof("comment not found, discarding outbox entry")
+
+			if _, err := svc.Repository.DiscardOutboxEntry(ctx, entry.ID.Hex()); err != nil {
+				l.Errorf("failed to discard outbox entry: %s", err)
+			}
+
+			return
+		}
+
+		svc.failOutboxEntry(ctx, entry, entry.DeliveredTo, err)
+
+		return
+	}
+
+	delivered, err := svc.sendNotifications(ctx, comment, entry.DeliveredTo)
+	if err != nil {
+		svc.failOutboxEntry(ctx, entry, delivered, err)
+
+		return
+	}
+
+	if err := svc.Repository.CompleteOutboxEntry(ctx, entry.ID, delivered); err != nil {
+		l.Errorf("failed to mark outbox entry as delivered: %s", err)
+	}
+}
+
+func (svc *Service) failOutboxEntry(ctx context.Context, entry models.OutboxEntry, delivered []string, reason error) {
+	l := log.L(ctx).WithField("outboxId", entry.ID.Hex()).WithField("attempt", entry.Attempts)
+
+	var next time.Time
+	if entry.Attempts < outboxMaxAttempts {
+		next = time.Now().Add(outboxBackoff(entry.Attempts))
+
+		l.Errorf("failed to deliver notifications, retrying at %s: %s", next.Format(time.RFC3339), reason)
+	} else {
+		l.Errorf("failed to deliver notifications, giving up: %s", reason)
+	}
+
+	if err := svc.Repository.FailOutboxEntry(ctx, entry.ID, delivered, reason.Error(), next); err != nil {
+		l.Errorf("failed to update outbox entry: %s", err)
+	}
+}
+
+// outboxBackoff returns the delay before the next delivery attempt.
+func outboxBackoff(attempt int) time.Duration {
+	backoff := outboxMinBackoff
+	for i := 1; i < attempt && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, outboxMaxBackoff)
+}
+
+// Outbox Management
+
+func (svc *Service) ListOutboxEntries(ctx context.Context, req *connect.Request[api.ListOutboxEntriesRequest]) (*connect.Response[api.ListOutboxEntriesResponse], error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	state := models.OutboxStateFailed
+	if req.Msg.State != "" {
+		state = models.OutboxState(req.Msg.State)
+	}
+
+	switch state {
+	case models.OutboxStatePending, models.OutboxStateDelivered, models.OutboxStateFailed, models.OutboxStateDiscarded:
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid state %q", req.Msg.State))
+	}
+
+	entries, err := svc.Repository.ListOutboxEntries(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.ListOutboxEntriesResponse{
+		Entries: make([]api.OutboxEntry, len(entries)),
+	}
+
+	for idx, e := range entries {
+		res.Entries[idx] = e.ToAPI()
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (svc *Service) RetryOutboxEntry(ctx context.Context, req *connect.Request[api.RetryOutboxEntryRequest]) (*connect.Response[api.RetryOutboxEntryResponse], error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	entry, err := svc.Repository.RetryOutboxEntry(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.wakeupOutbox()
+
+	return connect.NewResponse(&api.RetryOutboxEntryResponse{
+		Entry: entry.ToAPI(),
+	}), nil
+}
+
+func (svc *Service) DiscardOutboxEntry(ctx context.Context, req *connect.Request[api.DiscardOutboxEntryRequest]) (*connect.Response[api.DiscardOutboxEntryResponse], error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	entry, err := svc.Repository.DiscardOutboxEntry(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.DiscardOutboxEntryResponse{
+		Entry: entry.ToAPI(),
+	}), nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/pkg/goldmark-extensions/mentions"
+)
+
+// Comment Preview
+
+// Values for api.PreviewWarning.Code.
+const (
+	previewWarningEmpty             = "empty_content"
+	previewWarningHTMLForbidden     = "raw_html_forbidden"
+	previewWarningHTMLOmitted       = "raw_html_omitted"
+	previewWarningUnresolvedMention = "unresolved_mention"
+	previewWarningTooLong           = "content_too_long"
+)
+
+// PreviewComment renders the content of a comment the same way as it would
+// be rendered after creating it. Nothing is stored and no notifications or
+// events are sent.
+func (svc *Service) PreviewComment(ctx context.Context, req *connect.Request[api.PreviewCommentRequest]) (*connect.Response[api.PreviewCommentResponse], error) {
+	scope, err := svc.requireScopeAccess(ctx, req.Msg.Scope, true)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := models.Comment{
+		Scope:   scope.ID,
+		Content: req.Msg.Content,
+	}
+
+	rootNode, htmlContent, _, err := svc.parseAndRenderMarkDown(ctx, scope, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render comment: %w", err)
+	}
+
+	res := &api.PreviewCommentResponse{
+		HTML: htmlContent,
+	}
+
+	var (
+		rejectUnresolved = mentions.UnresolvedMode(svc.Config.UnresolvedMentions) == mentions.UnresolvedReject
+		seen             = make(map[string]bool)
+	)
+
+	// mentions are reported in the order they appear in the content
+	for _, n := range mentions.Nodes(rootNode) {
+		switch user := n.Profile.GetUser(); {
+		case user != nil:
+			if !seen["user:"+user.GetId()] {
+				seen["user:"+user.GetId()] = true
+
+				res.Mentions = append(res.Mentions, api.MentionedUser{
+					ID:          user.GetId(),
+					Username:    user.GetUsername(),
+					DisplayName: user.GetDisplayName(),
+				})
+			}
+
+		case n.Group != nil:
+			if !seen["group:"+n.Group.ID] {
+				seen["group:"+n.Group.ID] = true
+
+				res.GroupMentions = append(res.GroupMentions, api.MentionedGroup{
+					ID:   n.Group.ID,
+					Name: n.Group.Name,
+				})
+			}
+
+		case !n.Resolved():
+			res.Warnings = append(res.Warnings, api.PreviewWarning{
+				Code:    previewWarningUnresolvedMention,
+				Message: fmt.Sprintf("%s does not match any user or role", n.Segment.Value([]byte(comment.Content))),
+				Fatal:   rejectUnresolved,
+			})
+		}
+	}
+
+	res.Warnings = append(res.Warnings, contentWarnings(scope, comment.Content, mentions.PlainText(rootNode, []byte(comment.Content)))...)
+
+	return connect.NewResponse(res), nil
+}
+
+// contentWarnings returns warnings about the raw content and the plain text
+// of a comment that are independent of mentions.
+func contentWarnings(scope models.Scope, content string, plainText string) []api.PreviewWarning {
+	var result []api.PreviewWarning
+
+	if strings.TrimSpace(content) == "" {
+		result = append(result, api.PreviewWarning{
+			Code:    previewWarningEmpty,
+			Message: "the comment is empty",
+		})
+	}
+
+	if containsRawHTML(content) {
+		switch scope.HTMLPolicy {
+		case models.HTMLPolicyForbid:
+			result = append(result, api.PreviewWarning{
+				Code:    previewWarningHTMLForbidden,
+				Message: fmt.Sprintf("scope %q does not allow raw HTML in comments", scope.ID),
+				Fatal:   true,
+			})
+
+		case models.HTMLPolicyOmit:
+			result = append(result, api.PreviewWarning{
+				Code:    previewWarningHTMLOmitted,
+				Message: "raw HTML is removed from comments",
+			})
+		}
+	}
+
+	// the user preference is unknown for scopes without a notification
+	// type so they might receive SMS notifications as well.
+	if scope.NotificationType != models.NotificationTypeEMail && utf8.RuneCountInString(plainText) > maxSMSLength {
+		result = append(result, api.PreviewWarning{
+			Code:    previewWarningTooLong,
+			Message: fmt.Sprintf("the comment is longer than %d characters and will be truncated in SMS notifications", maxSMSLength),
+		})
+	}
+
+	return result
+}
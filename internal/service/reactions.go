@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+)
+
+// Reactions
+
+// emojiShortcodeRegexp matches emoji shortcodes like "+1", "eyes" or
+// "white_check_mark".
+var emojiShortcodeRegexp = regexp.MustCompile(`^[a-z0-9_+\-]{1,64}$`)
+
+func (svc *Service) AddReaction(ctx context.Context, req *connect.Request[api.AddReactionRequest]) (*connect.Response[api.AddReactionResponse], error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return nil, fmt.Errorf("no remote user specified")
+	}
+
+	emoji, err := normalizeEmoji(req.Msg.Emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := svc.Repository.GetComment(ctx, req.Msg.CommentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// reactions are meant as a lightweight acknowledgement so readers are
+	// allowed to react as well.
+	if _, err := svc.requireScopeAccess(ctx, comment.Scope, false); err != nil {
+		return nil, err
+	}
+
+	comment, err = svc.Repository.AddReaction(ctx, req.Msg.CommentID, emoji, usr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.AddReactionResponse{
+		Comment: comment.ToAPI(),
+	}
+	markReacted(&res.Comment, usr.ID)
+
+	return connect.NewResponse(res), nil
+}
+
+func (svc *Service) RemoveReaction(ctx context.Context, req *connect.Request[api.RemoveReactionRequest]) (*connect.Response[api.RemoveReactionResponse], error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return nil, fmt.Errorf("no remote user specified")
+	}
+
+	emoji, err := normalizeEmoji(req.Msg.Emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := svc.Repository.GetComment(ctx, req.Msg.CommentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.requireScopeAccess(ctx, comment.Scope, false); err != nil {
+		return nil, err
+	}
+
+	comment, err = svc.Repository.RemoveReaction(ctx, req.Msg.CommentID, emoji, usr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.RemoveReactionResponse{
+		Comment: comment.ToAPI(),
+	}
+	markReacted(&res.Comment, usr.ID)
+
+	return connect.NewResponse(res), nil
+}
+
+// normalizeEmoji strips surrounding colons from an emoji shortcode and makes
+// sure it's valid.
+func normalizeEmoji(emoji string) (string, error) {
+	emoji = strings.ToLower(strings.Trim(strings.TrimSpace(emoji), ":"))
+
+	if !emojiShortcodeRegexp.MatchString(emoji) {
+		return "", connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid emoji shortcode %q", emoji))
+	}
+
+	return emoji, nil
+}
+
+// markReacted sets the Reacted field of all reactions of c that have been
+// added by userId.
+func markReacted(c *api.Comment, userId string) {
+	for idx := range c.Reactions {
+		c.Reactions[idx].Reacted = slices.Contains(c.Reactions[idx].UserIDs, userId)
+	}
+}
+
+// markTreeReacted calls markReacted for all comments in tree.
+func markTreeReacted(tree *api.CommentTree, userId string) {
+	markReacted(&tree.Comment, userId)
+
+	for idx := range tree.Answers {
+		markTreeReacted(&tree.Answers[idx], userId)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+)
+
+// Comment Editing
+
+func (svc *Service) UpdateComment(ctx context.Context, req *connect.Request[api.UpdateCommentRequest]) (*connect.Response[api.UpdateCommentResponse], error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return nil, fmt.Errorf("no remote user specified")
+	}
+
+	if strings.TrimSpace(req.Msg.Content) == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("content must not be empty"))
+	}
+
+	comment, err := svc.Repository.GetComment(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.Deleted() {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("deleted comments cannot be edited"))
+	}
+
+	if comment.CreatorID != usr.ID {
+		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("only the creator of a comment is allowed to edit it"))
+	}
+
+	// the creator might have lost write access in the meantime
+	scope, err := svc.requireScopeAccess(ctx, comment.Scope, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkHTMLPolicy(scope, req.Msg.Content); err != nil {
+		return nil, err
+	}
+
+	content, mentionIds, err := svc.canonicalizeMentions(ctx, scope, req.Msg.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing changed, do not create a new revision
+	if comment.Content == content {
+		return connect.NewResponse(&api.UpdateCommentResponse{
+			Comment: comment.ToAPI(),
+		}), nil
+	}
+
+	comment, err = svc.Repository.UpdateCommentContent(ctx, req.Msg.ID, content, mentionIds, usr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.commentChanged(events.Edited, comment)
+
+	return connect.NewResponse(&api.UpdateCommentResponse{
+		Comment: comment.ToAPI(),
+	}), nil
+}
+
+func (svc *Service) ListCommentRevisions(ctx context.Context, req *connect.Request[api.ListCommentRevisionsRequest]) (*connect.Response[api.ListCommentRevisionsResponse], error) {
+	comment, err := svc.Repository.GetComment(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.requireScopeAccess(ctx, comment.Scope, false); err != nil {
+		return nil, err
+	}
+
+	res := &api.ListCommentRevisionsResponse{
+		Comment:   comment.ToAPI(),
+		Revisions: []api.CommentRevision{},
+	}
+
+	// revisions are kept when a comment is deleted but they must not
+	// reveal the deleted content to anyone but administrators.
+	if comment.Deleted() && !remoteUser(ctx).Admin {
+		return connect.NewResponse(res), nil
+	}
+
+	revisions, err := svc.Repository.ListCommentRevisions(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Revisions = make([]api.CommentRevision, len(revisions))
+
+	for idx, r := range revisions {
+		res.Revisions[idx] = r.ToAPI()
+	}
+
+	return connect.NewResponse(res), nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// htmlPolicy is the allowlist applied to all rendered comments. It's based on
+// the bluemonday user-generated-content policy and additionally permits the
+// markup produced by the GFM and mentions extensions.
+var htmlPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// mentions
+	p.AllowAttrs("class").
+		Matching(regexp.MustCompile(`^mention( mention-[a-z]+)*$`)).
+		OnElements("span")
+	p.AllowAttrs("data-user-id", "data-role").OnElements("span")
+
+	// GFM task lists
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	// GFM table alignment
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+
+	return p
+}()
+
+// sanitizeHTML removes all elements and attributes from rendered markdown
+// that are not explicitly allowed.
+func sanitizeHTML(s string) string {
+	return htmlPolicy.Sanitize(s)
+}
+
+// containsRawHTML returns true if the markdown content contains inline or
+// block level HTML.
+func containsRawHTML(content string) bool {
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	root := md.Parser().Parse(text.NewReader([]byte(content)))
+
+	found := false
+	_ = ast.Walk(root, func(node ast.Node, enter bool) (ast.WalkStatus, error) {
+		switch node.(type) {
+		case *ast.RawHTML, *ast.HTMLBlock:
+			found = true
+
+			return ast.WalkStop, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return found
+}
+
+// checkHTMLPolicy returns an InvalidArgument error if content contains raw
+// HTML but the scope forbids it.
+func checkHTMLPolicy(scope models.Scope, content string) error {
+	if scope.HTMLPolicy != models.HTMLPolicyForbid || !containsRawHTML(content) {
+		return nil
+	}
+
+	return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("scope %q does not allow raw HTML in comments", scope.ID))
+}
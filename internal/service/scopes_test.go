@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/config"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+func listedScopes(t *testing.T, ctx context.Context, svc *Service) []string {
+	t.Helper()
+
+	res, err := svc.ListReadableScopes(ctx, connect.NewRequest(&api.ListReadableScopesRequest{}))
+	if err != nil {
+		t.Fatalf("failed to list scopes: %s", err)
+	}
+
+	var ids []string
+	for _, s := range res.Msg.Scopes {
+		ids = append(ids, s.ID)
+	}
+
+	return ids
+}
+
+// TestOwnedScopes manages a scope as an owner that is not an administrator.
+func TestOwnedScopes(t *testing.T) {
+	svc := newTestService(t, config.Config{})
+	createTestScope(t, svc, models.Scope{ID: "patients", OwnerIDs: []string{"alice-id"}, ReaderRoles: []string{"vets"}})
+	createTestScope(t, svc, models.Scope{ID: "public"})
+
+	owner := asUser("alice-id")
+	other := asUser("bob-id")
+
+	if got := listedScopes(t, owner, svc); !slices.Equal(got, []string{"patients", "public"}) {
+		t.Errorf("expected the owner to list both scopes, got %v", got)
+	}
+
+	if got := listedScopes(t, other, svc); !slices.Equal(got, []string{"public"}) {
+		t.Errorf("expected bob to only list the public scope, got %v", got)
+	}
+
+	update := &api.UpdateOwnedScopeRequest{
+		ID:               "patients",
+		Paths:            []string{"name", "notificationType", "addOwnerIds"},
+		Name:             "Patients",
+		NotificationType: "email",
+		AddOwnerIDs:      []string{"bob-id", "alice-id"},
+	}
+
+	_, err := svc.UpdateOwnedScope(other, connect.NewRequest(update))
+	requireCode(t, err, connect.CodePermissionDenied)
+
+	res, err := svc.UpdateOwnedScope(owner, connect.NewRequest(update))
+	if err != nil {
+		t.Fatalf("failed to update scope: %s", err)
+	}
+
+	scope := res.Msg.Scope
+	slices.Sort(scope.OwnerIDs)
+
+	if scope.Name != "Patients" || scope.NotificationType != "email" || !slices.Equal(scope.OwnerIDs, []string{"alice-id", "bob-id"}) {
+		t.Errorf("unexpected scope after update: %+v", scope)
+	}
+
+	// fields that are not part of the paths are kept
+	stored, err := svc.Repository.GetScopeByID(context.Background(), "patients")
+	if err != nil {
+		t.Fatalf("failed to get scope: %s", err)
+	}
+
+	if !slices.Equal(stored.ReaderRoles, []string{"vets"}) {
+		t.Errorf("expected the reader roles to be kept, got %v", stored.ReaderRoles)
+	}
+
+	for _, req := range []*api.UpdateOwnedScopeRequest{
+		{ID: "patients", Paths: []string{"view_comment_url_template"}},
+		{ID: "patients", Paths: []string{"notificationType"}, NotificationType: "pigeon"},
+	} {
+		_, err := svc.UpdateOwnedScope(owner, connect.NewRequest(req))
+		requireCode(t, err, connect.CodeInvalidArgument)
+	}
+
+	_, err = svc.DeleteOwnedScope(asUser("carol-id"), connect.NewRequest(&api.DeleteOwnedScopeRequest{ID: "patients"}))
+	requireCode(t, err, connect.CodePermissionDenied)
+
+	if _, err := svc.DeleteOwnedScope(owner, connect.NewRequest(&api.DeleteOwnedScopeRequest{ID: "patients"})); err != nil {
+		t.Fatalf("failed to delete scope: %s", err)
+	}
+
+	if got := listedScopes(t, asAdmin(), svc); !slices.Equal(got, []string{"public"}) {
+		t.Errorf("expected only the public scope to be left, got %v", got)
+	}
+}
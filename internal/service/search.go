@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/repo"
+)
+
+// snippetRadius is the number of bytes shown before and after the first
+// match in a search snippet.
+const snippetRadius = 80
+
+func (svc *Service) SearchComments(ctx context.Context, req *connect.Request[api.SearchCommentsRequest]) (*connect.Response[api.SearchCommentsResponse], error) {
+	if strings.TrimSpace(req.Msg.Query) == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("query must not be empty"))
+	}
+
+	pageSize := req.Msg.PageSize
+	switch {
+	case pageSize < 0:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page size"))
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	var offset int
+	if req.Msg.PageToken != "" {
+		blob, err := base64.RawURLEncoding.DecodeString(req.Msg.PageToken)
+		if err == nil {
+			offset, err = strconv.Atoi(string(blob))
+		}
+
+		if err != nil || offset < 0 {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page token"))
+		}
+	}
+
+	q := repo.SearchQuery{
+		Text:      req.Msg.Query,
+		Scope:     req.Msg.Scope,
+		Reference: req.Msg.Reference,
+		CreatorID: req.Msg.CreatorID,
+		Offset:    offset,
+		// fetch one more result so we know if there's a next page
+		Limit: pageSize + 1,
+	}
+
+	if q.Scope != "" {
+		if _, err := svc.requireScopeAccess(ctx, q.Scope, false); err != nil {
+			return nil, err
+		}
+	} else if usr := remoteUser(ctx); usr == nil || !usr.Admin {
+		// restrict the search to scopes the user is allowed to read
+		scopes, err := svc.readableScopes(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Scopes = scopes
+	}
+
+	if req.Msg.CreatedAfter != nil {
+		q.CreatedAfter = *req.Msg.CreatedAfter
+	}
+
+	if req.Msg.CreatedBefore != nil {
+		q.CreatedBefore = *req.Msg.CreatedBefore
+	}
+
+	hits, err := svc.Repository.SearchComments(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.SearchCommentsResponse{}
+
+	if len(hits) > pageSize {
+		hits = hits[:pageSize]
+		res.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset + pageSize)))
+	}
+
+	highlight := searchTermsRegexp(req.Msg.Query)
+
+	res.Results = make([]api.SearchResult, len(hits))
+	for idx, hit := range hits {
+		res.Results[idx] = api.SearchResult{
+			Comment: hit.Comment.ToAPI(),
+			Score:   hit.Score,
+			RootID:  hit.RootID.Hex(),
+			Snippet: highlightSnippet(hit.Comment.Content, highlight, snippetRadius),
+		}
+
+		if usr := remoteUser(ctx); usr != nil {
+			markReacted(&res.Results[idx].Comment, usr.ID)
+		}
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+// searchTermsRegexp returns a case-insensitive regular expression that
+// matches all positive terms and phrases of a mongo $text search query. It
+// returns nil if the query does not contain any positive terms.
+func searchTermsRegexp(query string) *regexp.Regexp {
+	var terms []string
+
+	for idx, part := range strings.Split(query, `"`) {
+		// every odd part is a quoted phrase
+		if idx%2 == 1 {
+			if p := strings.TrimSpace(part); p != "" {
+				terms = append(terms, regexp.QuoteMeta(p))
+			}
+
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			if strings.HasPrefix(word, "-") {
+				continue
+			}
+
+			terms = append(terms, regexp.QuoteMeta(word))
+		}
+	}
+
+	if len(terms) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// highlightSnippet returns an HTML-escaped excerpt of content around the first
+// match of re. All matches in the excerpt are wrapped in <mark> elements.
+func highlightSnippet(content string, re *regexp.Regexp, radius int) string {
+	var matches [][]int
+	if re != nil {
+		matches = re.FindAllStringIndex(content, -1)
+	}
+
+	start, end := 0, len(content)
+	if len(matches) > 0 {
+		start = max(0, matches[0][0]-radius)
+		end = min(len(content), matches[0][1]+radius)
+	} else {
+		end = min(len(content), 2*radius)
+	}
+
+	// make sure we do not cut through multi-byte runes
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	buf := new(strings.Builder)
+	if start > 0 {
+		buf.WriteString("…")
+	}
+
+	pos := start
+	for _, m := range matches {
+		if m[0] < pos {
+			continue
+		}
+
+		if m[1] > end {
+			break
+		}
+
+		buf.WriteString(html.EscapeString(content[pos:m[0]]))
+		buf.WriteString("<mark>" + html.EscapeString(content[m[0]:m[1]]) + "</mark>")
+		pos = m[1]
+	}
+
+	buf.WriteString(html.EscapeString(content[pos:end]))
+
+	if end < len(content) {
+		buf.WriteString("…")
+	}
+
+	return buf.String()
+}
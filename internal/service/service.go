@@ -3,8 +3,9 @@ package service
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/bufbuild/connect-go"
@@ -16,12 +17,16 @@ import (
 	"github.com/tierklinik-dobersberg/apis/pkg/auth"
 	"github.com/tierklinik-dobersberg/apis/pkg/data"
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
 	"github.com/tierklinik-dobersberg/comment-service/internal/config"
-	"github.com/tierklinik-dobersberg/comment-service/internal/goldmark-extensions/mentions"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
 	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/pkg/goldmark-extensions/mentions"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/text"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -30,12 +35,39 @@ type Service struct {
 	*config.Providers
 
 	commentv1connect.UnimplementedCommentServiceHandler
+	api.UnimplementedExtensionServiceHandler
+
+	outboxWakeup  chan struct{}
+	webhookWakeup chan struct{}
 }
 
 func New(p *config.Providers) *Service {
 	return &Service{
-		Providers: p,
+		Providers:     p,
+		outboxWakeup:  make(chan struct{}, 1),
+		webhookWakeup: make(chan struct{}, 1),
+	}
+}
+
+// remoteUser returns the authenticated user for ctx. It supports both, the
+// protobuf CommentService and the JSON based extension service.
+func remoteUser(ctx context.Context) *auth.RemoteUser {
+	if usr := auth.From(ctx); usr != nil {
+		return usr
+	}
+
+	return api.RemoteUserFrom(ctx)
+}
+
+// requireAdmin returns a PermissionDenied error if the remote user is not an
+// administrator.
+func requireAdmin(ctx context.Context) error {
+	usr := remoteUser(ctx)
+	if usr == nil || !usr.Admin {
+		return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to perform this operation"))
 	}
+
+	return nil
 }
 
 // Scope Management
@@ -53,6 +85,10 @@ func (svc *Service) CreateScope(ctx context.Context, req *connect.Request[commen
 	})
 	scopeModel.OwnerIDs = data.MapToSlice(uniqueOwnerIds)
 
+	if err := scopeModel.ValidateViewURLTemplate(); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
 	_, err := svc.Repository.CreateScope(ctx, scopeModel)
 	if err != nil {
 		return nil, err
@@ -69,35 +105,66 @@ func (svc *Service) CreateScope(ctx context.Context, req *connect.Request[commen
 }
 
 func (svc *Service) UpdateScope(ctx context.Context, req *connect.Request[commentv1.UpdateScopeRequest]) (*connect.Response[commentv1.UpdateScopeResponse], error) {
-	scopeModel, err := svc.Repository.GetScopeByID(ctx, req.Msg.Id)
+	scopeModel, err := svc.updateScope(ctx, req.Msg.Id, req.Msg.GetWriteMask().GetPaths(), scopeUpdate{
+		name:             req.Msg.Name,
+		notificationType: models.NotifcationTypeFromProto(req.Msg.NotifcationType),
+		viewURLTemplate:  req.Msg.ViewCommentUrlTemplate,
+		addOwnerIDs:      req.Msg.AddScopeOwnerIds,
+		removeOwnerIDs:   req.Msg.RemoveScopeOwnerIds,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	paths := []string{
-		"name",
-		"notification_type",
-		"view_comment_url_template",
-		"add_scope_owner_ids",
-		"remove_scope_owner_ids",
+	return connect.NewResponse(&commentv1.UpdateScopeResponse{
+		Scope: scopeModel.ToProto(),
+	}), nil
+}
+
+// scopeUpdate holds the new values of a scope update.
+type scopeUpdate struct {
+	name             string
+	notificationType models.NotificationType
+	viewURLTemplate  string
+	addOwnerIDs      []string
+	removeOwnerIDs   []string
+}
+
+// updateScope applies upd to the scope with the given ID. paths uses the field
+// names of commentv1.UpdateScopeRequest, all fields are updated if it is empty.
+// Only scope managers may update a scope.
+func (svc *Service) updateScope(ctx context.Context, id string, paths []string, upd scopeUpdate) (models.Scope, error) {
+	scopeModel, err := svc.Repository.GetScopeByID(ctx, id)
+	if err != nil {
+		return models.Scope{}, err
+	}
+
+	if err := requireScopeManager(ctx, scopeModel); err != nil {
+		return models.Scope{}, err
 	}
 
-	if fm := req.Msg.GetWriteMask(); fm != nil && len(fm.Paths) > 0 {
-		paths = fm.Paths
+	if len(paths) == 0 {
+		paths = []string{
+			"name",
+			"notification_type",
+			"view_comment_url_template",
+			"add_scope_owner_ids",
+			"remove_scope_owner_ids",
+		}
 	}
 
 	for _, p := range paths {
 		switch p {
 		case "name":
-			scopeModel.Name = req.Msg.Name
+			scopeModel.Name = upd.name
 		case "notification_type":
-			scopeModel.NotificationType = models.NotifcationTypeFromProto(req.Msg.NotifcationType)
+			scopeModel.NotificationType = upd.notificationType
 		case "view_comment_url_template":
-			scopeModel.CommentViewURLTemplate = req.Msg.ViewCommentUrlTemplate
+			scopeModel.CommentViewURLTemplate = upd.viewURLTemplate
 		case "add_scope_owner_ids":
-			scopeModel.OwnerIDs = append(scopeModel.OwnerIDs, req.Msg.AddScopeOwnerIds...)
+			scopeModel.OwnerIDs = append(scopeModel.OwnerIDs, upd.addOwnerIDs...)
 		case "remove_scope_owner_ids":
-			lm := data.IndexSlice(req.Msg.RemoveScopeOwnerIds, func(s string) string { return s })
+			lm := data.IndexSlice(upd.removeOwnerIDs, func(s string) string { return s })
 
 			update := make([]string, 0, len(scopeModel.OwnerIDs))
 
@@ -112,7 +179,7 @@ func (svc *Service) UpdateScope(ctx context.Context, req *connect.Request[commen
 			scopeModel.OwnerIDs = update
 
 		default:
-			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid field path: %q", p))
+			return models.Scope{}, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid field path: %q", p))
 		}
 	}
 
@@ -121,13 +188,15 @@ func (svc *Service) UpdateScope(ctx context.Context, req *connect.Request[commen
 	})
 	scopeModel.OwnerIDs = data.MapToSlice(uniqueOwnerIds)
 
+	if err := scopeModel.ValidateViewURLTemplate(); err != nil {
+		return models.Scope{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
 	if err := svc.Repository.UpdateScope(ctx, scopeModel.ID, &scopeModel); err != nil {
-		return nil, err
+		return models.Scope{}, err
 	}
 
-	return connect.NewResponse(&commentv1.UpdateScopeResponse{
-		Scope: scopeModel.ToProto(),
-	}), nil
+	return scopeModel, nil
 }
 
 func (svc *Service) ListScope(ctx context.Context, req *connect.Request[commentv1.ListScopeRequest]) (*connect.Response[commentv1.ListScopeResponse], error) {
@@ -136,30 +205,128 @@ func (svc *Service) ListScope(ctx context.Context, req *connect.Request[commentv
 		return nil, err
 	}
 
+	usr := remoteUser(ctx)
+
 	res := &commentv1.ListScopeResponse{
-		Scopes: make([]*commentv1.Scope, len(scopes)),
+		Scopes: make([]*commentv1.Scope, 0, len(scopes)),
 	}
 
-	for idx, s := range scopes {
-		res.Scopes[idx] = s.ToProto()
+	for _, s := range scopes {
+		if !canReadScope(usr, s) {
+			continue
+		}
+
+		res.Scopes = append(res.Scopes, s.ToProto())
 	}
 
 	return connect.NewResponse(res), nil
 }
 
 func (svc *Service) DeleteScope(ctx context.Context, req *connect.Request[commentv1.DeleteScopeRequest]) (*connect.Response[commentv1.DeleteScopeResponse], error) {
-	err := svc.Repository.DeleteScope(ctx, req.Msg.Id, true)
-	if err != nil {
+	if err := svc.deleteScope(ctx, req.Msg.Id); err != nil {
 		return nil, err
 	}
 
 	return connect.NewResponse(&commentv1.DeleteScopeResponse{}), nil
 }
 
+// deleteScope deletes a scope and all of its comments. Only scope managers
+// may delete a scope.
+func (svc *Service) deleteScope(ctx context.Context, id string) error {
+	scope, err := svc.Repository.GetScopeByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return err
+	}
+
+	return svc.Repository.DeleteScope(ctx, id, true)
+}
+
+// UpdateScope, DeleteScope and ListScope of the CommentService require the
+// admin role. Scope owners use the extension service instead.
+
+// scopePaths maps the field paths of api.UpdateOwnedScopeRequest to the ones
+// of commentv1.UpdateScopeRequest.
+var scopePaths = map[string]string{
+	"name":             "name",
+	"notificationType": "notification_type",
+	"viewUrlTemplate":  "view_comment_url_template",
+	"addOwnerIds":      "add_scope_owner_ids",
+	"removeOwnerIds":   "remove_scope_owner_ids",
+}
+
+func (svc *Service) ListReadableScopes(ctx context.Context, req *connect.Request[api.ListReadableScopesRequest]) (*connect.Response[api.ListReadableScopesResponse], error) {
+	scopes, err := svc.Repository.ListScopes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usr := remoteUser(ctx)
+
+	res := &api.ListReadableScopesResponse{
+		Scopes: make([]api.Scope, 0, len(scopes)),
+	}
+
+	for _, s := range scopes {
+		if !canReadScope(usr, s) {
+			continue
+		}
+
+		res.Scopes = append(res.Scopes, s.ToAPI())
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (svc *Service) UpdateOwnedScope(ctx context.Context, req *connect.Request[api.UpdateOwnedScopeRequest]) (*connect.Response[api.UpdateOwnedScopeResponse], error) {
+	paths := make([]string, len(req.Msg.Paths))
+	for idx, p := range req.Msg.Paths {
+		path, ok := scopePaths[p]
+		if !ok {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid field path: %q", p))
+		}
+
+		paths[idx] = path
+	}
+
+	nt := models.NotificationType(req.Msg.NotificationType)
+	switch nt {
+	case models.NotificationTypeUnspecified, models.NotificationTypeSMS, models.NotificationTypeEMail:
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid notification type: %q", req.Msg.NotificationType))
+	}
+
+	scope, err := svc.updateScope(ctx, req.Msg.ID, paths, scopeUpdate{
+		name:             req.Msg.Name,
+		notificationType: nt,
+		viewURLTemplate:  req.Msg.ViewURLTemplate,
+		addOwnerIDs:      req.Msg.AddOwnerIDs,
+		removeOwnerIDs:   req.Msg.RemoveOwnerIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.UpdateOwnedScopeResponse{
+		Scope: scope.ToAPI(),
+	}), nil
+}
+
+func (svc *Service) DeleteOwnedScope(ctx context.Context, req *connect.Request[api.DeleteOwnedScopeRequest]) (*connect.Response[api.DeleteOwnedScopeResponse], error) {
+	if err := svc.deleteScope(ctx, req.Msg.ID); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.DeleteOwnedScopeResponse{}), nil
+}
+
 // Comment Management
 
 func (svc *Service) CreateComment(ctx context.Context, req *connect.Request[commentv1.CreateCommentRequest]) (*connect.Response[commentv1.CreateCommentResponse], error) {
-	usr := auth.From(ctx)
+	usr := remoteUser(ctx)
 	if usr == nil {
 		return nil, fmt.Errorf("no remote user specified")
 	}
@@ -170,8 +337,16 @@ func (svc *Service) CreateComment(ctx context.Context, req *connect.Request[comm
 		CreatorID: usr.ID,
 	}
 
+	var scope models.Scope
+
 	switch v := req.Msg.Kind.(type) {
 	case *commentv1.CreateCommentRequest_Root:
+		var err error
+		scope, err = svc.requireScopeAccess(ctx, v.Root.Scope, true)
+		if err != nil {
+			return nil, err
+		}
+
 		m.Scope = v.Root.Scope
 		m.Reference = v.Root.Reference
 
@@ -181,11 +356,33 @@ func (svc *Service) CreateComment(ctx context.Context, req *connect.Request[comm
 			return nil, err
 		}
 
+		scope, err = svc.requireScopeAccess(ctx, parentComment.Scope, true)
+		if err != nil {
+			return nil, err
+		}
+
+		if parentComment.Deleted() {
+			return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("cannot reply to a deleted comment"))
+		}
+
 		m.ParentID = parentComment.ID
 		m.Scope = parentComment.Scope
 		m.Reference = parentComment.Reference
 	}
 
+	if err := checkHTMLPolicy(scope, m.Content); err != nil {
+		return nil, err
+	}
+
+	content, mentionIds, err := svc.canonicalizeMentions(ctx, scope, m.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Content = content
+	m.Mentions = mentionIds
+	m.CanonicalMentions = true
+
 	insertId, err := svc.Repository.CreateComment(ctx, m)
 	if err != nil {
 		return nil, err
@@ -194,9 +391,11 @@ func (svc *Service) CreateComment(ctx context.Context, req *connect.Request[comm
 	// cannot fail because the ID has just been created
 	m.ID, _ = primitive.ObjectIDFromHex(insertId)
 
-	// gather parent comment creators and @-user-mentions in the comment content
-	// and send appropriate notifications.
-	go svc.sendNotifications(m)
+	// the repository created an outbox entry for the new comment, make sure
+	// the dispatcher picks it up immediately.
+	svc.wakeupOutbox()
+
+	svc.commentChanged(events.Created, m)
 
 	return connect.NewResponse(&commentv1.CreateCommentResponse{
 		Comment: m.ToProto(),
@@ -210,6 +409,10 @@ func (svc *Service) GetComment(ctx context.Context, req *connect.Request[comment
 			return nil, err
 		}
 
+		if _, err := svc.requireScopeAccess(ctx, c.Comment.Scope, false); err != nil {
+			return nil, err
+		}
+
 		treepb := c.ToProto(req.Msg.Recurse)
 
 		minifyTree(treepb, true)
@@ -224,8 +427,13 @@ func (svc *Service) GetComment(ctx context.Context, req *connect.Request[comment
 		return nil, err
 	}
 
+	scope, err := svc.requireScopeAccess(ctx, c.Scope, false)
+	if err != nil {
+		return nil, err
+	}
+
 	if req.Msg.RenderHtml {
-		if err := svc.renderCommentInline(ctx, &c); err != nil {
+		if err := svc.renderCommentInline(ctx, scope, &c); err != nil {
 			return nil, err
 		}
 	}
@@ -238,20 +446,19 @@ func (svc *Service) GetComment(ctx context.Context, req *connect.Request[comment
 }
 
 func (svc *Service) ListComments(ctx context.Context, req *connect.Request[commentv1.ListCommentsRequest]) (*connect.Response[commentv1.ListCommentsResponse], error) {
-	trees, err := svc.Repository.GetCommentTreeByScope(ctx, req.Msg.Scope, req.Msg.Reference)
+	scope, err := svc.requireScopeAccess(ctx, req.Msg.Scope, false)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(trees) == 0 {
-		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("no comments found"))
+	trees, err := svc.Repository.GetCommentTreeByScope(ctx, req.Msg.Scope, req.Msg.Reference)
+	if err != nil {
+		return nil, err
 	}
 
 	if req.Msg.RenderHtml {
-		for _, t := range trees {
-			if err := svc.renderCommentTree(ctx, t); err != nil {
-				return nil, err
-			}
+		if err := svc.renderCommentTrees(ctx, scope, trees...); err != nil {
+			return nil, err
 		}
 	}
 
@@ -284,213 +491,362 @@ func minifyTree(pb *commentv1.CommentTree, first bool) {
 	}
 }
 
-func (svc *Service) parseAndRenderMarkDown(ctx context.Context, content string) (
-	rootNode ast.Node,
-	htmlContent string,
-	userMentions []*idmv1.Profile,
-	err error,
-) {
+// newMarkdown returns the markdown parser and renderer for comments of scope.
+// Mentions are not resolved while parsing, use resolveMentions on the parsed
+// documents instead.
+func (svc *Service) newMarkdown(ctx context.Context, scope models.Scope) goldmark.Markdown {
+	var rendererOptions []renderer.Option
+	if scope.HTMLPolicy == models.HTMLPolicyAllow {
+		// raw HTML is still passed through the sanitizer in renderMarkdown
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
 
-	md := goldmark.New(
+	return goldmark.New(
+		goldmark.WithRendererOptions(rendererOptions...),
 		goldmark.WithExtensions(
 			extension.GFM,
 			&mentions.Extender{
-				Context: ctx,
-				Resolver: mentions.ResolverFunc(
-					func(n *mentions.Node) (*idmv1.Profile, error) {
-						res, err := svc.Users.GetUser(ctx, connect.NewRequest(&idmv1.GetUserRequest{
-							Search: &idmv1.GetUserRequest_Id{
-								Id: string(n.Tag),
-							},
-						}))
-
-						if err != nil {
-							log.L(ctx).Debugf("failed to find user by id %q, trying by name", string(n.Tag))
-
-							var cerr *connect.Error
-							if !errors.As(err, &cerr) || cerr.Code() != connect.CodeNotFound {
-								log.L(ctx).Infof("failed to get user by id: %q: %s", string(n.Tag), err)
-
-								return nil, err
-							}
-
-							res, err = svc.Users.GetUser(ctx, connect.NewRequest(&idmv1.GetUserRequest{
-								Search: &idmv1.GetUserRequest_Name{
-									Name: string(n.Tag),
-								},
-							}))
-						}
-
-						if err != nil {
-							log.L(ctx).Errorf("failed to get user by name or id: %q: %s", string(n.Tag), err)
-
-							return nil, err
-						}
-
-						return res.Msg.GetProfile(), nil
-					},
-				),
+				Context:    ctx,
+				Unresolved: mentions.UnresolvedMode(svc.Config.UnresolvedMentions),
 			},
 		),
 	)
+}
 
-	rootNode = md.Parser().Parse(text.NewReader([]byte(content)))
-
-	// Collect all users that are mentioned in the comment
-	userMentionsMap := make(map[string]*idmv1.Profile)
-	ast.Walk(rootNode, func(node ast.Node, enter bool) (ast.WalkStatus, error) {
-		if n, ok := node.(*mentions.Node); ok && enter && n.Profile != nil {
-			userMentionsMap[n.Profile.User.Id] = n.Profile
-		}
-
-		return ast.WalkContinue, nil
-	})
-
-	// conver the userMentionsMap to a slice of *idmv1.Profile
-	userMentions = data.MapToSlice(userMentionsMap)
-
-	// actually render the markdown content as HTML
+// renderMarkdown renders the parsed content as sanitized HTML.
+func renderMarkdown(md goldmark.Markdown, rootNode ast.Node, content string) (string, error) {
 	buf := new(bytes.Buffer)
 	if err := md.Renderer().Render(buf, []byte(content), rootNode); err != nil {
-		return rootNode, "", userMentions, err
+		return "", err
 	}
 
-	return rootNode, buf.String(), userMentions, nil
+	return sanitizeHTML(buf.String()), nil
 }
 
-func (svc *Service) renderCommentInline(ctx context.Context, comment *models.Comment) error {
-	_, htmlContent, _, err := svc.parseAndRenderMarkDown(ctx, comment.Content)
-	if err != nil {
-		return err
-	}
+// Special mention tags that address a group of users instead of a single
+// user or role.
+const (
+	// mentionOwners mentions all owners of the scope.
+	mentionOwners = "owners"
 
-	comment.Content = htmlContent
+	// mentionThread mentions everyone who took part in the thread.
+	mentionThread = "thread"
+)
 
-	return nil
-}
+// resolveMentions resolves the profiles of all mention nodes using a single
+// lookup. Tags that do not match a user are resolved by resolveGroupMentions.
+// Mentions that cannot be resolved are left unresolved and rendered according
+// to the UNRESOLVED_MENTIONS setting. Nodes that already have a profile
+// assigned are skipped.
+//
+// Lookup errors are logged and returned, the affected mentions are left
+// unresolved.
+func (svc *Service) resolveMentions(ctx context.Context, nodes []*mentions.Node) error {
+	if len(nodes) == 0 {
+		return nil
+	}
 
-func (svc *Service) renderCommentTree(ctx context.Context, tree *models.CommentTree) error {
 	merr := new(multierror.Error)
-	if err := svc.renderCommentInline(ctx, &tree.Comment); err != nil {
-		merr.Errors = append(merr.Errors, fmt.Errorf("%q: %w", tree.Comment.ID.Hex(), err))
+
+	var tags []string
+	for _, n := range nodes {
+		if n.Profile != nil {
+			continue
+		}
+
+		switch tag := string(n.Tag); tag {
+		case mentionOwners, mentionThread:
+			// special group tags take precedence over users
+		default:
+			tags = append(tags, tag)
+		}
 	}
 
-	for idx := range tree.Answers {
-		subTree := tree.Answers[idx]
+	profiles, err := svc.Profiles.Resolve(ctx, tags)
+	if err != nil {
+		log.L(ctx).Errorf("failed to resolve user mentions: %s", err)
+
+		merr.Errors = append(merr.Errors, err)
+	}
 
-		if err := svc.renderCommentTree(ctx, subTree); err != nil {
-			merr.Errors = append(merr.Errors, err)
+	for _, n := range nodes {
+		if profile, ok := profiles[string(n.Tag)]; ok && n.Profile == nil {
+			n.Profile = profile
 		}
 	}
 
+	if err := svc.resolveGroupMentions(ctx, nodes); err != nil {
+		merr.Errors = append(merr.Errors, err)
+	}
+
 	return merr.ErrorOrNil()
 }
 
-func (svc *Service) sendNotifications(comment models.Comment) {
-	commentIdStr := comment.ID.Hex()
-
-	// 10 seconds should be enought for our usecase, just make sure we don't get stuck somewhere
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
+// resolveGroupMentions resolves mention nodes without a profile as special
+// group tags (see mentionOwners and mentionThread) or roles. Tags are never
+// matched against users.
+//
+// Lookup errors are logged and returned, the affected mentions are left
+// unresolved.
+func (svc *Service) resolveGroupMentions(ctx context.Context, nodes []*mentions.Node) error {
+	var roleTags []string
+	for _, n := range nodes {
+		if n.Profile != nil || n.Group != nil {
+			continue
+		}
 
-	// get the creator user profile so we can construct a pretty mail header
-	creator, err := svc.Users.GetUser(ctx, connect.NewRequest(&idmv1.GetUserRequest{
-		Search: &idmv1.GetUserRequest_Id{
-			Id: comment.CreatorID,
-		},
-	}))
-	if err != nil {
-		log.L(ctx).Errorf("failed to load comment creator profile %q: %s", comment.CreatorID, err)
+		switch tag := string(n.Tag); tag {
+		case mentionOwners, mentionThread:
+			n.Group = &mentions.Group{
+				ID:   tag,
+				Name: tag,
+			}
 
-		return
+		default:
+			roleTags = append(roleTags, tag)
+		}
 	}
 
-	// build a user-"notification reason" map indexed by user id
-	userMap := make(map[string]string /* reason: mention/parent */)
+	if len(roleTags) == 0 {
+		return nil
+	}
 
-	// load the scope and add all owners to the userMap
-	scope, err := svc.Repository.GetScopeByID(ctx, comment.Scope)
+	roles, err := svc.Profiles.ResolveRoles(ctx, roleTags)
 	if err != nil {
-		log.L(ctx).Errorf("failed to load scope %q: %s", comment.Scope, err)
+		log.L(ctx).Errorf("failed to resolve role mentions: %s", err)
+	}
 
-		return
+	for _, n := range nodes {
+		if n.Profile != nil || n.Group != nil {
+			continue
+		}
+
+		if role, ok := roles[string(n.Tag)]; ok {
+			n.Group = &mentions.Group{
+				ID:   role.GetId(),
+				Name: role.GetName(),
+			}
+
+			continue
+		}
+
+		log.L(ctx).Debugf("failed to resolve mention %q", string(n.Tag))
 	}
 
-	for _, ownerId := range scope.OwnerIDs {
-		userMap[ownerId] = "owner"
+	return err
+}
+
+// commentMentions sorts the mention nodes of comments by how they need to be
+// resolved so the mentions of many comments can be resolved at once.
+type commentMentions struct {
+	// stored refers to users in models.Comment.Mentions.
+	stored []*mentions.Node
+	// groups are the remaining mentions of comments with canonical
+	// mentions. They did not match a user when the comment was written so
+	// they may only refer to groups.
+	groups []*mentions.Node
+	// legacy are the remaining mentions of older comments, which may still
+	// mention users by name.
+	legacy []*mentions.Node
+}
+
+func (cm *commentMentions) add(comment models.Comment, nodes []*mentions.Node) {
+	for _, n := range nodes {
+		switch {
+		case slices.Contains(comment.Mentions, string(n.Tag)):
+			cm.stored = append(cm.stored, n)
+		case comment.CanonicalMentions:
+			cm.groups = append(cm.groups, n)
+		default:
+			cm.legacy = append(cm.legacy, n)
+		}
 	}
+}
 
-	// find all parent comments so we know which users to notify
-	parentComments, err := svc.Repository.GetParentComments(ctx, commentIdStr)
-	if err != nil {
-		log.L(ctx).Errorf("failed to get parent comments for id %q: %s", commentIdStr, err)
+func (svc *Service) resolveCommentMentions(ctx context.Context, cm *commentMentions) {
+	svc.resolveStoredMentions(ctx, cm.stored)
+	svc.resolveGroupMentions(ctx, cm.groups)
+	svc.resolveMentions(ctx, cm.legacy)
+}
 
+// resolveStoredMentions assigns profiles to nodes that refer to a user stored
+// in models.Comment.Mentions. Those tags are user IDs and are never matched
+// against user names, so renaming a user does not change the mentions of
+// existing comments.
+func (svc *Service) resolveStoredMentions(ctx context.Context, nodes []*mentions.Node) {
+	if len(nodes) == 0 {
 		return
 	}
 
-	for _, pc := range parentComments {
-		// those users are notified because the created/answered at a parent comment
-		userMap[pc.CreatorID] = "parent"
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if !slices.Contains(ids, string(n.Tag)) {
+			ids = append(ids, string(n.Tag))
+		}
 	}
 
-	// parse the markdown content, extract/resolve @-user-mentions and convert it to some
-	// nice HTML
-	_, htmlContent, userMentions, err := svc.parseAndRenderMarkDown(ctx, comment.Content)
+	profiles, err := svc.Profiles.ResolveIDs(ctx, ids)
 	if err != nil {
-		log.L(ctx).Errorf("failed to parse and render comment content: %s", err)
-
-		return
+		log.L(ctx).Errorf("failed to load profiles of mentioned users: %s", err)
 	}
 
-	// add all user-ids from @-mentions
-	for _, user := range userMentions {
-		userMap[user.User.Id] = "mention"
+	for _, n := range nodes {
+		if profile, ok := profiles[string(n.Tag)]; ok {
+			n.Profile = profile
+		}
 	}
+}
+
+// canonicalizeMentions resolves the user mentions of content and rewrites
+// them to use the user ID, which, in contrast to the user name, never
+// changes. It returns the rewritten content and the IDs of all mentioned
+// users.
+//
+// If UNRESOLVED_MENTIONS is set to reject, content with mentions that
+// cannot be resolved is rejected with an InvalidArgument error.
+func (svc *Service) canonicalizeMentions(ctx context.Context, scope models.Scope, content string) (string, []string, error) {
+	source := []byte(content)
+
+	rootNode := svc.newMarkdown(ctx, scope).Parser().Parse(text.NewReader(source))
+
+	nodes := mentions.Nodes(rootNode)
+	resolveErr := svc.resolveMentions(ctx, nodes)
+
+	if mentions.UnresolvedMode(svc.Config.UnresolvedMentions) == mentions.UnresolvedReject {
+		var unresolved []string
+		for _, n := range nodes {
+			if !n.Resolved() {
+				unresolved = append(unresolved, string(n.Segment.Value(source)))
+			}
+		}
 
-	// get a pretty display name for the creator
-	creatorDisplayName := creator.Msg.GetProfile().GetUser().GetDisplayName()
-	if creatorDisplayName == "" {
-		creatorDisplayName = creator.Msg.GetProfile().GetUser().GetUsername()
+		if len(unresolved) > 0 {
+			// do not blame the user if the IDM is not reachable
+			if resolveErr != nil {
+				return "", nil, connect.NewError(connect.CodeUnavailable, fmt.Errorf("failed to resolve mentions: %w", resolveErr))
+			}
+
+			return "", nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unknown mentions: %s", strings.Join(unresolved, ", ")))
+		}
 	}
 
-	// Finally, send e-mail notifications to all users that somehow participated in the
-	// conversation. This is one after another, errors are only logged.
-	for userId, reason := range userMap {
-		// do not send mails to the creator of the comment
-		if userId == comment.CreatorID {
+	var (
+		ids  []string
+		buf  = new(bytes.Buffer)
+		last int
+	)
+
+	// nodes are in document order so segments are sorted by their position
+	for _, n := range nodes {
+		if n.Profile.GetUser() == nil {
 			continue
 		}
 
-		subject := ""
-		switch reason {
-		case "owner":
-			subject = creatorDisplayName + " hat einen neuen Kommentar in " + scope.Name + " erstellt"
-		case "mention":
-			subject = creatorDisplayName + " hat dich in einem Kommentar erwähnt"
-		case "parent":
-			subject = creatorDisplayName + " hat auf deinen Kommentar geantwortet"
+		id := n.Profile.GetUser().GetId()
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
 
-		default:
-			log.L(ctx).Errorf("unsupported notification reason %q", reason)
+		buf.Write(source[last:n.Segment.Start])
+		buf.WriteString(mentions.Format(id, source[n.Segment.Stop:]))
+		last = n.Segment.Stop
+	}
 
-			continue
+	buf.Write(source[last:])
+
+	return buf.String(), ids, nil
+}
+
+func (svc *Service) parseAndRenderMarkDown(ctx context.Context, scope models.Scope, comment models.Comment) (
+	rootNode ast.Node,
+	htmlContent string,
+	userMentions []*idmv1.Profile,
+	err error,
+) {
+	md := svc.newMarkdown(ctx, scope)
+
+	rootNode = md.Parser().Parse(text.NewReader([]byte(comment.Content)))
+
+	nodes := mentions.Nodes(rootNode)
+
+	var cm commentMentions
+	cm.add(comment, nodes)
+	svc.resolveCommentMentions(ctx, &cm)
+
+	// Collect all users that are mentioned in the comment
+	userMentionsMap := make(map[string]*idmv1.Profile)
+	for _, n := range nodes {
+		if n.Profile.GetUser() != nil {
+			userMentionsMap[n.Profile.User.Id] = n.Profile
 		}
+	}
 
-		// FIXME(ppacher): render a nice e-mail template here
-		req := &idmv1.SendNotificationRequest{
-			Message: &idmv1.SendNotificationRequest_Email{
-				Email: &idmv1.EMailMessage{
-					Subject: subject,
-					Body:    htmlContent,
-				},
-			},
-			TargetUsers:  []string{userId},
-			SenderUserId: creator.Msg.GetProfile().GetUser().GetId(),
+	// conver the userMentionsMap to a slice of *idmv1.Profile
+	userMentions = data.MapToSlice(userMentionsMap)
+
+	// actually render the markdown content as HTML
+	htmlContent, err = renderMarkdown(md, rootNode, comment.Content)
+	if err != nil {
+		return rootNode, "", userMentions, err
+	}
+
+	return rootNode, htmlContent, userMentions, nil
+}
+
+func (svc *Service) renderCommentInline(ctx context.Context, scope models.Scope, comment *models.Comment) error {
+	return svc.renderComments(ctx, scope, []*models.Comment{comment})
+}
+
+// renderCommentTrees renders all comments of trees as HTML.
+func (svc *Service) renderCommentTrees(ctx context.Context, scope models.Scope, trees ...*models.CommentTree) error {
+	var comments []*models.Comment
+
+	var collect func(tree *models.CommentTree)
+	collect = func(tree *models.CommentTree) {
+		comments = append(comments, &tree.Comment)
+
+		for _, answer := range tree.Answers {
+			collect(answer)
 		}
+	}
+
+	for _, tree := range trees {
+		collect(tree)
+	}
 
-		_, err := svc.Notify.SendNotification(ctx, connect.NewRequest(req))
+	return svc.renderComments(ctx, scope, comments)
+}
+
+// renderComments replaces the content of all comments with the rendered
+// HTML. All comments are parsed first so the mentions of all comments can be
+// resolved at once.
+func (svc *Service) renderComments(ctx context.Context, scope models.Scope, comments []*models.Comment) error {
+	md := svc.newMarkdown(ctx, scope)
+
+	var (
+		rootNodes = make([]ast.Node, len(comments))
+		cm        commentMentions
+	)
+
+	for idx, comment := range comments {
+		rootNodes[idx] = md.Parser().Parse(text.NewReader([]byte(comment.Content)))
+
+		cm.add(*comment, mentions.Nodes(rootNodes[idx]))
+	}
+
+	svc.resolveCommentMentions(ctx, &cm)
+
+	merr := new(multierror.Error)
+	for idx, comment := range comments {
+		htmlContent, err := renderMarkdown(md, rootNodes[idx], comment.Content)
 		if err != nil {
-			log.L(ctx).Errorf("failed to send notification to user %q: %s", userId, err)
+			merr.Errors = append(merr.Errors, fmt.Errorf("%q: %w", comment.ID.Hex(), err))
+
+			continue
 		}
+
+		comment.Content = htmlContent
 	}
+
+	return merr.ErrorOrNil()
 }
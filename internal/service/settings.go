@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+// Scope Settings
+
+func (svc *Service) GetScopeSettings(ctx context.Context, req *connect.Request[api.GetScopeSettingsRequest]) (*connect.Response[api.GetScopeSettingsResponse], error) {
+	scope, err := svc.Repository.GetScopeByID(ctx, req.Msg.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.GetScopeSettingsResponse{
+		Settings: scope.SettingsToAPI(),
+	}), nil
+}
+
+func (svc *Service) UpdateScopeSettings(ctx context.Context, req *connect.Request[api.UpdateScopeSettingsRequest]) (*connect.Response[api.UpdateScopeSettingsResponse], error) {
+	scope, err := svc.Repository.GetScopeByID(ctx, req.Msg.Settings.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	switch policy := models.HTMLPolicy(req.Msg.Settings.HTMLPolicy); policy {
+	case models.HTMLPolicyOmit, models.HTMLPolicyAllow, models.HTMLPolicyForbid:
+		scope.HTMLPolicy = policy
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid HTML policy %q", req.Msg.Settings.HTMLPolicy))
+	}
+
+	if err := svc.Repository.UpdateScope(ctx, scope.ID, &scope); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.UpdateScopeSettingsResponse{
+		Settings: scope.SettingsToAPI(),
+	}), nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/config"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// changeStreamRetryInterval is the time to wait before re-opening a failed
+// change stream.
+const changeStreamRetryInterval = 5 * time.Second
+
+// Comment Events
+
+func (svc *Service) WatchComments(ctx context.Context, req *connect.Request[api.WatchCommentsRequest], stream *connect.ServerStream[api.CommentEvent]) error {
+	if req.Msg.Scope == "" {
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("scope is required"))
+	}
+
+	if _, err := svc.requireScopeAccess(ctx, req.Msg.Scope, false); err != nil {
+		return err
+	}
+
+	usr := remoteUser(ctx)
+
+	ch, unsubscribe := svc.Events.Subscribe(req.Msg.Scope, req.Msg.Reference)
+	defer unsubscribe()
+
+	// send the response headers right away so clients know that the
+	// stream has been established.
+	if err := stream.Send(nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case evt, ok := <-ch:
+			if !ok {
+				return connect.NewError(connect.CodeResourceExhausted, fmt.Errorf("client is too slow, please reconnect"))
+			}
+
+			msg := &api.CommentEvent{
+				Type:    string(evt.Type),
+				Comment: evt.Comment.ToAPI(),
+			}
+
+			if usr != nil {
+				markReacted(&msg.Comment, usr.ID)
+			}
+
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// commentChanged publishes a comment event and wakes up the webhook
+// dispatcher. Webhook deliveries are enqueued by the repository together
+// with the change.
+func (svc *Service) commentChanged(t events.Type, comment models.Comment) {
+	svc.publishEvent(t, comment)
+	svc.wakeupWebhooks()
+}
+
+// publishEvent publishes a comment event on the in-process event bus. If the
+// change stream event source is configured, events are published by
+// RunChangeStream instead.
+func (svc *Service) publishEvent(t events.Type, comment models.Comment) {
+	if svc.Config.EventSource == config.EventSourceChangeStream {
+		return
+	}
+
+	svc.Events.Publish(events.Event{
+		Type:    t,
+		Comment: comment,
+	})
+}
+
+// RunChangeStream publishes comment events from a mongo change stream to the
+// in-process event bus until ctx is cancelled. This makes sure subscribers see
+// comments created through other replicas of the service.
+func (svc *Service) RunChangeStream(ctx context.Context) {
+	watcher, ok := svc.Repository.(repo.CommentWatcher)
+	if !ok {
+		log.L(ctx).Errorf("comment change streams are not supported by the configured database")
+
+		return
+	}
+
+	var resumeToken bson.Raw
+
+	for {
+		var err error
+		resumeToken, err = watcher.WatchComments(ctx, resumeToken, svc.Events.Publish)
+		if err != nil {
+			log.L(ctx).Errorf("comment change stream failed: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(changeStreamRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+	"github.com/tierklinik-dobersberg/comment-service/internal/templates"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Subscriptions
+
+func (svc *Service) Subscribe(ctx context.Context, req *connect.Request[api.SubscribeRequest]) (*connect.Response[api.SubscribeResponse], error) {
+	sub, err := svc.setSubscription(ctx, req.Msg.Target, models.SubscriptionStateSubscribed)
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.SubscribeResponse{
+		Subscription: sub.ToAPI(),
+	}), nil
+}
+
+func (svc *Service) Mute(ctx context.Context, req *connect.Request[api.MuteRequest]) (*connect.Response[api.MuteResponse], error) {
+	sub, err := svc.setSubscription(ctx, req.Msg.Target, models.SubscriptionStateMuted)
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.MuteResponse{
+		Subscription: sub.ToAPI(),
+	}), nil
+}
+
+func (svc *Service) Unsubscribe(ctx context.Context, req *connect.Request[api.UnsubscribeRequest]) (*connect.Response[api.UnsubscribeResponse], error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return nil, fmt.Errorf("no remote user specified")
+	}
+
+	target, err := svc.resolveSubscriptionTarget(ctx, req.Msg.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.Repository.DeleteSubscription(ctx, usr.ID, target); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.UnsubscribeResponse{}), nil
+}
+
+func (svc *Service) ListSubscriptions(ctx context.Context, req *connect.Request[api.ListSubscriptionsRequest]) (*connect.Response[api.ListSubscriptionsResponse], error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return nil, fmt.Errorf("no remote user specified")
+	}
+
+	subs, err := svc.Repository.ListUserSubscriptions(ctx, usr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.ListSubscriptionsResponse{
+		Subscriptions: make([]api.Subscription, len(subs)),
+	}
+
+	for idx, s := range subs {
+		res.Subscriptions[idx] = s.ToAPI()
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (svc *Service) setSubscription(ctx context.Context, t api.SubscriptionTarget, state models.SubscriptionState) (models.Subscription, error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return models.Subscription{}, fmt.Errorf("no remote user specified")
+	}
+
+	target, err := svc.resolveSubscriptionTarget(ctx, t)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	return svc.Repository.SetSubscription(ctx, usr.ID, target, state)
+}
+
+// resolveSubscriptionTarget converts t to a models.SubscriptionTarget. If t
+// specifies a thread, the root comment of the thread is looked up.
+func (svc *Service) resolveSubscriptionTarget(ctx context.Context, t api.SubscriptionTarget) (models.SubscriptionTarget, error) {
+	if t.ThreadID != "" {
+		parents, err := svc.Repository.GetParentComments(ctx, t.ThreadID)
+		if err != nil {
+			return models.SubscriptionTarget{}, err
+		}
+
+		for _, p := range parents {
+			if p.ParentID.IsZero() {
+				if _, err := svc.requireScopeAccess(ctx, p.Scope, false); err != nil {
+					return models.SubscriptionTarget{}, err
+				}
+
+				return models.SubscriptionTarget{
+					Scope:     p.Scope,
+					Reference: p.Reference,
+					RootID:    p.ID,
+				}, nil
+			}
+		}
+
+		return models.SubscriptionTarget{}, fmt.Errorf("failed to find root comment for thread %q", t.ThreadID)
+	}
+
+	if t.Scope == "" {
+		return models.SubscriptionTarget{}, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("either threadId or scope must be set"))
+	}
+
+	// make sure the scope actually exists and the user is allowed to read it
+	if _, err := svc.requireScopeAccess(ctx, t.Scope, false); err != nil {
+		return models.SubscriptionTarget{}, err
+	}
+
+	return models.SubscriptionTarget{
+		Scope:     t.Scope,
+		Reference: t.Reference,
+	}, nil
+}
+
+// applySubscriptions updates the notification recipients in userMap based on
+// user subscriptions for the thread rootId. Muted users are removed while
+// subscribed users are added. The most specific subscription of a user wins.
+func (svc *Service) applySubscriptions(ctx context.Context, comment models.Comment, rootId primitive.ObjectID, userMap map[string]templates.Reason) error {
+	subs, err := svc.Repository.FindSubscriptions(ctx, comment.Scope, comment.Reference, rootId)
+	if err != nil {
+		return err
+	}
+
+	effective := make(map[string]models.Subscription)
+	for _, sub := range subs {
+		if cur, ok := effective[sub.UserID]; ok && cur.Specificity() >= sub.Specificity() {
+			continue
+		}
+
+		effective[sub.UserID] = sub
+	}
+
+	for userId, sub := range effective {
+		switch sub.State {
+		case models.SubscriptionStateMuted:
+			delete(userMap, userId)
+
+		case models.SubscriptionStateSubscribed:
+			if _, ok := userMap[userId]; !ok {
+				userMap[userId] = templates.ReasonSubscription
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/comment-service/internal/api"
+	"github.com/tierklinik-dobersberg/comment-service/internal/events"
+	"github.com/tierklinik-dobersberg/comment-service/internal/models"
+)
+
+const (
+	// webhookPollInterval is the interval at which the dispatcher checks for
+	// due webhook deliveries if it's not woken up earlier.
+	webhookPollInterval = 10 * time.Second
+
+	// webhookTimeout limits the time for a single webhook call. Claimed
+	// deliveries are leased for twice as long.
+	webhookTimeout = 15 * time.Second
+
+	// webhookMaxAttempts is the number of delivery attempts before a
+	// delivery is marked as failed.
+	webhookMaxAttempts = 8
+
+	// webhookSignatureHeader holds the HMAC-SHA256 signature of the request
+	// body.
+	webhookSignatureHeader = "X-Comment-Signature-256"
+	// webhookEventHeader holds the event type of a webhook delivery.
+	webhookEventHeader = "X-Comment-Event"
+	// webhookDeliveryHeader holds the ID of a webhook delivery.
+	webhookDeliveryHeader = "X-Comment-Delivery"
+)
+
+// Webhook Management
+
+func (svc *Service) CreateWebhook(ctx context.Context, req *connect.Request[api.CreateWebhookRequest]) (*connect.Response[api.CreateWebhookResponse], error) {
+	usr := remoteUser(ctx)
+	if usr == nil {
+		return nil, fmt.Errorf("no remote user specified")
+	}
+
+	scope, err := svc.Repository.GetScopeByID(ctx, req.Msg.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	if u, err := url.Parse(req.Msg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid webhook URL %q", req.Msg.URL))
+	}
+
+	for _, e := range req.Msg.Events {
+		switch events.Type(e) {
+		case events.Created, events.Edited, events.Deleted:
+		default:
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid event type %q", e))
+		}
+	}
+
+	secret := req.Msg.Secret
+	if secret == "" {
+		secret, err = generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	webhook := models.Webhook{
+		Scope:     scope.ID,
+		URL:       req.Msg.URL,
+		Secret:    secret,
+		Events:    req.Msg.Events,
+		CreatedAt: time.Now(),
+		CreatorID: usr.ID,
+	}
+
+	if err := svc.Repository.CreateWebhook(ctx, &webhook); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.CreateWebhookResponse{
+		Webhook: webhook.ToAPI(true),
+	}), nil
+}
+
+func (svc *Service) ListWebhooks(ctx context.Context, req *connect.Request[api.ListWebhooksRequest]) (*connect.Response[api.ListWebhooksResponse], error) {
+	scope, err := svc.Repository.GetScopeByID(ctx, req.Msg.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	webhooks, err := svc.Repository.ListWebhooks(ctx, scope.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.ListWebhooksResponse{
+		Webhooks: make([]api.Webhook, len(webhooks)),
+	}
+
+	for idx, w := range webhooks {
+		res.Webhooks[idx] = w.ToAPI(false)
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (svc *Service) DeleteWebhook(ctx context.Context, req *connect.Request[api.DeleteWebhookRequest]) (*connect.Response[api.DeleteWebhookResponse], error) {
+	webhook, err := svc.getManagedWebhook(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.Repository.DeleteWebhook(ctx, webhook.ID); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&api.DeleteWebhookResponse{}), nil
+}
+
+func (svc *Service) ListWebhookDeliveries(ctx context.Context, req *connect.Request[api.ListWebhookDeliveriesRequest]) (*connect.Response[api.ListWebhookDeliveriesResponse], error) {
+	webhook, err := svc.getManagedWebhook(ctx, req.Msg.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	state := models.WebhookDeliveryState(req.Msg.State)
+	switch state {
+	case "", models.WebhookDeliveryStatePending, models.WebhookDeliveryStateDelivered, models.WebhookDeliveryStateFailed:
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid state %q", req.Msg.State))
+	}
+
+	limit := req.Msg.Limit
+	switch {
+	case limit < 0:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid limit"))
+	case limit == 0:
+		limit = defaultPageSize
+	case limit > maxPageSize:
+		limit = maxPageSize
+	}
+
+	deliveries, err := svc.Repository.ListWebhookDeliveries(ctx, webhook.ID, state, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.ListWebhookDeliveriesResponse{
+		Deliveries: make([]api.WebhookDelivery, len(deliveries)),
+	}
+
+	for idx, d := range deliveries {
+		res.Deliveries[idx] = d.ToAPI()
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (svc *Service) RetryWebhookDelivery(ctx context.Context, req *connect.Request[api.RetryWebhookDeliveryRequest]) (*connect.Response[api.RetryWebhookDeliveryResponse], error) {
+	delivery, err := svc.Repository.GetWebhookDelivery(ctx, req.Msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.getManagedWebhook(ctx, delivery.WebhookID.Hex()); err != nil {
+		return nil, err
+	}
+
+	delivery, err = svc.Repository.RetryWebhookDelivery(ctx, delivery.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.wakeupWebhooks()
+
+	return connect.NewResponse(&api.RetryWebhookDeliveryResponse{
+		Delivery: delivery.ToAPI(),
+	}), nil
+}
+
+// getManagedWebhook returns the webhook with id and makes sure the remote
+// user is allowed to manage the webhook's scope.
+func (svc *Service) getManagedWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	webhook, err := svc.Repository.GetWebhook(ctx, id)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	scope, err := svc.Repository.GetScopeByID(ctx, webhook.Scope)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	if err := requireScopeManager(ctx, scope); err != nil {
+		return models.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// Webhook Delivery
+
+// RunWebhookDispatcher delivers pending webhook calls until ctx is cancelled.
+// Failed deliveries are retried with an exponential backoff. It's safe to run
+// the dispatcher on multiple replicas.
+func (svc *Service) RunWebhookDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			delivery, err := svc.Repository.ClaimWebhookDelivery(ctx, 2*webhookTimeout)
+			if err != nil {
+				log.L(ctx).Errorf("failed to claim webhook delivery: %s", err)
+				break
+			}
+
+			if delivery == nil {
+				break
+			}
+
+			svc.dispatchWebhookDelivery(ctx, *delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-svc.webhookWakeup:
+		}
+	}
+}
+
+// wakeupWebhooks notifies the dispatcher that there are new deliveries.
+func (svc *Service) wakeupWebhooks() {
+	select {
+	case svc.webhookWakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (svc *Service) dispatchWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) {
+	l := log.L(ctx).WithField("deliveryId", delivery.ID.Hex()).WithField("webhookId", delivery.WebhookID.Hex())
+
+	webhook, err := svc.Repository.GetWebhook(ctx, delivery.WebhookID.Hex())
+	if err != nil {
+		var cerr *connect.Error
+		if errors.As(err, &cerr) && cerr.Code() == connect.CodeNotFound {
+			// the webhook has been deleted in the meantime
+			l.Infof("webhook not found, dropping delivery")
+
+			err = fmt.Errorf("webhook has been deleted")
+			delivery.Attempts = webhookMaxAttempts
+		}
+
+		svc.failWebhookDelivery(ctx, delivery, 0, err)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		delivery.Attempts = webhookMaxAttempts
+		svc.failWebhookDelivery(ctx, delivery, 0, err)
+
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(webhook.Secret, []byte(delivery.Payload)))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		svc.failWebhookDelivery(ctx, delivery, 0, err)
+
+		return
+	}
+	defer res.Body.Close()
+
+	// drain the body so the connection can be re-used
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		svc.failWebhookDelivery(ctx, delivery, res.StatusCode, fmt.Errorf("unexpected status code %d", res.StatusCode))
+
+		return
+	}
+
+	if err := svc.Repository.CompleteWebhookDelivery(ctx, delivery.ID, res.StatusCode); err != nil {
+		l.Errorf("failed to mark webhook delivery as delivered: %s", err)
+	}
+}
+
+func (svc *Service) failWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery, statusCode int, reason error) {
+	l := log.L(ctx).WithField("deliveryId", delivery.ID.Hex()).WithField("attempt", delivery.Attempts)
+
+	var next time.Time
+	if delivery.Attempts < webhookMaxAttempts {
+		next = time.Now().Add(outboxBackoff(delivery.Attempts))
+
+		l.Errorf("failed to deliver webhook, retrying at %s: %s", next.Format(time.RFC3339), reason)
+	} else {
+		l.Errorf("failed to deliver webhook, giving up: %s", reason)
+	}
+
+	// use a fresh context as ctx might have timed out.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := svc.Repository.FailWebhookDelivery(ctx, delivery.ID, statusCode, reason.Error(), next); err != nil {
+		l.Errorf("failed to update webhook delivery: %s", err)
+	}
+}
+
+// signWebhookPayload returns the value for the webhookSignatureHeader.
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
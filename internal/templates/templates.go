@@ -0,0 +1,277 @@
+// Package templates renders localized notification messages.
+//
+// Templates are loaded from an optional template directory and fall back to
+// the embedded defaults. The directory layout is the same for both:
+//
+//	layout.html        - the HTML skeleton, must define "layout"
+//	<lang>/<reason>.tmpl - per-language and per-reason templates
+//
+// Each reason template must define "subject", "view" (the label of the view
+// link), "body" (the HTML content) and "text" (the plain-text message).
+//
+// Besides the builtin functions, templates may use "quote" which prefixes
+// every line of a string with "> ".
+package templates
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/overlayfs"
+)
+
+// DefaultLanguage is used if a template is not available in the language
+// of the recipient.
+const DefaultLanguage = "de"
+
+//go:embed defaults
+var defaults embed.FS
+
+// Reason describes why a user receives a notification.
+type Reason string
+
+const (
+	ReasonOwner        = Reason("owner")
+	ReasonMention      = Reason("mention")
+	ReasonParent       = Reason("parent")
+	ReasonSubscription = Reason("subscription")
+)
+
+// Reasons holds all supported notification reasons.
+var Reasons = []Reason{
+	ReasonOwner,
+	ReasonMention,
+	ReasonParent,
+	ReasonSubscription,
+}
+
+type (
+	// Comment holds the rendered content of a comment.
+	Comment struct {
+		CreatorName string
+		HTML        htmltemplate.HTML
+		Text        string
+	}
+
+	// Context is passed to all notification templates.
+	Context struct {
+		// Language is set to the language of the template that is executed.
+		Language string
+
+		RecipientName string
+		ScopeName     string
+		ViewURL       string
+
+		// Comment is the comment the notification is about.
+		Comment
+
+		// Parent is the comment that has been answered, if any.
+		Parent *Comment
+	}
+
+	// Message is a rendered notification message.
+	Message struct {
+		Subject string
+		HTML    string
+		Text    string
+	}
+)
+
+type templateSet struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Engine renders notification messages.
+type Engine struct {
+	sets map[string]map[Reason]*templateSet
+}
+
+// New parses all notification templates. If dir is set, templates from dir
+// take precedence over the embedded default templates.
+func New(dir string) (*Engine, error) {
+	embedded, err := fs.Sub(defaults, "defaults")
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []fs.FS{embedded}
+	if dir != "" {
+		sources = append([]fs.FS{os.DirFS(dir)}, sources...)
+	}
+
+	root := overlayfs.NewFS(sources...)
+
+	layout, err := fs.ReadFile(root, "layout.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout.html: %w", err)
+	}
+
+	e := &Engine{
+		sets: make(map[string]map[Reason]*templateSet),
+	}
+
+	for _, lang := range languages(sources) {
+		for _, reason := range Reasons {
+			name := path.Join(lang, string(reason)+".tmpl")
+
+			content, err := fs.ReadFile(root, name)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+
+			set, err := parseSet(name, string(layout), string(content))
+			if err != nil {
+				return nil, err
+			}
+
+			if e.sets[lang] == nil {
+				e.sets[lang] = make(map[Reason]*templateSet)
+			}
+
+			e.sets[lang][reason] = set
+		}
+	}
+
+	for _, reason := range Reasons {
+		if e.sets[DefaultLanguage][reason] == nil {
+			return nil, fmt.Errorf("missing %q template for the default language %q", reason, DefaultLanguage)
+		}
+	}
+
+	return e, nil
+}
+
+// Render renders the notification message for reason. If the template is not
+// available for lang, the DefaultLanguage is used.
+func (e *Engine) Render(lang string, reason Reason, ctx Context) (*Message, error) {
+	lang = NormalizeLanguage(lang)
+
+	set := e.sets[lang][reason]
+	if set == nil {
+		lang = DefaultLanguage
+		set = e.sets[lang][reason]
+	}
+
+	if set == nil {
+		return nil, fmt.Errorf("unsupported notification reason %q", reason)
+	}
+
+	ctx.Language = lang
+
+	subject := new(strings.Builder)
+	if err := set.text.ExecuteTemplate(subject, "subject", ctx); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %w", err)
+	}
+
+	text := new(strings.Builder)
+	if err := set.text.ExecuteTemplate(text, "text", ctx); err != nil {
+		return nil, fmt.Errorf("failed to render plain-text message: %w", err)
+	}
+
+	html := new(strings.Builder)
+	if err := set.html.ExecuteTemplate(html, "layout", ctx); err != nil {
+		return nil, fmt.Errorf("failed to render HTML message: %w", err)
+	}
+
+	return &Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()),
+	}, nil
+}
+
+// NormalizeLanguage converts a locale like "en-US" or "de_AT" to a lower-case
+// language code.
+func NormalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+
+	if idx := strings.IndexAny(lang, "-_"); idx >= 0 {
+		lang = lang[:idx]
+	}
+
+	return lang
+}
+
+// funcs holds the functions available to all templates.
+var funcs = map[string]any{
+	"quote": quote,
+}
+
+// quote prefixes every line of s with "> " so multi-line comments are
+// quoted as a whole in plain-text messages.
+func quote(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimRight("> "+line, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func parseSet(name string, layout string, content string) (*templateSet, error) {
+	html, err := htmltemplate.New(name).Funcs(funcs).Parse(layout)
+	if err == nil {
+		_, err = html.Parse(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML template %s: %w", name, err)
+	}
+
+	text, err := texttemplate.New(name).Funcs(funcs).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text template %s: %w", name, err)
+	}
+
+	for _, required := range []string{"subject", "view", "body", "text"} {
+		if text.Lookup(required) == nil {
+			return nil, fmt.Errorf("template %s does not define %q", name, required)
+		}
+	}
+
+	return &templateSet{
+		html: html,
+		text: text,
+	}, nil
+}
+
+// languages returns the names of all language directories in sources.
+func languages(sources []fs.FS) []string {
+	var (
+		result []string
+		seen   = make(map[string]struct{})
+	)
+
+	for _, src := range sources {
+		entries, err := fs.ReadDir(src, ".")
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+
+			if _, ok := seen[e.Name()]; ok {
+				continue
+			}
+
+			seen[e.Name()] = struct{}{}
+			result = append(result, e.Name())
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,58 @@
+package mentions
+
+import (
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Kind is the ast.NodeKind of mention nodes.
+var Kind = ast.NewNodeKind("Mention")
+
+// Node is an inline node for a single mention.
+type Node struct {
+	ast.BaseInline
+
+	// Tag is the user ID or name of the mentioned user. For quoted
+	// mentions, like @"Dr. Maier", it holds the name without quotes.
+	Tag []byte
+
+	// Quoted is set if Tag has been quoted.
+	Quoted bool
+
+	// Profile is set if the mention has been resolved to a single user.
+	Profile *idmv1.Profile
+
+	// Group is set if the mention has been resolved to a group of users,
+	// like the members of a role.
+	Group *Group
+
+	// Segment is the position of the mention, including the leading @,
+	// in the source.
+	Segment text.Segment
+}
+
+// Group is a set of users mentioned by a single tag.
+type Group struct {
+	// ID identifies the group, like the ID of a role.
+	ID string
+
+	// Name is rendered instead of the tag.
+	Name string
+}
+
+// Resolved reports whether the mention has been resolved to a user or a
+// group of users.
+func (n *Node) Resolved() bool {
+	return n.Profile.GetUser() != nil || n.Group != nil
+}
+
+func (*Node) Kind() ast.NodeKind {
+	return Kind
+}
+
+func (n *Node) Dump(src []byte, level int) {
+	ast.DumpHelper(n, src, level, map[string]string{
+		"ID": string(n.Tag),
+	}, nil)
+}
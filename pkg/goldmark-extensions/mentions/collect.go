@@ -0,0 +1,41 @@
+package mentions
+
+import (
+	"context"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Nodes returns all mention nodes of the parsed documents in document
+// order.
+func Nodes(roots ...ast.Node) []*Node {
+	var result []*Node
+
+	for _, root := range roots {
+		_ = ast.Walk(root, func(node ast.Node, enter bool) (ast.WalkStatus, error) {
+			if n, ok := node.(*Node); ok && enter {
+				result = append(result, n)
+			}
+
+			return ast.WalkContinue, nil
+		})
+	}
+
+	return result
+}
+
+// Collect parses source and returns all mentions without rendering the
+// document. If resolver is set, the mentions are resolved while parsing.
+// Mentions in code spans and code blocks are ignored.
+func Collect(ctx context.Context, source []byte, resolver Resolver) []*Node {
+	md := goldmark.New(
+		goldmark.WithExtensions(&Extender{
+			Context:  ctx,
+			Resolver: resolver,
+		}),
+	)
+
+	return Nodes(md.Parser().Parse(text.NewReader(source)))
+}
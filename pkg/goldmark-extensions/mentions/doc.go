@@ -0,0 +1,22 @@
+// Package mentions is a goldmark extension for @-mentions of users and
+// groups of users.
+//
+// Mentions start with an @ at a word boundary and are followed by either a
+// tag, like @alice or @6543-abcd, or a quoted name, like @"Dr. Maier". They
+// are resolved to user profiles by a Resolver, either while parsing or
+// afterwards using the nodes returned by Nodes. Resolved mentions are
+// rendered as HTML using a configurable template, unresolved ones according
+// to the configured UnresolvedMode.
+//
+// Besides the HTML renderer, the package provides a plain-text renderer
+// (PlainText and PlainTextRenderer) and Collect to extract mentions without
+// rendering.
+//
+//	md := goldmark.New(
+//		goldmark.WithExtensions(&mentions.Extender{
+//			Resolver: mentions.ResolverFunc(func(ctx context.Context, n *mentions.Node) (*idmv1.Profile, error) {
+//				return lookupUser(ctx, string(n.Tag))
+//			}),
+//		}),
+//	)
+package mentions
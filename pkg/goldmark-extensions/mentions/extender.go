@@ -0,0 +1,117 @@
+package mentions
+
+import (
+	"context"
+	"html/template"
+
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// Resolver resolves the tag of a mention to the profile of a user. If the
+// tag does not match any user, Resolver should return a nil profile and a
+// nil error.
+type Resolver interface {
+	ResolveMention(ctx context.Context, n *Node) (profile *idmv1.Profile, err error)
+}
+
+type ResolverFunc func(context.Context, *Node) (*idmv1.Profile, error)
+
+func (fn ResolverFunc) ResolveMention(ctx context.Context, n *Node) (*idmv1.Profile, error) {
+	return fn(ctx, n)
+}
+
+// UnresolvedMode defines how mentions are handled that cannot be resolved.
+type UnresolvedMode string
+
+const (
+	// UnresolvedText renders unresolved mentions as plain text, exactly as
+	// they have been written. This is the default.
+	UnresolvedText UnresolvedMode = "text"
+
+	// UnresolvedSpan renders unresolved mentions as a
+	// <span class="mention mention-unresolved"> element.
+	UnresolvedSpan UnresolvedMode = "span"
+
+	// UnresolvedReject renders unresolved mentions like UnresolvedText.
+	// Users of the extension are expected to reject content with
+	// unresolved mentions before storing it, see Node.Resolved.
+	UnresolvedReject UnresolvedMode = "reject"
+)
+
+// Valid reports whether m is one of the known modes or empty.
+func (m UnresolvedMode) Valid() bool {
+	switch m {
+	case "", UnresolvedText, UnresolvedSpan, UnresolvedReject:
+		return true
+	default:
+		return false
+	}
+}
+
+// Extender adds the mention parser and the HTML renderer to a
+// goldmark.Markdown.
+type Extender struct {
+	// Context is passed to the Resolver and cancels rendering. It may be
+	// overwritten per document using WithContext.
+	Context context.Context
+
+	// Resolver, if set, resolves mentions while parsing. If nil, mentions
+	// are left unresolved and may be resolved later on, for example in a
+	// single batch for all nodes returned by Nodes.
+	Resolver Resolver
+
+	// Template is used to render resolved mentions as HTML. Defaults to
+	// DefaultTemplate.
+	Template *template.Template
+
+	// Unresolved defines how mentions are rendered that cannot be resolved.
+	// Defaults to UnresolvedText.
+	Unresolved UnresolvedMode
+}
+
+func (e *Extender) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			util.Prioritized(
+				&Parser{
+					Context:  e.Context,
+					Resolver: e.Resolver,
+				},
+				999,
+			),
+		),
+	)
+
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(
+				&Renderer{
+					Context:    e.Context,
+					Template:   e.Template,
+					Unresolved: e.Unresolved,
+				},
+				999,
+			),
+		),
+	)
+}
+
+var contextKey = parser.NewContextKey()
+
+// WithContext returns a parse option that passes ctx to the Resolver instead
+// of Extender.Context. It must be specified after parser.WithContext.
+func WithContext(ctx context.Context) parser.ParseOption {
+	return func(c *parser.ParseConfig) {
+		if c.Context == nil {
+			c.Context = parser.NewContext()
+		}
+
+		c.Context.Set(contextKey, ctx)
+	}
+}
+
+var _ goldmark.Extender = (*Extender)(nil)
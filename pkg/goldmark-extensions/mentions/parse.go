@@ -0,0 +1,171 @@
+package mentions
+
+import (
+	"bytes"
+	"context"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Parser is the inline parser for mentions. Mentions start with an @ at a
+// word boundary followed by either a tag of letters, numbers, dashes and
+// underscores or a quoted name.
+type Parser struct {
+	Context context.Context
+
+	Resolver Resolver
+}
+
+func (*Parser) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (p *Parser) Parse(_ ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, seg := block.PeekLine()
+
+	ctx := p.Context
+	if c, ok := pc.Get(contextKey).(context.Context); ok {
+		ctx = c
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	l := log.L(ctx)
+
+	l.Debugf("parsing line %q", string(line))
+
+	if len(line) == 0 || line[0] != '@' {
+		l.Debugf("line is empty or does not start with a mention symbol")
+
+		return nil
+	}
+
+	// mentions must start at a word boundary. This keeps e-mail addresses
+	// like user@example.com intact.
+	if !isBoundary(block.PrecendingCharacter()) {
+		return nil
+	}
+
+	line = line[1:]
+
+	var (
+		tag []byte
+		end int
+	)
+
+	if len(line) > 0 && line[0] == '"' {
+		// quoted names may contain spaces and punctuation, like
+		// @"Dr. Maier"
+		end = getQuotedSpan(line)
+		if end < 0 {
+			l.Debugf("unterminated quoted mention")
+
+			return nil
+		}
+
+		tag = line[1 : end-1]
+	} else {
+		end = getSpan(line)
+		if end < 0 {
+			l.Debugf("invalid mention tag")
+
+			return nil
+		}
+
+		tag = line[:end]
+	}
+
+	seg = seg.WithStop(seg.Start + end + 1) // + '@'
+
+	n := Node{
+		Tag:     tag,
+		Quoted:  line[0] == '"',
+		Segment: seg,
+	}
+
+	// unresolved mentions are kept, the renderer decides how to display
+	// them.
+	if res := p.Resolver; res != nil {
+		profile, err := res.ResolveMention(ctx, &n)
+		if err != nil {
+			l.Debugf("failed to resolve profile %q: %s", n.Tag, err)
+		} else {
+			n.Profile = profile
+		}
+	}
+
+	// do not append the next segment as as text because
+	// we render the displayName of the user in "Renderer" instead of
+	// the specified ID/username:
+	//
+	// -- n.AppendChild(&n, ast.NewTextSegment(seg))
+
+	block.Advance(seg.Len())
+
+	return &n
+}
+
+func getSpan(line []byte) int {
+	start, sz := utf8.DecodeRune(line)
+
+	if unicode.IsLetter(start) || unicode.IsNumber(start) {
+		// skip the first symbol
+		line = line[sz:]
+
+		if i := bytes.IndexFunc(line, endOfMention); i >= 0 {
+			return i + sz
+		}
+
+		return len(line) + sz
+	}
+
+	// invalid mention tag; must either start with a letter or a number
+	return -1
+}
+
+// getQuotedSpan returns the length of the quoted name at the start of line,
+// including both quotes, or -1 if the name is empty or not terminated.
+func getQuotedSpan(line []byte) int {
+	end := bytes.IndexByte(line[1:], '"')
+	if end <= 0 {
+		return -1
+	}
+
+	name := line[1 : end+1]
+	if !utf8.Valid(name) || len(bytes.TrimSpace(name)) == 0 {
+		return -1
+	}
+
+	return end + 2
+}
+
+func endOfMention(r rune) bool {
+	// combining marks are part of the tag so decomposed characters
+	// do not end the mention.
+	return !unicode.IsNumber(r) && !unicode.IsLetter(r) && !unicode.IsMark(r) && r != '-' && r != '_'
+}
+
+// isBoundary reports whether a mention may start after r.
+func isBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r) && r != '_' && r != '@' && r != '"'
+}
+
+// Format returns the mention of tag to be written in front of next. The tag
+// is quoted if it would not be parsed as a whole otherwise, for example
+// because it contains spaces or next continues the tag.
+func Format(tag string, next []byte) string {
+	if getSpan(append([]byte(tag), next...)) == len(tag) {
+		return "@" + tag
+	}
+
+	return `@"` + tag + `"`
+}
+
+var _ parser.InlineParser = (*Parser)(nil)
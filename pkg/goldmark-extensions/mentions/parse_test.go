@@ -0,0 +1,352 @@
+package mentions
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+)
+
+// parseSeeds are inputs that have caused trouble or are easy to get wrong.
+var parseSeeds = []string{
+	"@alice",
+	"hello @alice",
+	"hello @",
+	"@",
+	"@@alice",
+	"user@example.com",
+	"mail user@example.com or @alice",
+	`@"Dr. Maier" hi`,
+	`@"unterminated`,
+	`@""`,
+	`@"  "`,
+	"@jose\u0301 and @e\u0301",
+	"a\u0301@alice",
+	"@דני שלום",
+	"\u200f@דני\u200f",
+	"\u202e@alice\u202c",
+	"@alice\u200bbob",
+	"\u200b@alice",
+	"@\u200balice",
+	"`@alice` @bob",
+	"(@alice) [@bob](https://example.com)",
+	"_@alice_ *@bob*",
+	"@alice\n@bob",
+	"@\xff\xfe",
+	"@a\xff",
+}
+
+func parseTags(t *testing.T, source string) []string {
+	t.Helper()
+
+	var tags []string
+	for _, n := range Collect(context.Background(), []byte(source), nil) {
+		tag := string(n.Tag)
+		if n.Quoted {
+			tag = `"` + tag + `"`
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		source string
+		want   []string
+	}{
+		{"@alice", []string{"alice"}},
+		{"hello @alice, and @bob.", []string{"alice", "bob"}},
+		{"@alice_b-c!", []string{"alice_b-c"}},
+		{"@42", []string{"42"}},
+		{"(@alice)", []string{"alice"}},
+		{"@alice\n@bob", []string{"alice", "bob"}},
+
+		// start and end of the buffer
+		{"@", nil},
+		{"hello @", nil},
+		{"@ alice", nil},
+		{"@-alice", nil},
+		{"@@alice", nil},
+
+		// quoted names
+		{`@"Dr. Maier" hi`, []string{`"Dr. Maier"`}},
+		{`@"Dr. Maier"`, []string{`"Dr. Maier"`}},
+		{`@"unterminated`, nil},
+		{`@"unterminated` + "\n" + `name"`, nil},
+		{`@""`, nil},
+		{`@"  "`, nil},
+		{`x@"Dr. Maier"`, nil},
+
+		// e-mail addresses and other words with an @
+		{"user@example.com", nil},
+		{"mail user@example.com or @alice", []string{"alice"}},
+		{"_@alice", nil},
+
+		// code is never parsed
+		{"`@alice` @bob", []string{"bob"}},
+
+		// combining marks are part of the tag and no boundary
+		{"@jose\u0301 hi", []string{"jose\u0301"}},
+		{"a\u0301@alice", nil},
+		{"@\u0301alice", nil},
+
+		// right-to-left scripts and direction marks
+		{"@דני hi", []string{"דני"}},
+		{"\u200f@דני\u200f", []string{"דני"}},
+
+		// zero-width characters end a tag and are a boundary
+		{"@alice\u200bbob", []string{"alice"}},
+		{"\u200b@alice", []string{"alice"}},
+		{"@\u200balice", nil},
+	}
+
+	for _, tc := range cases {
+		if got := parseTags(t, tc.source); !slices.Equal(tc.want, got) {
+			t.Errorf("%q: expected %q, got %q", tc.source, tc.want, got)
+		}
+	}
+}
+
+func TestGetSpan(t *testing.T) {
+	cases := []struct {
+		line string
+		want int
+	}{
+		{"alice", 5},
+		{"alice bob", 5},
+		{"alice.", 5},
+		{"alice@example.com", 5},
+		{"a-b_c", 5},
+		{"1a", 2},
+		{"é", 2},
+		{"e\u0301x y", 4},
+		{"a\u200b", 1},
+		{"a\xff", 1},
+		{"", -1},
+		{" alice", -1},
+		{"-alice", -1},
+		{"_alice", -1},
+		{"\u0301a", -1},
+		{"\xffa", -1},
+	}
+
+	for _, tc := range cases {
+		if got := getSpan([]byte(tc.line)); got != tc.want {
+			t.Errorf("%q: expected %d, got %d", tc.line, tc.want, got)
+		}
+	}
+}
+
+func TestGetQuotedSpan(t *testing.T) {
+	cases := []struct {
+		line string
+		want int
+	}{
+		{`"Dr. Maier" hi`, 11},
+		{`"a"`, 3},
+		{`"a"b"`, 3},
+		{`" a "`, 5},
+		{`"`, -1},
+		{`""`, -1},
+		{`"  "`, -1},
+		{`"unterminated`, -1},
+		{"\"\xff\"", -1},
+	}
+
+	for _, tc := range cases {
+		if got := getQuotedSpan([]byte(tc.line)); got != tc.want {
+			t.Errorf("%q: expected %d, got %d", tc.line, tc.want, got)
+		}
+	}
+}
+
+func TestBoundaries(t *testing.T) {
+	cases := []struct {
+		r            rune
+		boundary     bool
+		endOfMention bool
+	}{
+		{'a', false, false},
+		{'1', false, false},
+		{'ד', false, false},
+		{'\u0301', false, false},
+		{'_', false, false},
+		{'-', true, false},
+		{'@', false, true},
+		{'"', false, true},
+		{' ', true, true},
+		{'\n', true, true},
+		{'(', true, true},
+		{'.', true, true},
+		{'\u200b', true, true},
+		{'\u200f', true, true},
+		{utf8.RuneError, true, true},
+	}
+
+	for _, tc := range cases {
+		if got := isBoundary(tc.r); got != tc.boundary {
+			t.Errorf("isBoundary(%q): expected %t, got %t", tc.r, tc.boundary, got)
+		}
+
+		if got := endOfMention(tc.r); got != tc.endOfMention {
+			t.Errorf("endOfMention(%q): expected %t, got %t", tc.r, tc.endOfMention, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		tag  string
+		next string
+		want string
+	}{
+		{"alice-id", "", "@alice-id"},
+		{"alice-id", " hi", "@alice-id hi"},
+		{"alice-id", ", hi", "@alice-id, hi"},
+		{"alice-id", "s hi", `@"alice-id"s hi`},
+		{"alice-id", "-ish", `@"alice-id"-ish`},
+		{"alice-id", "_2", `@"alice-id"_2`},
+		{"alice-id", "\u0301", `@"alice-id"` + "\u0301"},
+		{"Dr. Maier", "", `@"Dr. Maier"`},
+		{"-id", "", `@"-id"`},
+	}
+
+	for _, tc := range cases {
+		got := Format(tc.tag, []byte(tc.next)) + tc.next
+		if got != tc.want {
+			t.Errorf("%q before %q: expected %q, got %q", tc.tag, tc.next, tc.want, got)
+		}
+
+		// the formatted mention is parsed as the tag again
+		if tags := parseTags(t, got); len(tags) != 1 || strings.Trim(tags[0], `"`) != tc.tag {
+			t.Errorf("%q before %q: %q is parsed as %v", tc.tag, tc.next, got, tags)
+		}
+	}
+}
+
+// FuzzParse parses and renders arbitrary documents and checks that every
+// mention node matches the source it has been parsed from.
+func FuzzParse(f *testing.F) {
+	for _, seed := range parseSeeds {
+		f.Add(seed)
+	}
+
+	resolver := ResolverFunc(func(ctx context.Context, n *Node) (*idmv1.Profile, error) {
+		if string(n.Tag) == "alice" {
+			return &idmv1.Profile{User: &idmv1.User{Id: "alice-id", DisplayName: "Alice"}}, nil
+		}
+
+		return nil, nil
+	})
+
+	f.Fuzz(func(t *testing.T, source string) {
+		src := []byte(source)
+
+		for _, n := range Nodes(goldmark.New(goldmark.WithExtensions(&Extender{})).Parser().Parse(text.NewReader(src))) {
+			checkNode(t, src, n)
+		}
+
+		for _, mode := range []UnresolvedMode{UnresolvedText, UnresolvedSpan} {
+			md := goldmark.New(goldmark.WithExtensions(&Extender{
+				Resolver:   resolver,
+				Unresolved: mode,
+			}))
+
+			if err := md.Convert(src, new(bytes.Buffer)); err != nil {
+				t.Fatalf("%q: failed to render: %s", source, err)
+			}
+		}
+	})
+}
+
+func checkNode(t *testing.T, src []byte, n *Node) {
+	t.Helper()
+
+	seg := n.Segment
+	if seg.Start < 0 || seg.Stop > len(src) || seg.Start >= seg.Stop || src[seg.Start] != '@' {
+		t.Fatalf("%q: invalid segment [%d:%d]", src, seg.Start, seg.Stop)
+	}
+
+	if prev, _ := utf8.DecodeLastRune(src[:seg.Start]); seg.Start > 0 && !isBoundary(prev) {
+		t.Errorf("%q: mention at %d follows %q", src, seg.Start, prev)
+	}
+
+	value := seg.Value(src)[1:]
+	if n.Quoted {
+		if len(value) < 3 || value[0] != '"' || value[len(value)-1] != '"' {
+			t.Fatalf("%q: invalid quoted mention %q", src, value)
+		}
+
+		value = value[1 : len(value)-1]
+		if bytes.ContainsRune(value, '"') || len(bytes.TrimSpace(value)) == 0 {
+			t.Errorf("%q: invalid quoted name %q", src, value)
+		}
+	} else if r, _ := utf8.DecodeRune(value); !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		t.Errorf("%q: tag %q starts with %q", src, value, r)
+	}
+
+	if !bytes.Equal(value, n.Tag) {
+		t.Errorf("%q: expected tag %q, got %q", src, value, n.Tag)
+	}
+
+	if !utf8.Valid(n.Tag) {
+		t.Errorf("%q: tag %q is not valid UTF-8", src, n.Tag)
+	}
+}
+
+// FuzzEndOfMention checks that getSpan and getQuotedSpan stop exactly at
+// the end of the tag.
+func FuzzEndOfMention(f *testing.F) {
+	for _, seed := range parseSeeds {
+		f.Add(bytes.TrimPrefix([]byte(seed), []byte("@")))
+	}
+
+	f.Fuzz(func(t *testing.T, line []byte) {
+		if end := getSpan(line); end >= 0 {
+			if end == 0 || end > len(line) {
+				t.Fatalf("%q: invalid end %d", line, end)
+			}
+
+			tag := line[:end]
+			if !utf8.Valid(tag) {
+				t.Errorf("%q: tag %q is not valid UTF-8", line, tag)
+			}
+
+			if first, _ := utf8.DecodeRune(tag); !unicode.IsLetter(first) && !unicode.IsNumber(first) {
+				t.Errorf("%q: tag %q starts with %q", line, tag, first)
+			}
+
+			if i := bytes.IndexFunc(tag, endOfMention); i >= 0 {
+				t.Errorf("%q: tag %q contains a terminating rune at %d", line, tag, i)
+			}
+
+			if next, _ := utf8.DecodeRune(line[end:]); end < len(line) && !endOfMention(next) {
+				t.Errorf("%q: tag %q ends before %q", line, tag, next)
+			}
+		} else if first, _ := utf8.DecodeRune(line); unicode.IsLetter(first) || unicode.IsNumber(first) {
+			t.Errorf("%q: expected a tag starting with %q", line, first)
+		}
+
+		quoted := append([]byte{'"'}, line...)
+		if end := getQuotedSpan(quoted); end >= 0 {
+			if end < 3 || end > len(quoted) || quoted[end-1] != '"' {
+				t.Fatalf("%q: invalid quoted end %d", quoted, end)
+			}
+
+			name := quoted[1 : end-1]
+			if bytes.ContainsRune(name, '"') || !utf8.Valid(name) || len(bytes.TrimSpace(name)) == 0 {
+				t.Errorf("%q: invalid quoted name %q", quoted, name)
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package mentions
+
+import (
+	"io"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/renderer"
+)
+
+// PlainText converts a parsed markdown document to plain text by stripping
+// all markdown syntax. Resolved mentions are replaced by "@" followed by the
+// display name of the mentioned user or the name of the mentioned group.
+// Unresolved mentions are kept as they have been written. Raw HTML is
+// dropped.
+func PlainText(root ast.Node, source []byte) string {
+	buf := new(strings.Builder)
+
+	_ = ast.Walk(root, func(node ast.Node, enter bool) (ast.WalkStatus, error) {
+		switch n := node.(type) {
+		case *Node:
+			if enter {
+				if n.Resolved() {
+					buf.WriteString("@" + displayName(n))
+				} else {
+					buf.Write(n.Segment.Value(source))
+				}
+			}
+
+			return ast.WalkSkipChildren, nil
+
+		case *ast.Text:
+			if enter {
+				buf.Write(n.Segment.Value(source))
+
+				switch {
+				case n.HardLineBreak():
+					buf.WriteString("\n")
+				case n.SoftLineBreak():
+					buf.WriteString(" ")
+				}
+			}
+
+		case *ast.String:
+			if enter {
+				buf.Write(n.Value)
+			}
+
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			if enter {
+				lines := n.Lines()
+				for i := 0; i < lines.Len(); i++ {
+					line := lines.At(i)
+					buf.Write(line.Value(source))
+				}
+			}
+
+		case *ast.AutoLink:
+			if enter {
+				buf.Write(n.URL(source))
+			}
+
+		case *east.TableCell:
+			if !enter {
+				buf.WriteString(" ")
+			}
+
+		case *ast.RawHTML, *ast.HTMLBlock:
+			// drop raw HTML
+			return ast.WalkSkipChildren, nil
+
+		default:
+			if !enter && node.Type() == ast.TypeBlock && node.NextSibling() != nil {
+				buf.WriteString("\n")
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return strings.TrimSpace(buf.String())
+}
+
+// PlainTextRenderer is a goldmark renderer that renders documents using
+// PlainText. Use it with goldmark.WithRenderer.
+type PlainTextRenderer struct{}
+
+// NewPlainTextRenderer returns a new plain-text renderer.
+func NewPlainTextRenderer() renderer.Renderer {
+	return PlainTextRenderer{}
+}
+
+func (PlainTextRenderer) Render(w io.Writer, source []byte, n ast.Node) error {
+	_, err := io.WriteString(w, PlainText(n, source))
+
+	return err
+}
+
+// AddOptions is a no-op, the plain-text renderer does not have any
+// options.
+func (PlainTextRenderer) AddOptions(...renderer.Option) {}
+
+var _ renderer.Renderer = PlainTextRenderer{}
@@ -0,0 +1,128 @@
+package mentions
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// DefaultTemplate renders user mentions as <span class="mention"> and group
+// mentions as <span class="mention mention-role"> elements.
+var DefaultTemplate = template.Must(template.New("mention").Parse(
+	`{{ if .Group }}<span class="mention mention-role" data-role="{{ .Group.ID }}">@{{ .Name }}</span>` +
+		`{{ else }}<span class="mention" data-user-id="{{ .UserID }}">@{{ .Name }}</span>{{ end }}`,
+))
+
+// TemplateData is passed to the HTML template of resolved mentions.
+type TemplateData struct {
+	// Node is the mention node that is rendered.
+	Node *Node
+
+	// UserID is the ID of the mentioned user. It is empty for group
+	// mentions.
+	UserID string
+
+	// Group is set for group mentions.
+	Group *Group
+
+	// Name is the display name or user name of the mentioned user or
+	// the name of the mentioned group, without a leading @.
+	Name string
+}
+
+// Renderer renders mention nodes as HTML.
+type Renderer struct {
+	Context context.Context
+
+	// Template renders resolved mentions. Defaults to DefaultTemplate.
+	Template *template.Template
+
+	// Unresolved defines how mentions are rendered that cannot be resolved.
+	Unresolved UnresolvedMode
+}
+
+func (r *Renderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(Kind, r.Render)
+}
+
+func (r *Renderer) Render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n, ok := node.(*Node)
+	if !ok {
+		return ast.WalkStop, fmt.Errorf("unexpected node %T, expected *Node", node)
+	}
+
+	// make sure we stop in case of an error
+	// while this seems to make sense, @-user-metions are rare so
+	// goldmark will still continue to parse/render the markdown. Though,
+	// maybe it will get support for context.Context at some point.
+	if r.Context != nil {
+		select {
+		case <-r.Context.Done():
+			return ast.WalkStop, r.Context.Err()
+		default:
+		}
+	}
+
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	if !n.Resolved() {
+		r.renderUnresolved(w, source, n)
+
+		return ast.WalkContinue, nil
+	}
+
+	tmpl := r.Template
+	if tmpl == nil {
+		tmpl = DefaultTemplate
+	}
+
+	data := TemplateData{
+		Node:   n,
+		UserID: n.Profile.GetUser().GetId(),
+		Group:  n.Group,
+		Name:   displayName(n),
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		return ast.WalkStop, fmt.Errorf("failed to render mention %q: %w", n.Tag, err)
+	}
+
+	return ast.WalkContinue, nil
+}
+
+// renderUnresolved renders the mention as it has been written in source,
+// either as plain text or, depending on r.Unresolved, wrapped in a span.
+func (r *Renderer) renderUnresolved(w util.BufWriter, source []byte, n *Node) {
+	if r.Unresolved == UnresolvedSpan {
+		_, _ = w.WriteString(`<span class="mention mention-unresolved">`)
+		_, _ = w.Write(util.EscapeHTML(n.Segment.Value(source)))
+		_, _ = w.WriteString(`</span>`)
+
+		return
+	}
+
+	_, _ = w.Write(util.EscapeHTML(n.Segment.Value(source)))
+}
+
+// displayName returns the name of the mentioned group or the display name
+// (or username) of the mentioned user, falling back to the tag.
+func displayName(n *Node) string {
+	user := n.Profile.GetUser()
+
+	switch {
+	case n.Group != nil:
+		return n.Group.Name
+	case user.GetDisplayName() != "":
+		return user.GetDisplayName()
+	case user.GetUsername() != "":
+		return user.GetUsername()
+	default:
+		return string(n.Tag)
+	}
+}
@@ -0,0 +1,106 @@
+package mentions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"testing"
+
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+)
+
+// testResolver resolves alice to a user and vets to a role.
+var testResolver = ResolverFunc(func(ctx context.Context, n *Node) (*idmv1.Profile, error) {
+	switch string(n.Tag) {
+	case "alice":
+		return &idmv1.Profile{User: &idmv1.User{Id: "alice-id", Username: "alice", DisplayName: "Alice"}}, nil
+	case "vets":
+		n.Group = &Group{ID: "vets-id", Name: "Vets"}
+	case "empty":
+		// a profile without a user is not a resolved mention
+		return &idmv1.Profile{}, nil
+	}
+
+	return nil, nil
+})
+
+func render(t *testing.T, mode UnresolvedMode, source string) string {
+	t.Helper()
+
+	md := goldmark.New(goldmark.WithExtensions(&Extender{
+		Resolver:   testResolver,
+		Unresolved: mode,
+	}))
+
+	buf := new(bytes.Buffer)
+	if err := md.Convert([]byte(source), buf); err != nil {
+		t.Fatalf("failed to render %q: %s", source, err)
+	}
+
+	return buf.String()
+}
+
+func TestRenderer(t *testing.T) {
+	cases := []struct {
+		mode   UnresolvedMode
+		source string
+		want   string
+	}{
+		{"", "hi @alice", `<p>hi <span class="mention" data-user-id="alice-id">@Alice</span></p>` + "\n"},
+		{"", "hi @vets", `<p>hi <span class="mention mention-role" data-role="vets-id">@Vets</span></p>` + "\n"},
+
+		{UnresolvedText, "hi @bob", "<p>hi @bob</p>\n"},
+		{UnresolvedText, `hi @"Dr. <b>"`, "<p>hi @&quot;Dr. &lt;b&gt;&quot;</p>\n"},
+		{UnresolvedText, "hi @empty", "<p>hi @empty</p>\n"},
+		{UnresolvedReject, "hi @bob", "<p>hi @bob</p>\n"},
+		{"", "hi @bob", "<p>hi @bob</p>\n"},
+
+		{UnresolvedSpan, "hi @bob", `<p>hi <span class="mention mention-unresolved">@bob</span></p>` + "\n"},
+		{UnresolvedSpan, `hi @"Dr. <b>"`, `<p>hi <span class="mention mention-unresolved">@&quot;Dr. &lt;b&gt;&quot;</span></p>` + "\n"},
+		{UnresolvedSpan, "hi @empty", `<p>hi <span class="mention mention-unresolved">@empty</span></p>` + "\n"},
+		{UnresolvedSpan, "hi @alice", `<p>hi <span class="mention" data-user-id="alice-id">@Alice</span></p>` + "\n"},
+	}
+
+	for _, tc := range cases {
+		if got := render(t, tc.mode, tc.source); got != tc.want {
+			t.Errorf("%q (%s): expected %q, got %q", tc.source, tc.mode, tc.want, got)
+		}
+	}
+}
+
+// TestRenderNilProfile renders nodes without a profile or with a profile
+// that has no user. Both used to panic.
+func TestRenderNilProfile(t *testing.T) {
+	source := []byte("@ghost")
+
+	for _, profile := range []*idmv1.Profile{nil, {}} {
+		for _, mode := range []UnresolvedMode{UnresolvedText, UnresolvedSpan} {
+			n := &Node{
+				Tag:     []byte("ghost"),
+				Profile: profile,
+				Segment: text.NewSegment(0, len(source)),
+			}
+
+			buf := new(bytes.Buffer)
+			w := bufio.NewWriter(buf)
+
+			r := &Renderer{Unresolved: mode}
+			if _, err := r.Render(w, source, n, true); err != nil {
+				t.Fatalf("failed to render: %s", err)
+			}
+
+			_ = w.Flush()
+
+			want := "@ghost"
+			if mode == UnresolvedSpan {
+				want = `<span class="mention mention-unresolved">@ghost</span>`
+			}
+
+			if buf.String() != want {
+				t.Errorf("profile %v (%s): expected %q, got %q", profile, mode, want, buf.String())
+			}
+		}
+	}
+}